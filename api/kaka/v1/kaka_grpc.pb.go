@@ -23,6 +23,10 @@ const _ = grpc.SupportPackageIsVersion7
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type KakaClient interface {
 	Debug(ctx context.Context, in *DebugRequest, opts ...grpc.CallOption) (*DebugReply, error)
+	ListPushes(ctx context.Context, in *ListPushesRequest, opts ...grpc.CallOption) (*ListPushesReply, error)
+	ListReaders(ctx context.Context, in *ListReadersRequest, opts ...grpc.CallOption) (*ListReadersReply, error)
+	ListRecordings(ctx context.Context, in *ListRecordingsRequest, opts ...grpc.CallOption) (*ListRecordingsReply, error)
+	GetStorage(ctx context.Context, in *GetStorageRequest, opts ...grpc.CallOption) (*GetStorageReply, error)
 }
 
 type kakaClient struct {
@@ -42,11 +46,51 @@ func (c *kakaClient) Debug(ctx context.Context, in *DebugRequest, opts ...grpc.C
 	return out, nil
 }
 
+func (c *kakaClient) ListPushes(ctx context.Context, in *ListPushesRequest, opts ...grpc.CallOption) (*ListPushesReply, error) {
+	out := new(ListPushesReply)
+	err := c.cc.Invoke(ctx, "/api.kaka.v1.Kaka/ListPushes", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kakaClient) ListReaders(ctx context.Context, in *ListReadersRequest, opts ...grpc.CallOption) (*ListReadersReply, error) {
+	out := new(ListReadersReply)
+	err := c.cc.Invoke(ctx, "/api.kaka.v1.Kaka/ListReaders", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kakaClient) ListRecordings(ctx context.Context, in *ListRecordingsRequest, opts ...grpc.CallOption) (*ListRecordingsReply, error) {
+	out := new(ListRecordingsReply)
+	err := c.cc.Invoke(ctx, "/api.kaka.v1.Kaka/ListRecordings", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kakaClient) GetStorage(ctx context.Context, in *GetStorageRequest, opts ...grpc.CallOption) (*GetStorageReply, error) {
+	out := new(GetStorageReply)
+	err := c.cc.Invoke(ctx, "/api.kaka.v1.Kaka/GetStorage", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // KakaServer is the server API for Kaka service.
 // All implementations must embed UnimplementedKakaServer
 // for forward compatibility
 type KakaServer interface {
 	Debug(context.Context, *DebugRequest) (*DebugReply, error)
+	ListPushes(context.Context, *ListPushesRequest) (*ListPushesReply, error)
+	ListReaders(context.Context, *ListReadersRequest) (*ListReadersReply, error)
+	ListRecordings(context.Context, *ListRecordingsRequest) (*ListRecordingsReply, error)
+	GetStorage(context.Context, *GetStorageRequest) (*GetStorageReply, error)
 	mustEmbedUnimplementedKakaServer()
 }
 
@@ -57,6 +101,18 @@ type UnimplementedKakaServer struct {
 func (UnimplementedKakaServer) Debug(context.Context, *DebugRequest) (*DebugReply, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Debug not implemented")
 }
+func (UnimplementedKakaServer) ListPushes(context.Context, *ListPushesRequest) (*ListPushesReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListPushes not implemented")
+}
+func (UnimplementedKakaServer) ListReaders(context.Context, *ListReadersRequest) (*ListReadersReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListReaders not implemented")
+}
+func (UnimplementedKakaServer) ListRecordings(context.Context, *ListRecordingsRequest) (*ListRecordingsReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListRecordings not implemented")
+}
+func (UnimplementedKakaServer) GetStorage(context.Context, *GetStorageRequest) (*GetStorageReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStorage not implemented")
+}
 func (UnimplementedKakaServer) mustEmbedUnimplementedKakaServer() {}
 
 // UnsafeKakaServer may be embedded to opt out of forward compatibility for this service.
@@ -88,6 +144,78 @@ func _Kaka_Debug_Handler(srv interface{}, ctx context.Context, dec func(interfac
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Kaka_ListPushes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListPushesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KakaServer).ListPushes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.kaka.v1.Kaka/ListPushes",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KakaServer).ListPushes(ctx, req.(*ListPushesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Kaka_ListReaders_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListReadersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KakaServer).ListReaders(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.kaka.v1.Kaka/ListReaders",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KakaServer).ListReaders(ctx, req.(*ListReadersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Kaka_ListRecordings_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRecordingsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KakaServer).ListRecordings(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.kaka.v1.Kaka/ListRecordings",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KakaServer).ListRecordings(ctx, req.(*ListRecordingsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Kaka_GetStorage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStorageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KakaServer).GetStorage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/api.kaka.v1.Kaka/GetStorage",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KakaServer).GetStorage(ctx, req.(*GetStorageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Kaka_ServiceDesc is the grpc.ServiceDesc for Kaka service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -99,6 +227,22 @@ var Kaka_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Debug",
 			Handler:    _Kaka_Debug_Handler,
 		},
+		{
+			MethodName: "ListPushes",
+			Handler:    _Kaka_ListPushes_Handler,
+		},
+		{
+			MethodName: "ListReaders",
+			Handler:    _Kaka_ListReaders_Handler,
+		},
+		{
+			MethodName: "ListRecordings",
+			Handler:    _Kaka_ListRecordings_Handler,
+		},
+		{
+			MethodName: "GetStorage",
+			Handler:    _Kaka_GetStorage_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "kaka/v1/kaka.proto",
@@ -20,14 +20,26 @@ var _ = binding.EncodeURL
 const _ = http.SupportPackageIsVersion1
 
 const OperationKakaDebug = "/api.kaka.v1.Kaka/Debug"
+const OperationKakaListPushes = "/api.kaka.v1.Kaka/ListPushes"
+const OperationKakaListReaders = "/api.kaka.v1.Kaka/ListReaders"
+const OperationKakaListRecordings = "/api.kaka.v1.Kaka/ListRecordings"
+const OperationKakaGetStorage = "/api.kaka.v1.Kaka/GetStorage"
 
 type KakaHTTPServer interface {
 	Debug(context.Context, *DebugRequest) (*DebugReply, error)
+	ListPushes(context.Context, *ListPushesRequest) (*ListPushesReply, error)
+	ListReaders(context.Context, *ListReadersRequest) (*ListReadersReply, error)
+	ListRecordings(context.Context, *ListRecordingsRequest) (*ListRecordingsReply, error)
+	GetStorage(context.Context, *GetStorageRequest) (*GetStorageReply, error)
 }
 
 func RegisterKakaHTTPServer(s *http.Server, srv KakaHTTPServer) {
 	r := s.Route("/")
 	r.GET("/api/v1/debug", _Kaka_Debug0_HTTP_Handler(srv))
+	r.GET("/api/v1/pushes", _Kaka_ListPushes0_HTTP_Handler(srv))
+	r.GET("/api/v1/readers", _Kaka_ListReaders0_HTTP_Handler(srv))
+	r.GET("/api/v1/recordings", _Kaka_ListRecordings0_HTTP_Handler(srv))
+	r.GET("/api/v1/storage", _Kaka_GetStorage0_HTTP_Handler(srv))
 }
 
 func _Kaka_Debug0_HTTP_Handler(srv KakaHTTPServer) func(ctx http.Context) error {
@@ -49,8 +61,88 @@ func _Kaka_Debug0_HTTP_Handler(srv KakaHTTPServer) func(ctx http.Context) error
 	}
 }
 
+func _Kaka_ListPushes0_HTTP_Handler(srv KakaHTTPServer) func(ctx http.Context) error {
+	return func(ctx http.Context) error {
+		var in ListPushesRequest
+		if err := ctx.BindQuery(&in); err != nil {
+			return err
+		}
+		http.SetOperation(ctx, OperationKakaListPushes)
+		h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+			return srv.ListPushes(ctx, req.(*ListPushesRequest))
+		})
+		out, err := h(ctx, &in)
+		if err != nil {
+			return err
+		}
+		reply := out.(*ListPushesReply)
+		return ctx.Result(200, reply)
+	}
+}
+
+func _Kaka_ListReaders0_HTTP_Handler(srv KakaHTTPServer) func(ctx http.Context) error {
+	return func(ctx http.Context) error {
+		var in ListReadersRequest
+		if err := ctx.BindQuery(&in); err != nil {
+			return err
+		}
+		http.SetOperation(ctx, OperationKakaListReaders)
+		h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+			return srv.ListReaders(ctx, req.(*ListReadersRequest))
+		})
+		out, err := h(ctx, &in)
+		if err != nil {
+			return err
+		}
+		reply := out.(*ListReadersReply)
+		return ctx.Result(200, reply)
+	}
+}
+
+func _Kaka_ListRecordings0_HTTP_Handler(srv KakaHTTPServer) func(ctx http.Context) error {
+	return func(ctx http.Context) error {
+		var in ListRecordingsRequest
+		if err := ctx.BindQuery(&in); err != nil {
+			return err
+		}
+		http.SetOperation(ctx, OperationKakaListRecordings)
+		h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+			return srv.ListRecordings(ctx, req.(*ListRecordingsRequest))
+		})
+		out, err := h(ctx, &in)
+		if err != nil {
+			return err
+		}
+		reply := out.(*ListRecordingsReply)
+		return ctx.Result(200, reply)
+	}
+}
+
+func _Kaka_GetStorage0_HTTP_Handler(srv KakaHTTPServer) func(ctx http.Context) error {
+	return func(ctx http.Context) error {
+		var in GetStorageRequest
+		if err := ctx.BindQuery(&in); err != nil {
+			return err
+		}
+		http.SetOperation(ctx, OperationKakaGetStorage)
+		h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+			return srv.GetStorage(ctx, req.(*GetStorageRequest))
+		})
+		out, err := h(ctx, &in)
+		if err != nil {
+			return err
+		}
+		reply := out.(*GetStorageReply)
+		return ctx.Result(200, reply)
+	}
+}
+
 type KakaHTTPClient interface {
 	Debug(ctx context.Context, req *DebugRequest, opts ...http.CallOption) (rsp *DebugReply, err error)
+	ListPushes(ctx context.Context, req *ListPushesRequest, opts ...http.CallOption) (rsp *ListPushesReply, err error)
+	ListReaders(ctx context.Context, req *ListReadersRequest, opts ...http.CallOption) (rsp *ListReadersReply, err error)
+	ListRecordings(ctx context.Context, req *ListRecordingsRequest, opts ...http.CallOption) (rsp *ListRecordingsReply, err error)
+	GetStorage(ctx context.Context, req *GetStorageRequest, opts ...http.CallOption) (rsp *GetStorageReply, err error)
 }
 
 type KakaHTTPClientImpl struct {
@@ -73,3 +165,55 @@ func (c *KakaHTTPClientImpl) Debug(ctx context.Context, in *DebugRequest, opts .
 	}
 	return &out, err
 }
+
+func (c *KakaHTTPClientImpl) ListPushes(ctx context.Context, in *ListPushesRequest, opts ...http.CallOption) (*ListPushesReply, error) {
+	var out ListPushesReply
+	pattern := "/api/v1/pushes"
+	path := binding.EncodeURL(pattern, in, true)
+	opts = append(opts, http.Operation(OperationKakaListPushes))
+	opts = append(opts, http.PathTemplate(pattern))
+	err := c.cc.Invoke(ctx, "GET", path, nil, &out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &out, err
+}
+
+func (c *KakaHTTPClientImpl) ListReaders(ctx context.Context, in *ListReadersRequest, opts ...http.CallOption) (*ListReadersReply, error) {
+	var out ListReadersReply
+	pattern := "/api/v1/readers"
+	path := binding.EncodeURL(pattern, in, true)
+	opts = append(opts, http.Operation(OperationKakaListReaders))
+	opts = append(opts, http.PathTemplate(pattern))
+	err := c.cc.Invoke(ctx, "GET", path, nil, &out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &out, err
+}
+
+func (c *KakaHTTPClientImpl) ListRecordings(ctx context.Context, in *ListRecordingsRequest, opts ...http.CallOption) (*ListRecordingsReply, error) {
+	var out ListRecordingsReply
+	pattern := "/api/v1/recordings"
+	path := binding.EncodeURL(pattern, in, true)
+	opts = append(opts, http.Operation(OperationKakaListRecordings))
+	opts = append(opts, http.PathTemplate(pattern))
+	err := c.cc.Invoke(ctx, "GET", path, nil, &out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &out, err
+}
+
+func (c *KakaHTTPClientImpl) GetStorage(ctx context.Context, in *GetStorageRequest, opts ...http.CallOption) (*GetStorageReply, error) {
+	var out GetStorageReply
+	pattern := "/api/v1/storage"
+	path := binding.EncodeURL(pattern, in, true)
+	opts = append(opts, http.Operation(OperationKakaGetStorage))
+	opts = append(opts, http.PathTemplate(pattern))
+	err := c.cc.Invoke(ctx, "GET", path, nil, &out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &out, err
+}
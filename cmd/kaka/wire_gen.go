@@ -23,8 +23,11 @@ func wireApp(confServer *conf.Server, logger log.Logger) (*application.App, func
 	kakaUseCase := biz.NewKakaUseCase(logger, channelRepo)
 	kakaService := service.NewKakaService(logger, kakaUseCase)
 	grpcServer := server.NewGRPCServer(confServer, kakaService)
-	httpServer := server.NewHttpServer(confServer, kakaService)
-	rtspServer := server.NewRTSPServer(confServer, kakaService, logger)
+	rtspServer, err := server.NewRTSPServer(confServer, kakaService, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	httpServer := server.NewHttpServer(confServer, kakaService, rtspServer)
 	app := newApp(logger, grpcServer, httpServer, rtspServer)
 	return app, func() {
 	}, nil
@@ -4,6 +4,7 @@ import (
 	v1 "github.com/ChinasMr/kaka/api/kaka/v1"
 	"github.com/ChinasMr/kaka/internal/conf"
 	"github.com/ChinasMr/kaka/internal/service"
+	"github.com/ChinasMr/kaka/pkg/transport/rtsp"
 	"github.com/go-kratos/kratos/v2/transport/http"
 )
 
@@ -11,7 +12,7 @@ import (
 // need time to read and understand the source code of protoc-gen-go-http plugins.
 // still too young. struggle for !!!
 
-func NewHttpServer(c *conf.Server, kaka *service.KakaService) *http.Server {
+func NewHttpServer(c *conf.Server, kaka *service.KakaService, rs *rtsp.Server) *http.Server {
 	var opts []http.ServerOption
 	if c.Http.Network != "" {
 		opts = append(opts, http.Network(c.Http.Network))
@@ -24,5 +25,14 @@ func NewHttpServer(c *conf.Server, kaka *service.KakaService) *http.Server {
 	}
 	srv := http.NewServer(opts...)
 	v1.RegisterKakaHTTPServer(srv, kaka)
+	// download the recording of a channel in the time range as a single mp4 file.
+	srv.Handle("/api/v1/recordings/mp4", rs.RecordingHandler())
+	// stream it by hls, eg: /api/v1/recordings/hls/index.m3u8?channel=camera&start=...&end=...
+	srv.HandlePrefix("/api/v1/recordings/hls/", rs.RecordingHLSHandler())
+	// the disk usage of the recordings and the cleanups by the retention.
+	srv.Handle("/metrics", rs.MetricsHandler())
+	if c.Http.Websocket != "" {
+		srv.Handle(c.Http.Websocket, rs.WebSocketHandler())
+	}
 	return srv
 }
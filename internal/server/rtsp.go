@@ -1,13 +1,14 @@
 package server
 
 import (
+	"fmt"
 	"github.com/ChinasMr/kaka/internal/conf"
 	"github.com/ChinasMr/kaka/internal/service"
 	"github.com/ChinasMr/kaka/pkg/log"
 	"github.com/ChinasMr/kaka/pkg/transport/rtsp"
 )
 
-func NewRTSPServer(c *conf.Server, kaka *service.KakaService, logger log.Logger) *rtsp.Server {
+func NewRTSPServer(c *conf.Server, kaka *service.KakaService, logger log.Logger) (*rtsp.Server, error) {
 	var opts = []rtsp.ServerOption{
 		rtsp.WithChannel("live"),
 		rtsp.Logger(logger),
@@ -27,8 +28,64 @@ func NewRTSPServer(c *conf.Server, kaka *service.KakaService, logger log.Logger)
 	if c.Rtsp.Timeout != nil {
 		opts = append(opts, rtsp.Timeout(c.Rtsp.Timeout.AsDuration()))
 	}
+	if c.Rtsp.Multicast != nil && c.Rtsp.Multicast.Range != "" {
+		opts = append(opts, rtsp.Multicast(c.Rtsp.Multicast.Range,
+			int(c.Rtsp.Multicast.Port), int(c.Rtsp.Multicast.Ttl)))
+	}
+	if c.Rtsp.Ports != "" {
+		// the bounds of the range are checked by the server on start.
+		var min, max int
+		if _, err := fmt.Sscanf(c.Rtsp.Ports, "%d-%d", &min, &max); err != nil {
+			return nil, fmt.Errorf("invalid udp port range %q: %v", c.Rtsp.Ports, err)
+		}
+		opts = append(opts, rtsp.UDPPorts(min, max))
+	}
+	if c.Rtsp.Queue != nil {
+		opts = append(opts, rtsp.ReaderQueue(int(c.Rtsp.Queue.Size), c.Rtsp.Queue.Policy))
+	}
+	if c.Rtsp.Rewrite {
+		opts = append(opts, rtsp.RewriteRTP(true))
+	}
+	if c.Rtsp.Srtp {
+		opts = append(opts, rtsp.SRTP(true))
+	}
+	if c.Rtsp.Vod != "" {
+		opts = append(opts, rtsp.VOD(c.Rtsp.Vod))
+	}
+	if c.Rtsp.TimeShift != nil && c.Rtsp.TimeShift.Window != nil {
+		opts = append(opts, rtsp.TimeShift(c.Rtsp.TimeShift.Window.AsDuration(), int(c.Rtsp.TimeShift.Size)))
+	}
+	for _, r := range c.Rtsp.Retention {
+		opts = append(opts, rtsp.RecordRetention(r.Channel, r.MaxAge.AsDuration(), int64(r.MaxSize)))
+	}
+	if c.Rtsp.DiskFloor > 0 {
+		opts = append(opts, rtsp.DiskFloor(c.Rtsp.DiskFloor))
+	}
+	for _, w := range c.Rtsp.Webhooks {
+		opts = append(opts, rtsp.Webhook(w.Url, w.Secret, w.Timeout.AsDuration(), int(w.Retries)))
+	}
+	if c.Rtsp.JitterBuffer != nil {
+		opts = append(opts, rtsp.JitterBuffer(c.Rtsp.JitterBuffer.AsDuration()))
+	}
+	if c.Rtsp.Retransmission != nil {
+		opts = append(opts, rtsp.Retransmission(int(c.Rtsp.Retransmission.Size), c.Rtsp.Retransmission.Rtx))
+	}
+	for _, ch := range c.Rtsp.Channels {
+		for _, target := range ch.Push {
+			opts = append(opts, rtsp.WithPush(ch.Name, target))
+		}
+		if len(ch.Backups) > 0 {
+			opts = append(opts, rtsp.WithFailover(ch.Name, ch.Failover.AsDuration(), ch.Backups...))
+		}
+		if ch.Source != "" {
+			opts = append(opts, rtsp.WithPullChannel(ch.Name, ch.Source, ch.OnDemand))
+			continue
+		}
+		opts = append(opts, rtsp.WithChannel(ch.Name))
+	}
 
 	srv := rtsp.NewServer(opts...)
+	kaka.BindRTSP(srv)
 	//srv.RegisterHandler(methods.ANNOUNCE, kaka.ANNOUNCE)
-	return srv
+	return srv, nil
 }
@@ -7,13 +7,15 @@ import (
 	"github.com/ChinasMr/kaka/pkg/log"
 	"github.com/ChinasMr/kaka/pkg/transport/rtsp"
 	"github.com/ChinasMr/kaka/pkg/transport/rtsp/status"
+	"time"
 )
 
 type KakaService struct {
 	pb.UnimplementedKakaServer
 	rtsp.UnimplementedServerHandler
-	uc  *biz.KakaUseCase
-	log *log.Helper
+	uc   *biz.KakaUseCase
+	log  *log.Helper
+	rtsp *rtsp.Server
 }
 
 func NewKakaService(logger log.Logger, useCase *biz.KakaUseCase) *KakaService {
@@ -23,6 +25,116 @@ func NewKakaService(logger log.Logger, useCase *biz.KakaUseCase) *KakaService {
 	}
 }
 
+// BindRTSP bind the rtsp server whose state is reported by the api.
+func (s *KakaService) BindRTSP(srv *rtsp.Server) {
+	s.rtsp = srv
+}
+
+func (s *KakaService) ListPushes(_ context.Context, _ *pb.ListPushesRequest) (*pb.ListPushesReply, error) {
+	if s.rtsp == nil {
+		return &pb.ListPushesReply{}, nil
+	}
+	pushes := s.rtsp.PushStatus()
+	rv := make([]*pb.Push, 0, len(pushes))
+	for _, p := range pushes {
+		rv = append(rv, &pb.Push{
+			Channel: p.Channel,
+			Target:  p.Target,
+			Status:  p.State,
+			Error:   p.Error,
+			Retries: p.Retries,
+			Packets: p.Packets,
+			Since:   p.Since.Unix(),
+			Dropped: p.Dropped,
+		})
+	}
+	return &pb.ListPushesReply{
+		Pushes: rv,
+	}, nil
+}
+
+func (s *KakaService) ListReaders(_ context.Context, _ *pb.ListReadersRequest) (*pb.ListReadersReply, error) {
+	if s.rtsp == nil {
+		return &pb.ListReadersReply{}, nil
+	}
+	readers := s.rtsp.ReaderStatus()
+	rv := make([]*pb.Reader, 0, len(readers))
+	for _, r := range readers {
+		rv = append(rv, &pb.Reader{
+			Channel: r.Channel,
+			Session: r.Session,
+			Ip:      r.IP,
+			Queued:  uint32(r.Queued),
+			Sent:    r.Sent,
+			Dropped: r.Dropped,
+			Resent:  r.Resent,
+		})
+	}
+	return &pb.ListReadersReply{
+		Readers: rv,
+	}, nil
+}
+
+func (s *KakaService) ListRecordings(_ context.Context, req *pb.ListRecordingsRequest) (*pb.ListRecordingsReply, error) {
+	if s.rtsp == nil {
+		return &pb.ListRecordingsReply{}, nil
+	}
+	var from, to time.Time
+	if req.Start > 0 {
+		from = time.Unix(req.Start, 0)
+	}
+	if req.End > 0 {
+		to = time.Unix(req.End, 0)
+	}
+	segments := s.rtsp.Recordings(req.Channel, from, to)
+	rv := make([]*pb.Recording, 0, len(segments))
+	for _, seg := range segments {
+		rv = append(rv, &pb.Recording{
+			Channel: seg.Channel,
+			Path:    seg.Path,
+			Start:   seg.Start.Unix(),
+			End:     seg.End.Unix(),
+			Size:    seg.Size,
+		})
+	}
+	return &pb.ListRecordingsReply{
+		Recordings: rv,
+	}, nil
+}
+
+func (s *KakaService) GetStorage(_ context.Context, _ *pb.GetStorageRequest) (*pb.GetStorageReply, error) {
+	if s.rtsp == nil {
+		return &pb.GetStorageReply{}, nil
+	}
+	st := s.rtsp.StorageStatus()
+	channels := make([]*pb.ChannelStorage, 0, len(st.Channels))
+	for _, cs := range st.Channels {
+		channels = append(channels, &pb.ChannelStorage{
+			Channel:      cs.Channel,
+			Segments:     uint32(cs.Segments),
+			Bytes:        cs.Bytes,
+			Deleted:      cs.Deleted,
+			DeletedBytes: cs.DeletedBytes,
+		})
+	}
+	events := make([]*pb.CleanupEvent, 0, len(st.Events))
+	for _, e := range st.Events {
+		events = append(events, &pb.CleanupEvent{
+			Time:    e.Time.Unix(),
+			Channel: e.Channel,
+			Path:    e.Path,
+			Size:    e.Size,
+			Reason:  e.Reason,
+		})
+	}
+	return &pb.GetStorageReply{
+		Channels: channels,
+		Free:     st.Free,
+		Total:    st.Total,
+		Events:   events,
+	}, nil
+}
+
 func (s *KakaService) Debug(ctx context.Context, _ *pb.DebugRequest) (*pb.DebugReply, error) {
 	//s.log.Debugf("debug request incoming!")
 	//channels, err := s.uc.ListChannels(ctx)
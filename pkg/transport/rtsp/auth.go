@@ -0,0 +1,108 @@
+package rtsp
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/ChinasMr/kaka/pkg/transport/rtsp/methods"
+	"net/url"
+	"strings"
+)
+
+// authenticator answers the WWW-Authenticate challenge of a server.
+// Basic and Digest(MD5) schemes are supported.
+type authenticator struct {
+	user   *url.Userinfo
+	digest bool
+	realm  string
+	nonce  string
+	opaque string
+}
+
+func newAuthenticator(user *url.Userinfo, challenges []string) (*authenticator, error) {
+	var basic *authenticator
+	for _, c := range challenges {
+		scheme, params, _ := strings.Cut(strings.TrimSpace(c), " ")
+		switch strings.ToLower(scheme) {
+		case "digest":
+			kv := parseAuthParams(params)
+			algorithm := kv["algorithm"]
+			if algorithm != "" && !strings.EqualFold(algorithm, "MD5") {
+				continue
+			}
+			// digest is preferred.
+			return &authenticator{
+				user:   user,
+				digest: true,
+				realm:  kv["realm"],
+				nonce:  kv["nonce"],
+				opaque: kv["opaque"],
+			}, nil
+		case "basic":
+			basic = &authenticator{
+				user:  user,
+				realm: parseAuthParams(params)["realm"],
+			}
+		}
+	}
+	if basic != nil {
+		return basic, nil
+	}
+	return nil, fmt.Errorf("unsupported authenticate challenge: %v", challenges)
+}
+
+// Authorization returns the value of the Authorization header.
+func (a *authenticator) Authorization(method methods.Method, u *url.URL) string {
+	username := a.user.Username()
+	password, _ := a.user.Password()
+	if !a.digest {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+	}
+	uri := *u
+	uri.User = nil
+	ha1 := md5Hex(fmt.Sprintf("%s:%s:%s", username, a.realm, password))
+	ha2 := md5Hex(fmt.Sprintf("%s:%s", method, uri.String()))
+	response := md5Hex(fmt.Sprintf("%s:%s:%s", ha1, a.nonce, ha2))
+	params := []string{
+		fmt.Sprintf("username=%q", username),
+		fmt.Sprintf("realm=%q", a.realm),
+		fmt.Sprintf("nonce=%q", a.nonce),
+		fmt.Sprintf("uri=%q", uri.String()),
+		fmt.Sprintf("response=%q", response),
+	}
+	if a.opaque != "" {
+		params = append(params, fmt.Sprintf("opaque=%q", a.opaque))
+	}
+	return "Digest " + strings.Join(params, ", ")
+}
+
+// parse the auth-params like: realm="kaka", nonce="abc".
+func parseAuthParams(raw string) map[string]string {
+	rv := map[string]string{}
+	for len(raw) > 0 {
+		raw = strings.TrimLeft(raw, " ,")
+		k, rest, ok := strings.Cut(raw, "=")
+		if !ok {
+			break
+		}
+		var v string
+		if strings.HasPrefix(rest, "\"") {
+			end := strings.Index(rest[1:], "\"")
+			if end == -1 {
+				v, raw = rest[1:], ""
+			} else {
+				v, raw = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			v, raw, _ = strings.Cut(rest, ",")
+		}
+		rv[strings.ToLower(strings.TrimSpace(k))] = strings.TrimSpace(v)
+	}
+	return rv
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,10 +1,16 @@
 package rtsp
 
 import (
+	"context"
+	"encoding/binary"
+	"github.com/ChinasMr/kaka/pkg/log"
+	"github.com/ChinasMr/kaka/pkg/transport/rtsp/header"
 	"github.com/ChinasMr/kaka/pkg/transport/rtsp/status"
 	"gortc.io/sdp"
-	"io"
+	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 var _ Channel = (*channel)(nil)
@@ -13,36 +19,123 @@ type Channel interface {
 	SetSDP(tx Transaction, sdp *sdp.Message, raw []byte) bool
 	SDP() *sdp.Message
 	Raw() []byte
+	// SourceSDP returns the description announced by the source, it differs
+	// from SDP when a backup of the channel is active or the offer is rewritten.
+	SourceSDP() *sdp.Message
 	Lock(tx Transaction) bool
 	Source() Transaction
 	Input() chan *Package
 	Play(tx Transaction) error
 	Record(tx Transaction) error
 	Teardown(tx Transaction) error
+	// Pull make sure the pulled source is running and its description is ready,
+	// it returns immediately if the channel is not sourced by a pull url.
+	Pull(ctx context.Context) error
+	// Multicast returns the multicast group of the nth media,
+	// the group is allocated from the pool on the first call.
+	Multicast(order int, pool *multicastPool) (*net.UDPAddr, error)
+	// Readers returns the status of the reader queues.
+	Readers() []ReaderStatus
+	// RTPInfo returns the sequence number and rtp timestamp of the first
+	// package the reader receives by the order of the media.
+	RTPInfo(tx Transaction) map[int]RTPInfo
+	// TimeShift start the reader from the keyframe buffered at the time and play
+	// at the rate until it catches up to the live, it returns the time of the first
+	// package played, false if the channel buffers nothing from the time.
+	TimeShift(tx Transaction, at time.Time, rate float64) (time.Time, bool)
+	// ShiftWindow returns how long the channel buffers for the time-shift, 0 if disabled.
+	ShiftWindow() time.Duration
+}
+
+// ReaderStatus is the status of the queue of a reader.
+type ReaderStatus struct {
+	Channel string
+	Session string
+	IP      string
+	Queued  int
+	Sent    uint64
+	Dropped uint64
+	// the packages resent by the nack of the reader.
+	Resent uint64
+}
+
+type channelConfig struct {
+	queue queueConfig
+	// rewrite the rtp packages of every reader.
+	rewrite bool
+	// offer the nack feedback and rtx for the retransmission in the description.
+	nack bool
+	rtx  bool
+	// the latency of the jitter buffer of the udp sources, disabled if 0.
+	latency time.Duration
+	// buffer the packages for the time-shift, disabled if the window is 0.
+	dvr dvrConfig
+	// the webhooks the events of the channel are posted to, nil if disabled.
+	hooks *webhooks
+}
+
+var defaultChannelConfig = channelConfig{
+	queue: defaultQueueConfig,
 }
 
 func NewChannel(ch string) Channel {
+	return newChannel(ch, defaultChannelConfig)
+}
+
+func newChannel(ch string, cc channelConfig) *channel {
 	rv := &channel{
-		name:   ch,
-		txs:    map[string]Transaction{},
-		rwm:    sync.RWMutex{},
-		sdp:    &sdp.Message{},
-		raw:    nil,
-		source: nil,
-		input:  make(chan *Package, 2),
+		name:      ch,
+		txs:       map[string]Transaction{},
+		rwm:       sync.RWMutex{},
+		sdp:       &sdp.Message{},
+		raw:       nil,
+		source:    nil,
+		input:     make(chan *Package, 2),
+		relayed:   make(chan *Package, 2),
+		cc:        cc,
+		queues:    map[string]*packageQueue{},
+		rewriters: map[string]*readerRewriter{},
+		last:      map[int]RTPInfo{},
+		shifts:    map[string]*dvrCursor{},
+	}
+	if cc.dvr.window > 0 {
+		rv.dvr = newDVRBuffer(cc.dvr)
 	}
 	go rv.serve()
 	return rv
 }
 
 type channel struct {
-	name   string
-	txs    map[string]Transaction
-	rwm    sync.RWMutex
-	sdp    *sdp.Message
-	raw    []byte
-	source Transaction
-	input  chan *Package
+	name      string
+	txs       map[string]Transaction
+	rwm       sync.RWMutex
+	sdp       *sdp.Message
+	raw       []byte
+	source    Transaction
+	input     chan *Package
+	relayed   chan *Package
+	pull      *puller
+	pushes    []*pusher
+	mpool     *multicastPool
+	groups    map[int]*net.UDPAddr
+	cc        channelConfig
+	queues    map[string]*packageQueue
+	codecs    map[int]string
+	clocks    map[int]uint32
+	gen       uint32
+	rewriters map[string]*readerRewriter
+	lm        sync.Mutex
+	last      map[int]RTPInfo
+	// the description as the source announced, with its own keys.
+	announced *sdp.Message
+	// the failover of the channel with backups.
+	fo *failover
+	// the failover the channel is a backup of, and its priority.
+	backup *failover
+	rank   int
+	// the time-shift buffer, and the readers playing it.
+	dvr    *dvrBuffer
+	shifts map[string]*dvrCursor
 }
 
 func (c *channel) Input() chan *Package {
@@ -55,16 +148,66 @@ func (c *channel) Source() Transaction {
 	return c.source
 }
 
+func (c *channel) Pull(ctx context.Context) error {
+	if c.pull == nil {
+		return nil
+	}
+	return c.pull.demand(ctx)
+}
+
+func (c *channel) Multicast(order int, pool *multicastPool) (*net.UDPAddr, error) {
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+	if group, ok := c.groups[order]; ok {
+		return group, nil
+	}
+	group, err := pool.alloc()
+	if err != nil {
+		return nil, err
+	}
+	if c.groups == nil {
+		c.groups = map[int]*net.UDPAddr{}
+	}
+	c.mpool = pool
+	c.groups[order] = group
+	return group, nil
+}
+
+// send the package once to the multicast group.
+func (c *channel) multicast(p *Package) {
+	order, rtcp := p.media()
+	c.rwm.RLock()
+	group, ok := c.groups[order]
+	pool := c.mpool
+	c.rwm.RUnlock()
+	if !ok {
+		return
+	}
+	_ = pool.send(p.Data[:p.Len], group, rtcp)
+}
+
+func (c *channel) readers() int {
+	c.rwm.RLock()
+	defer c.rwm.RUnlock()
+	return len(c.txs)
+}
+
 func (c *channel) Teardown(tx Transaction) error {
 	if tx.Status() == status.PLAYING {
-		delete(c.txs, tx.ID())
+		c.removeReader(tx)
 		return nil
 	}
 	if tx.Status() == status.RECORDING {
+		// the session is torn down on every channel, the ones it
+		// did not publish are locked by it only to be reset.
+		published := c.Source() == tx
 		ok := c.Lock(tx)
 		if ok {
 			// the register wanna to deregister the info.
 			c.reset()
+			if published {
+				c.notify(EventUnpublish, tx)
+			}
 		}
 	}
 	// clear the status. avoid clear twice.
@@ -73,43 +216,166 @@ func (c *channel) Teardown(tx Transaction) error {
 }
 
 func (c *channel) Record(tx Transaction) error {
+	c.online()
+	c.notify(EventPublish, tx)
 	if tx.Interleaved() {
-		for {
-			p := newPackage()
-			ch, l, err := tx.ReadInterleavedFrame(p.Data)
-			if err != nil {
-				return err
-			}
-			p.Len = l
-			p.Ch = ch
-			p.Interleaved = true
-			c.input <- p
+		return c.receive(tx)
+	}
+	// the medias on their own ports feed the channel directly.
+	for _, m := range tx.Medias() {
+		if m.pair != nil {
+			m.pair.setOutput(m.order, c.input, c.cc.latency)
 		}
-	} else {
-		return nil
+	}
+	return nil
+}
+
+// receive read the interleaved packages of the source until a request is in between,
+// the connection goes on being read after the request.
+func (c *channel) receive(tx Transaction) error {
+	for {
+		p, err := tx.ReadInterleavedPackage()
+		if err != nil {
+			return err
+		}
+		if !tx.Unprotect(p) {
+			putPackage(p)
+			continue
+		}
+		c.input <- p
 	}
 }
 
 func (c *channel) Play(tx Transaction) error {
 	// add the tx to the channel.
+	c.rwm.Lock()
+	_, joined := c.txs[tx.ID()]
 	c.txs[tx.ID()] = tx
-
-	if tx.Interleaved() {
-		// blocking the connection.
-		buf := make([]byte, 2048)
-		for {
-			_, err := tx.Read(buf)
-			if err != nil {
-				// delete the tx to the channel.
-				delete(c.txs, tx.ID())
-				return io.EOF
+	cur, shifted := c.shifts[tx.ID()]
+	_, live := c.queues[tx.ID()]
+	// the multicast readers are served by the channel once.
+	if !live && !(shifted && cur.queue != nil) && !tx.Multicast() {
+		write := tx.Forward
+		if c.cc.rewrite {
+			rw, has := c.rewriters[tx.ID()]
+			if !has {
+				rw = newReaderRewriter(c.clocks, c.clock)
+				c.rewriters[tx.ID()] = rw
 			}
+			write = func(p *Package) error {
+				return rw.forward(tx, p)
+			}
+		}
+		q := newPackageQueue(c.cc.queue, write, func() {
+			log.Infof("disconnect the slow reader %s of channel %s", tx.ID(), c.name)
+			_ = tx.Close()
+		})
+		// the time-shifted reader joins the live queues after the replay.
+		if shifted {
+			cur.queue = q
+			go c.replay(tx.ID(), cur)
+		} else {
+			c.queues[tx.ID()] = q
 		}
 	}
+	c.rwm.Unlock()
+	c.readersChanged()
+	// the reader playing again after PAUSE or by another Range joined already.
+	if !joined {
+		c.notify(EventPlay, tx)
+	}
+	// the interleaved reader goes on sending the requests on the connection,
+	// it is removed by the teardown of the session when disconnected.
 	return nil
 }
 
+func (c *channel) removeReader(tx Transaction) {
+	c.rwm.Lock()
+	_, joined := c.txs[tx.ID()]
+	delete(c.txs, tx.ID())
+	delete(c.rewriters, tx.ID())
+	c.rwm.Unlock()
+	c.stopQueue(tx.ID())
+	c.readersChanged()
+	// the reader torn down is removed again when the session is deleted.
+	if joined {
+		c.notify(EventStop, tx)
+	}
+}
+
+// stopQueue close the queue of the reader, either live or replaying the buffer.
+func (c *channel) stopQueue(id string) {
+	c.rwm.Lock()
+	q, ok := c.queues[id]
+	delete(c.queues, id)
+	cur, shifted := c.shifts[id]
+	delete(c.shifts, id)
+	c.rwm.Unlock()
+	if shifted && cur.queue != nil {
+		close(cur.stop)
+		<-cur.done
+		q, ok = cur.queue, true
+	}
+	// the writer must not use the transaction after removed.
+	if ok {
+		q.close()
+		q.wait()
+	}
+}
+
+func (c *channel) TimeShift(tx Transaction, at time.Time, rate float64) (time.Time, bool) {
+	if c.dvr == nil || tx.Multicast() {
+		return time.Time{}, false
+	}
+	next, start, ok := c.dvr.seek(at)
+	if !ok {
+		return time.Time{}, false
+	}
+	// the reader playing already restarts from the past.
+	c.stopQueue(tx.ID())
+	cur := &dvrCursor{
+		next:  next,
+		start: start,
+		rate:  rate,
+		info:  c.dvr.info(next, len(c.SDP().Medias)),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	c.rwm.Lock()
+	c.shifts[tx.ID()] = cur
+	c.rwm.Unlock()
+	return start, true
+}
+
+func (c *channel) ShiftWindow() time.Duration {
+	if c.dvr == nil {
+		return 0
+	}
+	return c.dvr.window
+}
+
+// online start relaying when the channel gets a source.
+func (c *channel) online() {
+	for _, p := range c.pushes {
+		p.start()
+	}
+}
+
+func (c *channel) offline() {
+	for _, p := range c.pushes {
+		p.stop()
+	}
+}
+
+func (c *channel) readersChanged() {
+	if c.pull != nil {
+		c.pull.readersChanged(c.readers())
+	}
+}
+
 func (c *channel) Raw() []byte {
+	c.rwm.RLock()
+	defer c.rwm.RUnlock()
 	return c.raw
 }
 
@@ -118,32 +384,199 @@ func (c *channel) serve() {
 		select {
 		// receive data packet.
 		case p := <-c.input:
-			pack := p
-			wg := &sync.WaitGroup{}
-			for _, tx := range c.txs {
-				if tx.Status() == status.PLAYING {
-					wg.Add(1)
-					go tx.Forward(pack, wg)
+			// the primary is not active.
+			if c.fo != nil && !c.fo.receive(0) {
+				putPackage(p)
+				continue
+			}
+			c.deliver(p)
+		case p := <-c.relayed:
+			c.deliver(p)
+		}
+	}
+}
+
+// deliver the package to the readers, the multicast groups and the pushers.
+func (c *channel) deliver(p *Package) {
+	c.mark(p)
+	// the package is released by the queues after written.
+	p.refs = 1
+	multicast := false
+	c.rwm.RLock()
+	if c.dvr != nil {
+		c.dvr.push(p, time.Now())
+	}
+	for id, tx := range c.txs {
+		if tx.Status() == status.PLAYING {
+			if tx.Multicast() {
+				multicast = true
+				continue
+			}
+			if q, ok := c.queues[id]; ok {
+				q.push(p)
+			}
+		}
+	}
+	c.rwm.RUnlock()
+	if multicast {
+		c.multicast(p)
+	}
+	for _, pusher := range c.pushes {
+		pusher.forward(p)
+	}
+	if c.backup != nil {
+		c.backup.relay(c.rank, p)
+	}
+	p.release()
+	// todo refresh the live keeper.
+}
+
+// mark the video keyframes for the slow reader policy,
+// and the source generation for the rewriters.
+func (c *channel) mark(p *Package) {
+	order, rtcp := p.media()
+	if rtcp {
+		return
+	}
+	c.rwm.RLock()
+	codec, ok := c.codecs[order]
+	p.gen = c.gen
+	c.rwm.RUnlock()
+	if p.Len >= 12 {
+		c.lm.Lock()
+		c.last[order] = RTPInfo{
+			Seq:     binary.BigEndian.Uint16(p.Data[2:]),
+			RTPTime: binary.BigEndian.Uint32(p.Data[4:]),
+		}
+		c.lm.Unlock()
+	}
+	if !ok {
+		return
+	}
+	p.video = true
+	p.key = keyframe(codec, p.Data[:p.Len])
+}
+
+// clock returns the clock rate of the media of the current source.
+func (c *channel) clock(order int) (uint32, bool) {
+	c.rwm.RLock()
+	defer c.rwm.RUnlock()
+	rate, ok := c.clocks[order]
+	return rate, ok
+}
+
+func (c *channel) RTPInfo(tx Transaction) map[int]RTPInfo {
+	c.rwm.Lock()
+	defer c.rwm.Unlock()
+	if c.cc.rewrite && !tx.Multicast() {
+		rw, ok := c.rewriters[tx.ID()]
+		if !ok {
+			rw = newReaderRewriter(c.clocks, c.clock)
+			c.rewriters[tx.ID()] = rw
+		}
+		return rw.info()
+	}
+	if cur, ok := c.shifts[tx.ID()]; ok {
+		return cur.info
+	}
+	// the next package of the source.
+	c.lm.Lock()
+	defer c.lm.Unlock()
+	rv := make(map[int]RTPInfo, len(c.last))
+	for order, info := range c.last {
+		rv[order] = RTPInfo{
+			Seq:     info.Seq + 1,
+			RTPTime: info.RTPTime,
+		}
+	}
+	return rv
+}
+
+func (c *channel) Readers() []ReaderStatus {
+	c.rwm.RLock()
+	defer c.rwm.RUnlock()
+	queues := make(map[string]*packageQueue, len(c.queues)+len(c.shifts))
+	for id, q := range c.queues {
+		queues[id] = q
+	}
+	for id, cur := range c.shifts {
+		if cur.queue != nil {
+			queues[id] = cur.queue
+		}
+	}
+	rv := make([]ReaderStatus, 0, len(queues))
+	for id, q := range queues {
+		queued, sent, dropped := q.stats()
+		rs := ReaderStatus{
+			Channel: c.name,
+			Session: id,
+			Queued:  queued,
+			Sent:    sent,
+			Dropped: dropped,
+		}
+		if tx, ok := c.txs[id]; ok {
+			rs.IP = tx.IP().String()
+			for _, m := range tx.Medias() {
+				if m.nack != nil {
+					rs.Resent += atomic.LoadUint64(&m.nack.resent)
 				}
 			}
-			go func() {
-				wg.Wait()
-				putPackage(pack)
-				// todo refresh the live keeper.
-			}()
 		}
+		rv = append(rv, rs)
 	}
+	return rv
 }
 
 func (c *channel) reset() {
+	c.rwm.Lock()
+	c.source = nil
+	c.rwm.Unlock()
+	if c.backup != nil {
+		defer c.backup.lost(c.rank)
+	}
+	// a backup takes over the channel.
+	if c.fo != nil && c.fo.lost(0) {
+		return
+	}
 	c.rwm.Lock()
 	c.sdp = &sdp.Message{}
+	c.announced = nil
 	c.raw = nil
-	c.source = nil
+	c.codecs = nil
+	c.clocks = nil
+	// the buffered packages are not decodable by the next source.
+	if c.dvr != nil {
+		c.dvr.clear()
+	}
+	// the groups are kept for the remaining readers.
+	if len(c.txs) == 0 {
+		for order, group := range c.groups {
+			c.mpool.free(group)
+			delete(c.groups, order)
+		}
+	}
+	readers := make(map[string]Transaction, len(c.txs))
+	for id, tx := range c.txs {
+		readers[id] = tx
+	}
 	c.rwm.Unlock()
+	c.offline()
+	// the rtsp 2.0 readers are notified the stream ends,
+	// unless the pooled transaction is reused by another session.
+	go func() {
+		for id, tx := range readers {
+			if tx.ID() == id {
+				_ = tx.Notify(header.NotifyEndOfStream, nil)
+			}
+		}
+	}()
 }
 
 func (c *channel) Lock(tx Transaction) bool {
+	// the pulled channel can not be published.
+	if c.pull != nil {
+		return false
+	}
 	c.rwm.Lock()
 	defer c.rwm.Unlock()
 	if c.source == nil {
@@ -168,11 +601,58 @@ func (c *channel) SetSDP(tx Transaction, sdp *sdp.Message, raw []byte) bool {
 	if !ok {
 		return false
 	}
+	c.setDescription(sdp, raw)
+	return true
+	// A server MAY refuse to change parameters of an existing stream.
+	// todo they maybe a call back function.
+}
+
+func (c *channel) SourceSDP() *sdp.Message {
+	if c.fo != nil {
+		return c.fo.sourceSDP()
+	}
+	c.rwm.RLock()
+	defer c.rwm.RUnlock()
+	if c.announced == nil {
+		return c.sdp
+	}
+	return c.announced
+}
+
+func (c *channel) setDescription(sdp *sdp.Message, raw []byte) {
+	// the description of the primary is applied once it is active.
+	if c.fo != nil && !c.fo.described(sdp, raw) {
+		return
+	}
+	c.rwm.Lock()
+	c.announced = sdp
+	c.rwm.Unlock()
+	c.describe(sdp, raw)
+}
+
+// describe apply the description of the active source.
+func (c *channel) describe(sdp *sdp.Message, raw []byte) {
+	// the keys of the publisher are never offered to the readers.
+	offer, changed := stripKeys(raw)
+	if c.cc.nack {
+		offer, changed = offerNACK(offer), true
+	}
+	if c.cc.rtx {
+		offer, changed = offerRTX(offer), true
+	}
+	if changed {
+		if desc, err := decodeSDP(offer); err == nil {
+			sdp, raw = desc, offer
+		}
+	}
 	c.rwm.Lock()
 	c.sdp = sdp
 	c.raw = raw
+	c.codecs = videoCodecs(sdp)
+	c.clocks = clockRates(sdp)
+	c.gen++
 	c.rwm.Unlock()
-	return true
-	// A server MAY refuse to change parameters of an existing stream.
-	// todo they maybe a call back function.
+	c.lm.Lock()
+	c.last = map[int]RTPInfo{}
+	c.lm.Unlock()
 }
@@ -0,0 +1,676 @@
+package rtsp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/ChinasMr/kaka/pkg/log"
+	"github.com/ChinasMr/kaka/pkg/transport/rtsp/header"
+	"github.com/ChinasMr/kaka/pkg/transport/rtsp/methods"
+	"gortc.io/sdp"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultPort = "554"
+
+// Client is a rtsp client that pulls the stream from a remote server.
+// The media can be transported by udp or interleaved on the tcp connection,
+// received packages are read by ReadPackage.
+type Client struct {
+	timeout      time.Duration
+	keepAlive    time.Duration
+	interleaved  bool
+	rtcpMux      bool
+	maxRedirects int
+	userAgent    string
+	log          *log.Helper
+
+	mu             sync.Mutex
+	url            *url.URL
+	base           *url.URL
+	user           *url.Userinfo
+	auth           *authenticator
+	cc             *clientConn
+	cSeq           uint64
+	session        string
+	sessionTimeout time.Duration
+	medias         []*clientMedia
+	packets        chan *Package
+	done           chan struct{}
+	closeOnce      sync.Once
+	err            error
+}
+
+// a single tcp connection to the server,
+// it would be replaced when the server redirects.
+type clientConn struct {
+	conn      net.Conn
+	br        *bufio.Reader
+	wm        sync.Mutex
+	wbuf      []byte
+	rhdr      [4]byte
+	responses chan *response
+	done      chan struct{}
+	err       error
+}
+
+type clientMedia struct {
+	control  string
+	order    int
+	rtp      int
+	rtcp     int
+	rtpConn  *net.UDPConn
+	rtcpConn *net.UDPConn
+	rtpAddr  *net.UDPAddr
+	rtcpAddr *net.UDPAddr
+	// the rtcp is muxed on the rtp port.
+	mux bool
+}
+
+func NewClient(opts ...ClientOption) *Client {
+	c := &Client{
+		timeout:        10 * time.Second,
+		interleaved:    true,
+		maxRedirects:   3,
+		userAgent:      "kaka",
+		log:            log.NewHelper(log.DefaultLogger),
+		sessionTimeout: 60 * time.Second,
+		packets:        make(chan *Package, 64),
+		done:           make(chan struct{}),
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+// Dial connect to the rtsp server of the url,
+// the credentials in the url are used to authenticate.
+func (c *Client) Dial(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "rtsp" {
+		return fmt.Errorf("unsupported scheme: %s", u.Scheme)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.dial(ctx, u)
+}
+
+func (c *Client) dial(ctx context.Context, u *url.URL) error {
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), defaultPort)
+	}
+	d := net.Dialer{Timeout: c.timeout}
+	conn, err := d.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return err
+	}
+	// the client may be closed while dialing.
+	select {
+	case <-c.done:
+		_ = conn.Close()
+		return c.err
+	default:
+	}
+	if c.cc != nil {
+		c.cc.close(io.EOF)
+	}
+	if u.User != nil {
+		c.user = u.User
+		c.auth = nil
+	}
+	c.url = u
+	c.base = u
+	c.cc = &clientConn{
+		conn:      conn,
+		br:        bufio.NewReader(conn),
+		responses: make(chan *response, 8),
+		done:      make(chan struct{}),
+	}
+	go c.read(c.cc)
+	return nil
+}
+
+// URL returns the current url of the presentation,
+// it is changed if the server redirects.
+func (c *Client) URL() *url.URL {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.url
+}
+
+func (c *Client) Options() (Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.do(newRequest(methods.OPTIONS, c.url), true)
+}
+
+// Describe returns the session description and its raw content.
+func (c *Client) Describe() (*sdp.Message, []byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	req := newRequest(methods.DESCRIBE, c.url)
+	req.setHeader(header.Accept, header.ContentTypeSDP)
+	res, err := c.do(req, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ct, _ := res.Header(header.ContentType); len(ct) == 0 || ct[0] != header.ContentTypeSDP {
+		return nil, nil, fmt.Errorf("unsupported presentation description format: %v", ct)
+	}
+	if cb, ok := res.Header(header.ContentBase); ok && len(cb) > 0 {
+		base, err1 := url.Parse(cb[0])
+		if err1 == nil {
+			c.base = base
+		}
+	}
+	msg, err := decodeSDP(res.Body())
+	if err != nil {
+		return nil, nil, err
+	}
+	return msg, res.Body(), nil
+}
+
+// Announce the presentation description to the server before recording.
+func (c *Client) Announce(raw []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	req := newRequest(methods.ANNOUNCE, c.url)
+	req.setHeader(header.ContentType, header.ContentTypeSDP)
+	req.body = raw
+	_, err := c.do(req, true)
+	return err
+}
+
+// Setup the stream identified by the control attribute of the media.
+func (c *Client) Setup(control string, record bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m := &clientMedia{
+		control: control,
+		order:   len(c.medias),
+	}
+	params := []string{header.ParamUnicast}
+	if c.interleaved {
+		m.rtp, m.rtcp = 2*m.order, 2*m.order+1
+		params = append(params, header.NewInterleavedParam(m.rtp, m.rtcp))
+	} else {
+		var err error
+		// the muxed media receives the rtcp on the single rtp port.
+		if c.rtcpMux {
+			m.rtpConn, err = net.ListenUDP("udp", &net.UDPAddr{})
+		} else {
+			m.rtpConn, m.rtcpConn, err = listenUDPPair()
+		}
+		if err != nil {
+			return err
+		}
+		port := m.rtpConn.LocalAddr().(*net.UDPAddr).Port
+		if c.rtcpMux {
+			params = append(params, header.NewClientPort(port, port), header.ParamRTCPMux)
+		} else {
+			params = append(params, header.NewClientPort(port, m.rtcpConn.LocalAddr().(*net.UDPAddr).Port))
+		}
+	}
+	if record {
+		params = append(params, header.ModeRecord)
+	}
+	lt := header.LoweTransUDP
+	if c.interleaved {
+		lt = header.LowerTransTCP
+	}
+	req := newRequest(methods.SETUP, c.controlURL(control))
+	req.setHeader(header.Transport, header.NewTransportHeader(lt, params...))
+	// the following medias are set up in the session of the first one.
+	if c.session != "" {
+		req.setHeader(header.Session, c.session)
+	}
+	res, err := c.do(req, false)
+	if err != nil {
+		m.close()
+		return err
+	}
+	if sh, ok := res.Header(header.Session); ok && len(sh) > 0 {
+		c.setSession(sh[0])
+	}
+	th, ok := res.Header(header.Transport)
+	if !ok || len(th) == 0 {
+		m.close()
+		return fmt.Errorf("setup response without transport header")
+	}
+	tr := header.ParseTransportHeader(th[0])
+	if c.interleaved {
+		if p1, p2, ok1 := tr.Interleaved(); ok1 {
+			m.rtp, m.rtcp = p1, p2
+		}
+	} else {
+		p1, p2, ok1 := tr.ServerPort()
+		if !ok1 {
+			m.close()
+			return fmt.Errorf("setup response without server port")
+		}
+		ip := c.cc.conn.RemoteAddr().(*net.TCPAddr).IP
+		m.rtpAddr = &net.UDPAddr{IP: ip, Port: p1}
+		m.rtcpAddr = &net.UDPAddr{IP: ip, Port: p2}
+		// the server without the mux answers the port pair,
+		// its rtcp is still sent to the single port of the client.
+		m.mux = c.rtcpMux
+		go c.readUDP(m, m.rtpConn, 0)
+		if m.rtcpConn != nil {
+			go c.readUDP(m, m.rtcpConn, 1)
+		}
+	}
+	c.medias = append(c.medias, m)
+	return nil
+}
+
+// Play start the stream delivery and keep the session alive.
+func (c *Client) Play() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	req := newRequest(methods.PLAY, c.aggregateURL())
+	req.setHeader(header.Session, c.session)
+	_, err := c.do(req, false)
+	if err != nil {
+		return err
+	}
+	go c.keepalive(c.cc)
+	return nil
+}
+
+// Record start the stream delivery to the server, the packages are sent by WritePackage.
+func (c *Client) Record() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	req := newRequest(methods.RECORD, c.aggregateURL())
+	req.setHeader(header.Session, c.session)
+	_, err := c.do(req, false)
+	if err != nil {
+		return err
+	}
+	// the interleaved media keeps the session alive.
+	if !c.interleaved {
+		go c.keepalive(c.cc)
+	}
+	return nil
+}
+
+// WritePackage send the package of a recording session, the package is
+// marked as it is read, interleaved with channel or udp with order.
+func (c *Client) WritePackage(p *Package) error {
+	order, rtcp := p.media()
+	if order >= len(c.medias) {
+		return fmt.Errorf("media %d is not set up", order)
+	}
+	m := c.medias[order]
+	if c.interleaved {
+		ch := m.rtp
+		if rtcp {
+			ch = m.rtcp
+		}
+		return c.cc.writeInterleavedFrame(ch, p.Data[:p.Len])
+	}
+	var err error
+	if rtcp && m.rtcpConn != nil {
+		_, err = m.rtcpConn.WriteToUDP(p.Data[:p.Len], m.rtcpAddr)
+	} else if rtcp {
+		_, err = m.rtpConn.WriteToUDP(p.Data[:p.Len], m.rtcpAddr)
+	} else {
+		_, err = m.rtpConn.WriteToUDP(p.Data[:p.Len], m.rtpAddr)
+	}
+	return err
+}
+
+// Teardown stop the stream delivery and close the client.
+func (c *Client) Teardown() error {
+	c.mu.Lock()
+	req := newRequest(methods.TEARDOWN, c.aggregateURL())
+	req.setHeader(header.Session, c.session)
+	_, err := c.do(req, false)
+	c.mu.Unlock()
+	_ = c.Close()
+	return err
+}
+
+// ReadPackage returns the next received package.
+// Interleaved packages are marked with their channel, udp packages
+// are marked with rtp(0)/rtcp(1) and the order of the media.
+func (c *Client) ReadPackage() (*Package, error) {
+	select {
+	case p := <-c.packets:
+		return p, nil
+	case <-c.done:
+		return nil, c.err
+	}
+}
+
+// Done is closed when the client is closed or the connection is broken.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *Client) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+func (c *Client) Close() error {
+	c.fail(io.EOF)
+	return nil
+}
+
+func (c *Client) fail(err error) {
+	c.closeOnce.Do(func() {
+		c.err = err
+		close(c.done)
+		c.mu.Lock()
+		if c.cc != nil {
+			c.cc.close(err)
+		}
+		for _, m := range c.medias {
+			m.close()
+		}
+		c.mu.Unlock()
+	})
+}
+
+// send the request and wait for the response, follow the redirects
+// and answer the authenticate challenges.
+func (c *Client) do(req *request, redirect bool) (*response, error) {
+	redirects := 0
+	authorized := false
+	for {
+		res, err := c.roundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case res.code == 401 && c.user != nil && !authorized:
+			challenges, _ := res.Header(header.WWWAuthenticate)
+			c.auth, err = newAuthenticator(c.user, challenges)
+			if err != nil {
+				return nil, err
+			}
+			authorized = true
+			continue
+		case res.code >= 300 && res.code < 400 && redirect && redirects < c.maxRedirects:
+			location, ok := res.Header(header.Location)
+			if !ok || len(location) == 0 {
+				break
+			}
+			u, err1 := c.url.Parse(location[0])
+			if err1 != nil {
+				return nil, err1
+			}
+			if u.User == nil {
+				u.User = c.user
+			}
+			c.log.Debugf("redirect %s to %s", c.url.Redacted(), u.Redacted())
+			err = c.dial(context.Background(), u)
+			if err != nil {
+				return nil, err
+			}
+			redirects++
+			authorized = false
+			req.url = u
+			continue
+		}
+		if res.code != 200 {
+			return res, fmt.Errorf("%s %s: %d %s", req.method, req.url.Redacted(), res.code, res.status)
+		}
+		return res, nil
+	}
+}
+
+func (c *Client) roundTrip(req *request) (*response, error) {
+	cc := c.cc
+	if cc == nil {
+		return nil, fmt.Errorf("client is not connected")
+	}
+	// drop the responses of the keep alive requests.
+	for len(cc.responses) > 0 {
+		<-cc.responses
+	}
+	err := c.send(cc, req)
+	if err != nil {
+		return nil, err
+	}
+	timer := time.NewTimer(c.timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case res := <-cc.responses:
+			if cs, _ := res.Header(header.CSeq); len(cs) == 0 || cs[0] != req.cSeq {
+				continue
+			}
+			return res, nil
+		case <-cc.done:
+			return nil, cc.err
+		case <-c.done:
+			return nil, c.err
+		case <-timer.C:
+			return nil, fmt.Errorf("%s %s: timeout", req.method, req.url.Redacted())
+		}
+	}
+}
+
+// write the request without waiting for the response.
+func (c *Client) send(cc *clientConn, req *request) error {
+	c.cSeq++
+	req.cSeq = strconv.FormatUint(c.cSeq, 10)
+	if c.auth != nil {
+		req.setHeader(header.Authorization, c.auth.Authorization(req.method, req.url))
+	}
+	if c.userAgent != "" {
+		req.setHeader(header.UserAgent, c.userAgent)
+	}
+	return cc.write(req.Encode())
+}
+
+// read the responses and interleaved frames from the connection.
+func (c *Client) read(cc *clientConn) {
+	for {
+		b, err := cc.br.Peek(1)
+		if err != nil {
+			c.broken(cc, err)
+			return
+		}
+		if b[0] != 0x24 {
+			res, err1 := parseResponse(cc.br)
+			if err1 != nil {
+				c.broken(cc, err1)
+				return
+			}
+			select {
+			case cc.responses <- res:
+			default:
+			}
+			continue
+		}
+		p, err := readInterleavedPackage(cc.br, cc.rhdr[:])
+		if err != nil {
+			c.broken(cc, err)
+			return
+		}
+		if !c.deliver(p) {
+			return
+		}
+	}
+}
+
+func (c *Client) readUDP(m *clientMedia, conn *net.UDPConn, ch int) {
+	buf := make([]byte, maxPackageSize)
+	for {
+		p, _, err := readUDPPackage(conn, buf)
+		if err != nil {
+			return
+		}
+		p.Ch = ch
+		if ch == 0 && m.mux && isMuxedRTCP(p.Data[:p.Len]) {
+			p.Ch = 1
+		}
+		p.Order = m.order
+		p.Interleaved = false
+		if !c.deliver(p) {
+			return
+		}
+	}
+}
+
+func (c *Client) deliver(p *Package) bool {
+	select {
+	case c.packets <- p:
+		return true
+	case <-c.done:
+		putPackage(p)
+		return false
+	}
+}
+
+// the broken connection fails the client unless it has been replaced.
+func (c *Client) broken(cc *clientConn, err error) {
+	cc.close(err)
+	c.mu.Lock()
+	current := c.cc == cc
+	c.mu.Unlock()
+	if current {
+		c.fail(err)
+	}
+}
+
+func (c *Client) keepalive(cc *clientConn) {
+	interval := c.keepAlive
+	if interval <= 0 {
+		interval = c.sessionTimeout / 2
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.mu.Lock()
+			req := newRequest(methods.OPTIONS, c.url)
+			req.setHeader(header.Session, c.session)
+			err := c.send(cc, req)
+			c.mu.Unlock()
+			if err != nil {
+				return
+			}
+		case <-cc.done:
+			return
+		}
+	}
+}
+
+// Session: 12345678;timeout=60
+func (c *Client) setSession(raw string) {
+	id, params, _ := strings.Cut(raw, ";")
+	c.session = strings.TrimSpace(id)
+	for _, p := range strings.Split(params, ";") {
+		k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+		if k != "timeout" {
+			continue
+		}
+		if t, err := strconv.Atoi(v); err == nil && t > 0 {
+			c.sessionTimeout = time.Duration(t) * time.Second
+		}
+	}
+}
+
+func (c *Client) aggregateURL() *url.URL {
+	return c.base
+}
+
+// resolve the control attribute against the base url.
+func (c *Client) controlURL(control string) *url.URL {
+	if control == "" || control == "*" {
+		return c.base
+	}
+	u, err := url.Parse(control)
+	if err == nil && u.IsAbs() {
+		return u
+	}
+	base := *c.base
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+	rv, err := base.Parse(control)
+	if err != nil {
+		return c.base
+	}
+	return rv
+}
+
+func (cc *clientConn) write(data []byte) error {
+	cc.wm.Lock()
+	defer cc.wm.Unlock()
+	_, err := cc.conn.Write(data)
+	return err
+}
+
+func (cc *clientConn) writeInterleavedFrame(channel int, frame []byte) error {
+	cc.wm.Lock()
+	defer cc.wm.Unlock()
+	// the buffer is reused by the frames of the connection.
+	cc.wbuf = appendInterleavedFrame(cc.wbuf[:0], channel, frame)
+	_, err := cc.conn.Write(cc.wbuf)
+	return err
+}
+
+func (cc *clientConn) close(err error) {
+	cc.wm.Lock()
+	defer cc.wm.Unlock()
+	select {
+	case <-cc.done:
+		return
+	default:
+	}
+	cc.err = err
+	close(cc.done)
+	_ = cc.conn.Close()
+}
+
+func (m *clientMedia) close() {
+	if m.rtpConn != nil {
+		_ = m.rtpConn.Close()
+	}
+	if m.rtcpConn != nil {
+		_ = m.rtcpConn.Close()
+	}
+}
+
+// listen a pair of udp ports, rtp on the even one and rtcp on the next.
+func listenUDPPair() (*net.UDPConn, *net.UDPConn, error) {
+	for i := 0; i < 16; i++ {
+		rtp, err := net.ListenUDP("udp", &net.UDPAddr{})
+		if err != nil {
+			return nil, nil, err
+		}
+		port := rtp.LocalAddr().(*net.UDPAddr).Port
+		if port%2 != 0 {
+			_ = rtp.Close()
+			continue
+		}
+		rtcp, err := net.ListenUDP("udp", &net.UDPAddr{Port: port + 1})
+		if err != nil {
+			_ = rtp.Close()
+			continue
+		}
+		return rtp, rtcp, nil
+	}
+	return nil, nil, fmt.Errorf("can not allocate udp port pair")
+}
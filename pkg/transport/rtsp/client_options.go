@@ -0,0 +1,55 @@
+package rtsp
+
+import (
+	"github.com/ChinasMr/kaka/pkg/log"
+	"time"
+)
+
+type ClientOption func(c *Client)
+
+func ClientLogger(logger log.Logger) ClientOption {
+	return func(c *Client) {
+		c.log = log.NewHelper(logger)
+	}
+}
+
+func ClientTimeout(duration time.Duration) ClientOption {
+	return func(c *Client) {
+		c.timeout = duration
+	}
+}
+
+// ClientKeepAlive set the interval of the keep alive requests
+// while playing, the half of the session timeout is used if not set.
+func ClientKeepAlive(duration time.Duration) ClientOption {
+	return func(c *Client) {
+		c.keepAlive = duration
+	}
+}
+
+// ClientInterleaved make the media transported on the rtsp tcp connection.
+func ClientInterleaved(interleaved bool) ClientOption {
+	return func(c *Client) {
+		c.interleaved = interleaved
+	}
+}
+
+// ClientRTCPMux offer the rtcp muxed on the rtp port of the udp media,
+// the port pair is used if the server does not accept it.
+func ClientRTCPMux(mux bool) ClientOption {
+	return func(c *Client) {
+		c.rtcpMux = mux
+	}
+}
+
+func ClientMaxRedirects(n int) ClientOption {
+	return func(c *Client) {
+		c.maxRedirects = n
+	}
+}
+
+func ClientUserAgent(ua string) ClientOption {
+	return func(c *Client) {
+		c.userAgent = ua
+	}
+}
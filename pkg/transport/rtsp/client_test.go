@@ -0,0 +1,142 @@
+package rtsp
+
+import (
+	"context"
+	"fmt"
+	"github.com/ChinasMr/kaka/pkg/transport/rtsp/header"
+	"github.com/ChinasMr/kaka/pkg/transport/rtsp/methods"
+	"sync"
+	"testing"
+	"time"
+)
+
+// publishClient announce the test source to the channel and record by the client.
+func publishClient(t *testing.T, addr string, name string, interleaved bool) *Client {
+	t.Helper()
+	pub := NewClient(ClientInterleaved(interleaved), ClientTimeout(5*time.Second))
+	if err := pub.Dial(context.Background(), "rtsp://"+addr+"/"+name); err != nil {
+		t.Fatal(err)
+	}
+	if err := pub.Announce([]byte(testSDP)); err != nil {
+		t.Fatal(err)
+	}
+	for _, control := range []string{"streamid=0", "streamid=1"} {
+		if err := pub.Setup(control, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pub.Record(); err != nil {
+		t.Fatal(err)
+	}
+	return pub
+}
+
+// writeTestPackage send the rtp package of the media by the publisher.
+func writeTestPackage(pub *Client, order int, seq uint16) error {
+	p := rtpPackage(order, seq)
+	defer putPackage(p)
+	if !pub.interleaved {
+		p.Interleaved = false
+		p.Order = order
+		p.Ch = 0
+	}
+	return pub.WritePackage(p)
+}
+
+func TestClientAgainstServer(t *testing.T) {
+	s, addr := newTestServer(t, WithChannel("tcp"), WithChannel("udp"))
+	// the sessions the SETUP requests refer to, in their order.
+	var mu sync.Mutex
+	var sessions []string
+	setup := s.handlers[methods.SETUP]
+	s.RegisterHandleFunc(methods.SETUP, func(req Request, res Response, tx Transaction) error {
+		v, _ := req.Header(header.Session)
+		mu.Lock()
+		sessions = append(sessions, fmt.Sprint(v))
+		mu.Unlock()
+		return setup(req, res, tx)
+	})
+	for _, tc := range []struct {
+		name        string
+		interleaved bool
+	}{
+		{name: "tcp", interleaved: true},
+		{name: "udp", interleaved: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mu.Lock()
+			sessions = nil
+			mu.Unlock()
+			pub := publishClient(t, addr, tc.name, tc.interleaved)
+			defer pub.Close()
+			mu.Lock()
+			if len(sessions) != 2 || sessions[0] != "[]" || sessions[1] == "[]" {
+				t.Fatalf("the second SETUP of the publisher is out of the session: %v", sessions)
+			}
+			sessions = nil
+			mu.Unlock()
+
+			cl := NewClient(ClientInterleaved(tc.interleaved), ClientTimeout(5*time.Second))
+			if err := cl.Dial(context.Background(), "rtsp://u:p@"+addr+"/"+tc.name); err != nil {
+				t.Fatal(err)
+			}
+			defer cl.Close()
+			if _, err := cl.Options(); err != nil {
+				t.Fatal(err)
+			}
+			msg, _, err := cl.Describe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(msg.Medias) != 2 {
+				t.Fatalf("medias %d", len(msg.Medias))
+			}
+			for _, m := range msg.Medias {
+				if err = cl.Setup(m.Attribute("control"), false); err != nil {
+					t.Fatal(err)
+				}
+			}
+			mu.Lock()
+			if len(sessions) != 2 || sessions[1] != fmt.Sprint([]string{cl.session}) {
+				t.Fatalf("the second SETUP of the reader is out of the session: %v", sessions)
+			}
+			mu.Unlock()
+			if err = cl.Play(); err != nil {
+				t.Fatal(err)
+			}
+
+			stop := make(chan struct{})
+			defer close(stop)
+			go func() {
+				for seq := uint16(0); ; seq++ {
+					select {
+					case <-stop:
+						return
+					case <-time.After(10 * time.Millisecond):
+					}
+					_ = writeTestPackage(pub, int(seq%2), seq)
+				}
+			}()
+			received := map[int]int{}
+			// the reader is closed if the packages do not arrive in time.
+			timer := time.AfterFunc(5*time.Second, func() {
+				_ = cl.Close()
+			})
+			for received[0] < 3 || received[1] < 3 {
+				p, err := cl.ReadPackage()
+				if err != nil {
+					t.Fatalf("received %v: %v", received, err)
+				}
+				order, rtcp := p.media()
+				if !rtcp {
+					received[order]++
+				}
+				putPackage(p)
+			}
+			timer.Stop()
+			if err = cl.Teardown(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -5,76 +5,34 @@ import (
 	"github.com/google/uuid"
 	"net"
 	"sync"
+	"time"
 )
 
 var _ TransactionController = (*transactionController)(nil)
 
 type TransactionController interface {
-	CreateTx(trans *transport, rf *rtcpFamily) *transaction
+	CreateTx(trans Transport, rf *rtcpFamily) *transaction
 	DeleteTx(id *transaction)
 	GetCh(ch string) (Channel, bool)
 	GetOrCreateCh(ch string) Channel
+	AddCh(name string, ch Channel)
+	ListCh() []Channel
 	Forward(p *Package, addr *net.UDPAddr)
 }
 
-type forwarder struct {
-	addr   *net.UDPAddr
-	order  int
-	input  chan *Package
-	output chan *Package
-}
-
-func (t *transactionController) serve(f *forwarder) {
-	for p := range f.input {
-		if f.output != nil {
-			p.Order = f.order
-			f.output <- p
-			continue
-		}
-		// try to find the corrected channel.
-		ok := func() bool {
-			for _, ch := range t.chs {
-				if !f.addr.IP.Equal(ch.Source().IP()) {
-					continue
-				}
-				for _, m := range ch.Source().Medias() {
-					if m.interleaved || !m.record {
-						continue
-					}
-					if f.addr.Port == m.rtp || f.addr.Port == m.rtcp {
-						f.output = ch.Input()
-						f.order = m.order
-						return true
-					}
-				}
-			}
-			return false
-		}()
-		if ok {
-			f.output <- p
-		} else {
-			// can not find relative ch, return.
-			// todo need clear relative resource.
-		}
-	}
-}
-
 type transactionController struct {
+	// the packages of the shared sockets dropped while their forwarders are behind.
+	dropped    uint64
 	chs        map[string]Channel
 	rwm        sync.RWMutex
+	fm         sync.Mutex
 	forwarders map[string]*forwarder
-}
-
-func (t *transactionController) Forward(p *Package, addr *net.UDPAddr) {
-	f, ok := t.forwarders[addr.String()]
-	if ok {
-		f.input <- p
-		return
-	}
-	f = &forwarder{addr: addr, input: make(chan *Package, 5), output: nil}
-	t.forwarders[addr.String()] = f
-	go t.serve(f)
-	f.input <- p
+	unknown    int
+	txs        map[string]*transaction
+	cc         channelConfig
+	// the durations the bound and the unknown forwarders are kept while idle.
+	idle       time.Duration
+	unknownTTL time.Duration
 }
 
 func (t *transactionController) GetCh(ch string) (Channel, bool) {
@@ -91,48 +49,93 @@ func (t *transactionController) GetOrCreateCh(ch string) Channel {
 	if ok {
 		return rv
 	}
-	nc := NewChannel(ch)
+	nc := newChannel(ch, t.cc)
 	t.chs[ch] = nc
 	return nc
 }
 
-func newTransactionController(chs ...string) TransactionController {
+func (t *transactionController) AddCh(name string, ch Channel) {
+	t.rwm.Lock()
+	defer t.rwm.Unlock()
+	t.chs[name] = ch
+}
+
+func (t *transactionController) ListCh() []Channel {
+	t.rwm.RLock()
+	defer t.rwm.RUnlock()
+	rv := make([]Channel, 0, len(t.chs))
+	for _, ch := range t.chs {
+		rv = append(rv, ch)
+	}
+	return rv
+}
+
+func newTransactionController(cc channelConfig, chs ...string) TransactionController {
 	tc := &transactionController{
+		cc:         cc,
 		rwm:        sync.RWMutex{},
 		chs:        map[string]Channel{},
 		forwarders: map[string]*forwarder{},
+		txs:        map[string]*transaction{},
+		idle:       forwarderIdle,
+		unknownTTL: forwarderUnknownTTL,
 	}
 	for _, ch := range chs {
 		if len(ch) == 0 {
 			continue
 		}
-		tc.chs[ch] = NewChannel(ch)
+		tc.chs[ch] = newChannel(ch, cc)
 	}
 	return tc
 }
 
-func (t *transactionController) CreateTx(trans *transport, rf *rtcpFamily) *transaction {
+func (t *transactionController) CreateTx(trans Transport, rf *rtcpFamily) *transaction {
 	id, _ := uuid.NewUUID()
 	tx := txPool.Get().(*transaction)
+	tx.rwm.Lock()
 	tx.id = id.String()
 	tx.transport = trans
 	tx.rf = rf
+	tx.rwm.Unlock()
+	t.rwm.Lock()
+	t.txs[tx.id] = tx
+	t.rwm.Unlock()
 	return tx
 }
 
 func (t *transactionController) DeleteTx(tx *transaction) {
-	for _, ch := range t.chs {
+	t.rwm.Lock()
+	delete(t.txs, tx.id)
+	t.rwm.Unlock()
+	t.removeForwarders(tx.id)
+	// close the connection first, so the blocked writers of the channels return.
+	_ = tx.Close()
+	// the channel published by the session is reset first,
+	// the teardown of any channel clears the status.
+	chs := t.ListCh()
+	for i, ch := range chs {
+		if ch.Source() == Transaction(tx) {
+			chs[0], chs[i] = chs[i], chs[0]
+			break
+		}
+	}
+	for _, ch := range chs {
 		_ = ch.Teardown(tx)
 	}
-	_ = tx.Close()
 
+	tx.rwm.Lock()
 	tx.id = ""
 	tx.state = status.INIT
 	tx.transport = nil
 	tx.rf = nil
-	tx.medias = map[string]*Media{}
-	tx.rwm = sync.RWMutex{}
+	tx.releaseMedias()
 	tx.interleaved = false
+	tx.proto = ""
+	tx.pipelined = ""
+	tx.playURL = nil
+	tx.played = time.Time{}
+	tx.cSeq = 0
+	tx.rwm.Unlock()
 	txPool.Put(tx)
 }
 
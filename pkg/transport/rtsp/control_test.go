@@ -0,0 +1,122 @@
+package rtsp
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stressPublish record the channel by the publisher until stopped, the readers
+// play it meanwhile over tcp and udp, half of them tear down and the others disconnect.
+func stressPublish(t *testing.T, addr string, name string, interleaved bool, readers int) {
+	pub := NewClient(ClientInterleaved(interleaved), ClientTimeout(5*time.Second))
+	err := pub.Dial(context.Background(), "rtsp://"+addr+"/"+name)
+	if err == nil {
+		err = pub.Announce([]byte(testSDP))
+	}
+	for _, control := range []string{"streamid=0", "streamid=1"} {
+		if err == nil {
+			err = pub.Setup(control, true)
+		}
+	}
+	if err == nil {
+		err = pub.Record()
+	}
+	if err != nil {
+		_ = pub.Close()
+		t.Errorf("publish %s: %v", name, err)
+		return
+	}
+	stop := make(chan struct{})
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		for seq := uint16(0); ; seq++ {
+			select {
+			case <-stop:
+				return
+			case <-time.After(time.Millisecond):
+			}
+			_ = writeTestPackage(pub, int(seq%2), seq)
+		}
+	}()
+	wg := sync.WaitGroup{}
+	for r := 0; r < readers; r++ {
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+			if err := stressPlay(addr, name, r%2 == 0, r%4 < 2); err != nil {
+				t.Errorf("play %s by reader %d: %v", name, r, err)
+			}
+		}(r)
+	}
+	wg.Wait()
+	close(stop)
+	<-sent
+	if err = pub.Teardown(); err != nil {
+		t.Errorf("teardown %s: %v", name, err)
+	}
+}
+
+// stressPlay play the channel until some packages are received.
+func stressPlay(addr string, name string, interleaved bool, teardown bool) error {
+	cl := NewClient(ClientInterleaved(interleaved), ClientTimeout(5*time.Second))
+	if err := cl.Dial(context.Background(), "rtsp://"+addr+"/"+name); err != nil {
+		return err
+	}
+	defer cl.Close()
+	if _, _, err := cl.Describe(); err != nil {
+		return err
+	}
+	for _, control := range []string{"streamid=0", "streamid=1"} {
+		if err := cl.Setup(control, false); err != nil {
+			return err
+		}
+	}
+	if err := cl.Play(); err != nil {
+		return err
+	}
+	timer := time.AfterFunc(5*time.Second, func() {
+		_ = cl.Close()
+	})
+	defer timer.Stop()
+	for i := 0; i < 20; i++ {
+		p, err := cl.ReadPackage()
+		if err != nil {
+			return fmt.Errorf("received %d packages: %v", i, err)
+		}
+		putPackage(p)
+	}
+	if teardown {
+		return cl.Teardown()
+	}
+	return nil
+}
+
+func TestConcurrentPublishPlayTeardown(t *testing.T) {
+	const channels, rounds, readers = 3, 3, 4
+	opts := make([]ServerOption, 0, channels)
+	for i := 0; i < channels; i++ {
+		opts = append(opts, WithChannel(fmt.Sprintf("stress%d", i)))
+	}
+	s, addr := newTestServer(t, opts...)
+	wg := sync.WaitGroup{}
+	for i := 0; i < channels; i++ {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			// the publishers of the channel take turns over tcp and udp.
+			for round := 0; round < rounds; round++ {
+				stressPublish(t, addr, name, round%2 == 0, readers)
+				// the next publisher locks the channel after the teardown is handled.
+				ch, _ := s.tc.GetCh(name)
+				for k := 0; k < 100 && ch.Source() != nil; k++ {
+					time.Sleep(10 * time.Millisecond)
+				}
+			}
+		}(fmt.Sprintf("stress%d", i))
+	}
+	wg.Wait()
+}
@@ -0,0 +1,14 @@
+//go:build linux || darwin || freebsd
+
+package rtsp
+
+import "syscall"
+
+// diskSpace returns the free and the total bytes of the disk of the path.
+func diskSpace(path string) (uint64, uint64, error) {
+	st := syscall.Statfs_t{}
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), uint64(st.Blocks) * uint64(st.Bsize), nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd
+
+package rtsp
+
+import "fmt"
+
+// diskSpace is not supported on the platform, the disk floor is not enforced.
+func diskSpace(_ string) (uint64, uint64, error) {
+	return 0, 0, fmt.Errorf("disk space is not supported")
+}
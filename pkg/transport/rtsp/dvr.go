@@ -0,0 +1,248 @@
+package rtsp
+
+import (
+	"encoding/binary"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// the default bytes buffered for the time-shift of a channel.
+	defaultDVRSize = 256 << 20
+	maxDVRWindow   = time.Hour
+)
+
+type dvrConfig struct {
+	window time.Duration
+	// the max bytes of the buffered packages.
+	size int
+}
+
+// dvrBuffer keeps the packages the channel received in the window, so the
+// readers can start from the past and catch up to the live. The packages
+// are numbered by their arrival, the numbers go on after evicted.
+type dvrBuffer struct {
+	mu      sync.Mutex
+	window  time.Duration
+	size    int
+	entries []dvrEntry
+	head    int
+	// the number of the first buffered package.
+	first uint64
+	bytes int
+	// the numbers of the buffered keyframes in their order,
+	// and the count of the buffered video packages.
+	keys   []uint64
+	videos int
+}
+
+type dvrEntry struct {
+	p  *Package
+	at time.Time
+}
+
+func newDVRBuffer(c dvrConfig) *dvrBuffer {
+	size := c.size
+	if size <= 0 {
+		size = defaultDVRSize
+	}
+	return &dvrBuffer{
+		window: c.window,
+		size:   size,
+	}
+}
+
+// push keep the package received at the time, the packages out of
+// the window or the size are released.
+func (d *dvrBuffer) push(p *Package, at time.Time) {
+	p.retain()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if p.key {
+		d.keys = append(d.keys, d.first+uint64(len(d.entries)-d.head))
+	}
+	if p.video {
+		d.videos++
+	}
+	d.entries = append(d.entries, dvrEntry{p: p, at: at})
+	d.bytes += cap(p.Data)
+	for d.head < len(d.entries) {
+		e := d.entries[d.head]
+		if at.Sub(e.at) <= d.window && d.bytes <= d.size {
+			break
+		}
+		d.evict()
+	}
+	// compact the evicted entries.
+	if d.head > len(d.entries)/2 && d.head > 1024 {
+		n := copy(d.entries, d.entries[d.head:])
+		for i := n; i < len(d.entries); i++ {
+			d.entries[i] = dvrEntry{}
+		}
+		d.entries = d.entries[:n]
+		d.head = 0
+	}
+}
+
+// evict the oldest package, must be called with the lock held.
+func (d *dvrBuffer) evict() {
+	e := d.entries[d.head]
+	d.entries[d.head] = dvrEntry{}
+	if len(d.keys) > 0 && d.keys[0] == d.first {
+		d.keys = d.keys[1:]
+	}
+	if e.p.video {
+		d.videos--
+	}
+	d.head++
+	d.first++
+	d.bytes -= cap(e.p.Data)
+	e.p.release()
+}
+
+// clear release the buffered packages, the source of the channel is gone.
+func (d *dvrBuffer) clear() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for d.head < len(d.entries) {
+		d.evict()
+	}
+	d.entries = d.entries[:0]
+	d.head = 0
+	d.keys = nil
+}
+
+// seek returns the number of the package the reader starts from at the time,
+// the video starts from its keyframe not after the time, or the oldest one.
+// It returns false if no package is buffered from the time.
+func (d *dvrBuffer) seek(at time.Time) (uint64, time.Time, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	entries := d.entries[d.head:]
+	i := sort.Search(len(entries), func(i int) bool {
+		return !entries[i].at.Before(at)
+	})
+	if i == len(entries) {
+		return 0, time.Time{}, false
+	}
+	n := d.first + uint64(i)
+	// back to the keyframe, or forward to the first one if evicted.
+	if d.videos > 0 {
+		k := sort.Search(len(d.keys), func(k int) bool {
+			return d.keys[k] > n
+		})
+		switch {
+		case k > 0:
+			n = d.keys[k-1]
+		case len(d.keys) > 0:
+			n = d.keys[0]
+		default:
+			return 0, time.Time{}, false
+		}
+	}
+	return n, entries[n-d.first].at, true
+}
+
+// get returns the package of the number retained and the time it arrived,
+// and moves the number to the next one. The number evicted moves to the
+// oldest keyframe. It returns false if the number is not received yet.
+func (d *dvrBuffer) get(next *uint64) (*Package, time.Time, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if *next < d.first {
+		*next = d.first
+		if len(d.keys) > 0 {
+			*next = d.keys[0]
+		}
+	}
+	i := d.head + int(*next-d.first)
+	if i >= len(d.entries) {
+		return nil, time.Time{}, false
+	}
+	e := d.entries[i]
+	e.p.retain()
+	*next++
+	return e.p, e.at, true
+}
+
+// info returns the sequence number and the rtp timestamp of the first rtp
+// package of every media from the number.
+func (d *dvrBuffer) info(from uint64, medias int) map[int]RTPInfo {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	rv := map[int]RTPInfo{}
+	if from < d.first {
+		return rv
+	}
+	for i := d.head + int(from-d.first); i < len(d.entries) && len(rv) < medias; i++ {
+		p := d.entries[i].p
+		order, rtcp := p.media()
+		if _, ok := rv[order]; ok || rtcp || p.Len < 12 {
+			continue
+		}
+		rv[order] = RTPInfo{
+			Seq:     binary.BigEndian.Uint16(p.Data[2:]),
+			RTPTime: binary.BigEndian.Uint32(p.Data[4:]),
+		}
+	}
+	return rv
+}
+
+// dvrCursor is the reader playing the buffer of the channel from the past,
+// it joins the live readers once it catches up.
+type dvrCursor struct {
+	next  uint64
+	start time.Time
+	rate  float64
+	info  map[int]RTPInfo
+	queue *packageQueue
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// replay push the buffered packages to the queue of the reader paced
+// by their arrival at the rate, until no package is left behind the live.
+func (c *channel) replay(id string, cur *dvrCursor) {
+	defer close(cur.done)
+	began := time.Now()
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	defer timer.Stop()
+	for {
+		p, at, ok := c.dvr.get(&cur.next)
+		if !ok {
+			// the live packages are buffered with the read lock held,
+			// so none is missed or duplicated by the switch.
+			c.rwm.Lock()
+			p, at, ok = c.dvr.get(&cur.next)
+			if !ok {
+				if c.shifts[id] == cur {
+					delete(c.shifts, id)
+					c.queues[id] = cur.queue
+				}
+				c.rwm.Unlock()
+				return
+			}
+			c.rwm.Unlock()
+		}
+		if wait := time.Until(began.Add(time.Duration(float64(at.Sub(cur.start)) / cur.rate))); wait > 0 {
+			timer.Reset(wait)
+			select {
+			case <-cur.stop:
+				p.release()
+				return
+			case <-timer.C:
+			}
+		} else {
+			select {
+			case <-cur.stop:
+				p.release()
+				return
+			default:
+			}
+		}
+		cur.queue.push(p)
+		p.release()
+	}
+}
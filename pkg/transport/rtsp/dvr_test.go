@@ -0,0 +1,85 @@
+package rtsp
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// pushVideo buffer the video packages arrived every 10ms from the epoch,
+// every tenth one is a keyframe.
+func pushVideo(d *dvrBuffer, epoch time.Time, from int, to int) {
+	for i := from; i < to; i++ {
+		p := rtpPackage(0, uint16(i))
+		p.refs = 1
+		p.video, p.key = true, i%10 == 0
+		d.push(p, epoch.Add(time.Duration(i)*10*time.Millisecond))
+		p.release()
+	}
+}
+
+func rtpSeq(p *Package) uint16 {
+	return binary.BigEndian.Uint16(p.Data[2:])
+}
+
+func TestDVRSeek(t *testing.T) {
+	epoch := time.Now()
+	d := newDVRBuffer(dvrConfig{window: 150 * time.Millisecond})
+	defer d.clear()
+	pushVideo(d, epoch, 0, 35)
+	// the packages before 19 are out of the window, the keyframe 10 is evicted.
+	for _, tc := range []struct {
+		at   int
+		want uint64
+		ok   bool
+	}{
+		{at: 0, want: 20, ok: true},
+		{at: 19, want: 20, ok: true},
+		{at: 25, want: 20, ok: true},
+		{at: 30, want: 30, ok: true},
+		{at: 34, want: 30, ok: true},
+		{at: 35},
+	} {
+		n, at, ok := d.seek(epoch.Add(time.Duration(tc.at) * 10 * time.Millisecond))
+		if ok != tc.ok || n != tc.want {
+			t.Errorf("seek %d = %d, %v, want %d, %v", tc.at, n, ok, tc.want, tc.ok)
+			continue
+		}
+		if ok && !at.Equal(epoch.Add(time.Duration(n)*10*time.Millisecond)) {
+			t.Errorf("seek %d arrived at %v", tc.at, at.Sub(epoch))
+		}
+	}
+	pushVideo(d, epoch, 35, 45)
+	if n, _, _ := d.seek(epoch.Add(430 * time.Millisecond)); n != 40 {
+		t.Errorf("seek 43 = %d, want 40", n)
+	}
+	if n, _, _ := d.seek(epoch.Add(390 * time.Millisecond)); n != 30 {
+		t.Errorf("seek 39 = %d, want 30", n)
+	}
+}
+
+func TestDVRGetEvicted(t *testing.T) {
+	epoch := time.Now()
+	d := newDVRBuffer(dvrConfig{window: 150 * time.Millisecond})
+	defer d.clear()
+	pushVideo(d, epoch, 0, 35)
+	// the evicted number moves to the oldest keyframe.
+	next := uint64(5)
+	p, _, ok := d.get(&next)
+	if !ok || rtpSeq(p) != 20 || next != 21 {
+		t.Fatalf("get the evicted package: %v, next %d", ok, next)
+	}
+	p.release()
+	next = 35
+	if _, _, ok = d.get(&next); ok {
+		t.Fatal("get the package not received yet")
+	}
+	// the buffer without the keyframe starts from the oldest package.
+	d.clear()
+	pushVideo(d, epoch, 31, 35)
+	next = 0
+	if p, _, ok = d.get(&next); !ok || rtpSeq(p) != 31 {
+		t.Fatalf("get without the keyframe: %v", ok)
+	}
+	p.release()
+}
@@ -18,6 +18,36 @@ func ErrMethodNotAllowed(res Response) Response {
 	return res
 }
 
+func ErrNotFound(res Response) Response {
+	res.SetStatus("Not Found")
+	res.SetCode(404)
+	return res
+}
+
+func ErrSessionNotFound(res Response) Response {
+	res.SetStatus("Session Not Found")
+	res.SetCode(454)
+	return res
+}
+
+func ErrBadRequest(res Response) Response {
+	res.SetStatus("Bad Request")
+	res.SetCode(400)
+	return res
+}
+
+func ErrInvalidRange(res Response) Response {
+	res.SetStatus("Invalid Range")
+	res.SetCode(457)
+	return res
+}
+
+func ErrVersionNotSupported(res Response) Response {
+	res.SetStatus("RTSP Version Not Supported")
+	res.SetCode(505)
+	return res
+}
+
 func ErrMethodNotValidINThisState(res Response) Response {
 	res.SetStatus("Method Not Valid in This State")
 	res.SetCode(455)
@@ -0,0 +1,201 @@
+package rtsp
+
+import (
+	"github.com/ChinasMr/kaka/pkg/log"
+	"gortc.io/sdp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultFailoverInterval = 3 * time.Second
+
+type failoverChannel struct {
+	name     string
+	interval time.Duration
+	backups  []string
+}
+
+// isPullURL reports whether the backup is pulled from the url,
+// otherwise it is the name of the channel the backup publishes to.
+func isPullURL(backup string) bool {
+	return strings.Contains(backup, "://")
+}
+
+// failover switches the channel between its primary source and the backups
+// by their priorities, the readers of the channel keep their sessions.
+type failover struct {
+	ch       *channel
+	interval time.Duration
+	backups  []*channel
+	log      *log.Helper
+	mu       sync.Mutex
+	// the index of the active source, the primary is 0.
+	active int
+	// the last time the sources sent a package.
+	seen []time.Time
+	// the description announced by the primary.
+	sdp *sdp.Message
+	raw []byte
+	// closed when the failover stops watching the sources.
+	done chan struct{}
+	// the packages of the backups dropped while the channel is behind.
+	dropped uint64
+	// the clock the sources are seen by.
+	now func() time.Time
+}
+
+func newFailover(ch *channel, interval time.Duration, backups []*channel, logger *log.Helper) *failover {
+	fo := &failover{
+		ch:       ch,
+		interval: interval,
+		backups:  backups,
+		log:      logger,
+		seen:     make([]time.Time, len(backups)+1),
+		now:      time.Now,
+	}
+	ch.fo = fo
+	for i, b := range backups {
+		b.backup = fo
+		b.rank = i + 1
+	}
+	return fo
+}
+
+func (f *failover) start() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.done != nil {
+		return
+	}
+	f.done = make(chan struct{})
+	go f.watch(f.done)
+}
+
+func (f *failover) stop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.done == nil {
+		return
+	}
+	close(f.done)
+	f.done = nil
+}
+
+// watch switch to the next source when the active one is silent.
+func (f *failover) watch(done chan struct{}) {
+	ticker := time.NewTicker(f.interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		f.mu.Lock()
+		f.check(f.now())
+		f.mu.Unlock()
+	}
+}
+
+// alive must be called with the lock held.
+func (f *failover) alive(i int, now time.Time) bool {
+	return !f.seen[i].IsZero() && now.Sub(f.seen[i]) <= f.interval
+}
+
+// check switch to the first alive source if the active one is not,
+// must be called with the lock held.
+func (f *failover) check(now time.Time) {
+	if f.alive(f.active, now) {
+		return
+	}
+	for i := range f.seen {
+		if f.alive(i, now) {
+			f.switchTo(i)
+			return
+		}
+	}
+}
+
+// switchTo must be called with the lock held.
+func (f *failover) switchTo(i int) {
+	if i == f.active {
+		return
+	}
+	f.log.Infof("channel %s switches from source %d to %d", f.ch.name, f.active, i)
+	f.active = i
+	desc, raw := f.sdp, f.raw
+	if i > 0 {
+		desc, raw = f.backups[i-1].SDP(), f.backups[i-1].Raw()
+	}
+	if len(raw) > 0 {
+		f.ch.describe(desc, raw)
+	}
+	f.ch.online()
+}
+
+// receive is called for every package of the ith source,
+// it returns whether the package should be delivered.
+func (f *failover) receive(i int) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := f.now()
+	f.seen[i] = now
+	// the source with the higher priority is back.
+	if i < f.active || !f.alive(f.active, now) {
+		f.switchTo(i)
+	}
+	return i == f.active
+}
+
+// relay the package of the backup to the channel if it is active,
+// the package is dropped rather than blocking the backup.
+func (f *failover) relay(i int, p *Package) {
+	if !f.receive(i) {
+		return
+	}
+	c := p.clone()
+	select {
+	case f.ch.relayed <- c:
+	default:
+		putPackage(c)
+		if atomic.AddUint64(&f.dropped, 1)%100 == 1 {
+			log.Debugf("channel %s dropped %d packages of the backups", f.ch.name, atomic.LoadUint64(&f.dropped))
+		}
+	}
+}
+
+// described is called when the primary announces,
+// it returns whether the description should be applied.
+func (f *failover) described(desc *sdp.Message, raw []byte) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sdp, f.raw = desc, raw
+	// the primary has the interval to send the first package.
+	f.seen[0] = f.now()
+	return f.active == 0
+}
+
+// lost is called when the ith source is gone,
+// it returns whether another source is active.
+func (f *failover) lost(i int) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.seen[i] = time.Time{}
+	if i == 0 {
+		f.sdp, f.raw = nil, nil
+	}
+	f.check(f.now())
+	return f.active != i
+}
+
+// sourceSDP returns the description announced by the primary.
+func (f *failover) sourceSDP() *sdp.Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.sdp == nil {
+		return &sdp.Message{}
+	}
+	return f.sdp
+}
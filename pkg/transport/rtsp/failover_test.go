@@ -0,0 +1,102 @@
+package rtsp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChinasMr/kaka/pkg/log"
+	"gortc.io/sdp"
+)
+
+func TestFailoverSwitch(t *testing.T) {
+	primary := newChannel("live", defaultChannelConfig)
+	backups := []*channel{newChannel("backup1", defaultChannelConfig), newChannel("backup2", defaultChannelConfig)}
+	fo := newFailover(primary, 3*time.Second, backups, log.NewHelper(log.DefaultLogger))
+	epoch := time.Now()
+	at := func(d time.Duration) {
+		fo.mu.Lock()
+		fo.now = func() time.Time {
+			return epoch.Add(d)
+		}
+		fo.mu.Unlock()
+	}
+	describe := func(name string) (*sdp.Message, []byte) {
+		t.Helper()
+		raw := []byte(strings.Replace(testSDP, "s=test", "s="+name, 1))
+		desc, err := decodeSDP(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return desc, raw
+	}
+	active := func(want int, name string) {
+		t.Helper()
+		fo.mu.Lock()
+		got := fo.active
+		fo.mu.Unlock()
+		if got != want || !strings.Contains(string(primary.Raw()), "s="+name) {
+			t.Fatalf("the source %d is active, want %d of %s:\n%s", got, want, name, primary.Raw())
+		}
+	}
+	for _, b := range backups {
+		b.describe(describe(b.name))
+	}
+
+	at(0)
+	if desc, raw := describe("primary"); !fo.described(desc, raw) {
+		t.Fatal("the description of the active primary is not applied")
+	}
+	primary.describe(describe("primary"))
+	at(time.Second)
+	if fo.receive(1) || !fo.receive(0) {
+		t.Fatal("the backup is delivered while the primary is alive")
+	}
+	active(0, "primary")
+
+	// the primary is silent for longer than the interval.
+	at(5 * time.Second)
+	if !fo.receive(1) || fo.receive(2) {
+		t.Fatal("the first backup is not delivered")
+	}
+	active(1, "backup1")
+	at(8 * time.Second)
+	if fo.receive(2) {
+		t.Fatal("the second backup is delivered while the first one is alive")
+	}
+	// the watch switches to the next alive backup.
+	at(9 * time.Second)
+	fo.mu.Lock()
+	fo.check(fo.now())
+	fo.mu.Unlock()
+	active(2, "backup2")
+
+	// the primary announces again, it is applied once its packages arrive.
+	at(10 * time.Second)
+	if desc, raw := describe("primary"); fo.described(desc, raw) {
+		t.Fatal("the description of the primary is applied while the backup is active")
+	}
+	active(2, "backup2")
+	if !fo.receive(0) {
+		t.Fatal("the primary back is not delivered")
+	}
+	active(0, "primary")
+	if fo.sourceSDP().Name != "primary" {
+		t.Fatalf("the source description %q", fo.sourceSDP().Name)
+	}
+
+	// the primary torn down switches to the alive backup at once.
+	at(11 * time.Second)
+	if !fo.lost(0) {
+		t.Fatal("no backup is active once the primary is lost")
+	}
+	active(2, "backup2")
+	if len(fo.sourceSDP().Medias) != 0 {
+		t.Fatal("the description of the lost primary is kept")
+	}
+	// no source is alive.
+	at(12 * time.Second)
+	if fo.lost(2) {
+		t.Fatal("another source is active")
+	}
+}
@@ -0,0 +1,284 @@
+package rtsp
+
+import (
+	"github.com/ChinasMr/kaka/pkg/log"
+	"github.com/ChinasMr/kaka/pkg/transport/rtsp/status"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// the bound forwarder is removed when its source is idle for the duration.
+	forwarderIdle = 30 * time.Second
+	// the forwarder of an unknown source is removed after the duration.
+	forwarderUnknownTTL = 5 * time.Second
+	// the max forwarders of the unknown sources, the packages
+	// of the other unknown sources are dropped.
+	maxUnknownForwarders = 256
+	// the packages queued for a forwarder, the newer ones are dropped when full.
+	forwarderQueueSize = 64
+)
+
+// forwarder delivers the packages from a udp source address
+// of the shared sockets to the channel of the session.
+type forwarder struct {
+	addr    *net.UDPAddr
+	order   int
+	input   chan *Package
+	output  chan *Package
+	done    chan struct{}
+	once    sync.Once
+	ch      Channel
+	tx      Transaction
+	session string
+	known   bool
+	// the source of a torn down session, its late packages
+	// are not taken for the first ones of another one behind the nat.
+	released bool
+	// reorder the rtp packages of the recording source.
+	jb *jitterBuffer
+	// the media of the session the source belongs to.
+	media *Media
+}
+
+func (f *forwarder) close() {
+	f.once.Do(func() {
+		close(f.done)
+	})
+}
+
+// stale reports whether the session of the bound forwarder is torn down.
+func (f *forwarder) stale() bool {
+	if f.tx.ID() != f.session {
+		return true
+	}
+	if f.ch != nil {
+		return f.ch.Source() != f.tx
+	}
+	return f.tx.Status() != status.PLAYING
+}
+
+func (t *transactionController) Forward(p *Package, addr *net.UDPAddr) {
+	t.fm.Lock()
+	f, ok := t.forwarders[addr.String()]
+	if !ok {
+		if t.unknown >= maxUnknownForwarders {
+			t.fm.Unlock()
+			putPackage(p)
+			return
+		}
+		f = &forwarder{
+			addr:  addr,
+			input: make(chan *Package, forwarderQueueSize),
+			done:  make(chan struct{}),
+		}
+		t.forwarders[addr.String()] = f
+		t.unknown++
+		go t.serve(f)
+	}
+	t.fm.Unlock()
+	// the shared sockets are never blocked by a source behind,
+	// the packages of every source are still delivered in order.
+	select {
+	case f.input <- p:
+	case <-f.done:
+		putPackage(p)
+	default:
+		putPackage(p)
+		if dropped := atomic.AddUint64(&t.dropped, 1); dropped%100 == 1 {
+			log.Debugf("drop the package from %s, %d dropped by the shared sockets", addr, dropped)
+		}
+	}
+}
+
+func (t *transactionController) serve(f *forwarder) {
+	timer := time.NewTimer(t.unknownTTL)
+	defer func() {
+		timer.Stop()
+		t.removeForwarder(f)
+		if f.jb != nil {
+			f.jb.close()
+		}
+		// return the pending packages to the pool.
+		for {
+			select {
+			case p := <-f.input:
+				putPackage(p)
+			default:
+				return
+			}
+		}
+	}()
+	for {
+		select {
+		case <-f.done:
+			return
+		case <-timer.C:
+			return
+		case p := <-f.input:
+			if f.tx != nil && f.stale() {
+				t.unbind(f)
+				f.released = true
+			}
+			if f.tx == nil {
+				// try to find the corrected channel, by the signaled
+				// address first, then the nat address.
+				if !t.bind(f, p, false) && (f.released || !t.bind(f, p, true)) {
+					// can not find relative ch.
+					putPackage(p)
+					continue
+				}
+			}
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(t.idle)
+			if f.media.muxed(p) {
+				p.Ch = 1
+			}
+			if f.output == nil {
+				// the rtcp feedback of the reader.
+				if f.ch == nil && p.Ch == 1 {
+					f.tx.Feedback(f.media, p.Data[:p.Len])
+				}
+				putPackage(p)
+				continue
+			}
+			if !f.media.unprotect(p, p.Ch == 1) {
+				putPackage(p)
+				continue
+			}
+			p.Order = f.order
+			if f.jb != nil {
+				f.jb.push(p)
+				continue
+			}
+			f.output <- p
+		}
+	}
+}
+
+// bind the forwarder to the recording media the package belongs to,
+// the package of the playing media is accepted for learning the address only.
+func (t *transactionController) bind(f *forwarder, p *Package, nat bool) bool {
+	data := p.Data[:p.Len]
+	rtcp := p.Ch == 1
+	for _, ch := range t.ListCh() {
+		source := ch.Source()
+		if source == nil {
+			continue
+		}
+		if m := match(source, true, f.addr, rtcp, data, nat); m != nil {
+			f.output = ch.Input()
+			f.order = m.order
+			f.media = m
+			if t.cc.latency > 0 {
+				f.jb = newJitterBuffer(t.cc.latency, f.output)
+			}
+			t.known(f, ch, source)
+			return true
+		}
+	}
+	t.rwm.RLock()
+	var player Transaction
+	for _, tx := range t.txs {
+		if tx.Status() != status.PLAYING || tx.Interleaved() {
+			continue
+		}
+		if m := match(tx, false, f.addr, rtcp, data, nat); m != nil {
+			player = tx
+			f.order = m.order
+			f.media = m
+			break
+		}
+	}
+	t.rwm.RUnlock()
+	if player == nil {
+		return false
+	}
+	t.known(f, nil, player)
+	return true
+}
+
+// match returns the udp media of the session the package from the addr belongs to,
+// by the signaled address, or learned behind the nat if nat is true.
+func match(tx Transaction, record bool, addr *net.UDPAddr, rtcp bool, data []byte, nat bool) *Media {
+	var medias []*Media
+	for _, m := range tx.Medias() {
+		if m.interleaved || record && !m.record {
+			continue
+		}
+		if !nat && m.accept(addr, tx.IP(), rtcp, data, false) {
+			return m
+		}
+		medias = append(medias, m)
+	}
+	if !nat {
+		return nil
+	}
+	return learn(medias, addr, tx.IP(), rtcp, data)
+}
+
+// known mark the forwarder bound to the session.
+func (t *transactionController) known(f *forwarder, ch Channel, tx Transaction) {
+	t.fm.Lock()
+	defer t.fm.Unlock()
+	f.ch = ch
+	f.tx = tx
+	f.session = tx.ID()
+	if !f.known {
+		f.known = true
+		t.unknown--
+	}
+}
+
+func (t *transactionController) unbind(f *forwarder) {
+	t.fm.Lock()
+	defer t.fm.Unlock()
+	f.output = nil
+	f.media = nil
+	if f.jb != nil {
+		f.jb.close()
+		f.jb = nil
+	}
+	f.ch = nil
+	f.tx = nil
+	f.session = ""
+	if f.known {
+		f.known = false
+		t.unknown++
+	}
+}
+
+func (t *transactionController) removeForwarder(f *forwarder) {
+	t.fm.Lock()
+	defer t.fm.Unlock()
+	if t.forwarders[f.addr.String()] == f {
+		delete(t.forwarders, f.addr.String())
+		if !f.known {
+			t.unknown--
+		}
+	}
+	f.close()
+}
+
+// removeForwarders remove the forwarders bound to the session.
+func (t *transactionController) removeForwarders(session string) {
+	t.fm.Lock()
+	defer t.fm.Unlock()
+	for key, f := range t.forwarders {
+		if f.session != session {
+			continue
+		}
+		delete(t.forwarders, key)
+		if !f.known {
+			t.unknown--
+		}
+		f.close()
+	}
+}
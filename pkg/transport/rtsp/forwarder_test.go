@@ -0,0 +1,87 @@
+package rtsp
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// forwarderCounts returns the number of the forwarders and the unknown ones.
+func forwarderCounts(tc *transactionController) (int, int) {
+	tc.fm.Lock()
+	defer tc.fm.Unlock()
+	return len(tc.forwarders), tc.unknown
+}
+
+func TestForwarderUnknownExpiry(t *testing.T) {
+	tc := newTransactionController(defaultChannelConfig, "live").(*transactionController)
+	tc.fm.Lock()
+	tc.unknownTTL = 100 * time.Millisecond
+	tc.fm.Unlock()
+	// the forwarders of the unknown sources are capped.
+	for i := 0; i < maxUnknownForwarders+10; i++ {
+		tc.Forward(rtpPackage(0, uint16(i)), &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 20000 + i})
+	}
+	if n, unknown := forwarderCounts(tc); n != maxUnknownForwarders || unknown != maxUnknownForwarders {
+		t.Fatalf("%d forwarders of %d unknown sources", n, unknown)
+	}
+	// and removed once expired.
+	waitFor(t, "the unknown forwarders expired", func() bool {
+		n, unknown := forwarderCounts(tc)
+		return n == 0 && unknown == 0
+	})
+	tc.Forward(rtpPackage(0, 0), &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 30000})
+	if n, unknown := forwarderCounts(tc); n != 1 || unknown != 1 {
+		t.Fatalf("%d forwarders of %d unknown sources after expired", n, unknown)
+	}
+}
+
+func TestForwarderIdleExpiry(t *testing.T) {
+	s, addr := newTestServer(t)
+	tc := s.tc.(*transactionController)
+	tc.fm.Lock()
+	tc.idle = 500 * time.Millisecond
+	tc.fm.Unlock()
+	pub := publishClient(t, addr, "live", false)
+	defer pub.Close()
+	bound := func() bool {
+		n, unknown := forwarderCounts(tc)
+		return n > 0 && unknown == 0
+	}
+	send := func() {
+		t.Helper()
+		for seq := uint16(0); seq < 3; seq++ {
+			if err := writeTestPackage(pub, 0, seq); err != nil {
+				t.Fatal(err)
+			}
+		}
+		waitFor(t, "the bound forwarder", bound)
+	}
+	send()
+	// the bound forwarder is kept while its source sends.
+	for i := 0; i < 5; i++ {
+		time.Sleep(tc.idle / 2)
+		if err := writeTestPackage(pub, 0, uint16(10+i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bound() {
+		t.Fatal("the forwarder of the active source is removed")
+	}
+	waitFor(t, "the idle forwarder removed", func() bool {
+		n, _ := forwarderCounts(tc)
+		return n == 0
+	})
+
+	// the forwarders of the session are removed once it is torn down.
+	send()
+	begin := time.Now()
+	_ = pub.Close()
+	waitFor(t, "the forwarder of the torn down session removed", func() bool {
+		n, _ := forwarderCounts(tc)
+		return n == 0
+	})
+	if elapsed := time.Since(begin); elapsed >= tc.idle/2 {
+		t.Fatalf("the forwarder of the torn down session is removed after %v", elapsed)
+	}
+}
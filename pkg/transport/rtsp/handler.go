@@ -1,9 +1,12 @@
 package rtsp
 
 import (
+	"context"
 	"github.com/ChinasMr/kaka/pkg/log"
 	"github.com/ChinasMr/kaka/pkg/transport/rtsp/header"
+	"gortc.io/sdp"
 	"io"
+	"math"
 	"strings"
 )
 
@@ -33,6 +36,14 @@ type minimalHandler interface {
 type UnimplementedServerHandler struct {
 	tc TransactionController
 	hs []string
+	mp *multicastPool
+	pp *portPool
+	// the size of the retransmission buffer of the udp reader medias.
+	nack int
+	// the readers play by srtp.
+	srtp bool
+	// the mp4 files played on demand, nil if disabled.
+	vod *vodLibrary
 }
 
 func (u *UnimplementedServerHandler) OPTIONS(req Request, res Response, tx Transaction) error {
@@ -63,10 +74,20 @@ func (u *UnimplementedServerHandler) ANNOUNCE(req Request, res Response, tx Tran
 
 func (u *UnimplementedServerHandler) DESCRIBE(req Request, res Response, tx Transaction) error {
 	log.Debugf("describe request url: %s", req.URL().String())
+	if name, _, ok := u.vodPath(req); ok {
+		return u.describeVOD(req, res, tx, name)
+	}
 	ch, ok := u.tc.GetCh(req.Channel())
 	if !ok {
 		return tx.Response(ErrInternal(res))
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), pullTimeout)
+	err := ch.Pull(ctx)
+	cancel()
+	if err != nil {
+		log.Errorf("can not pull the source of channel %s: %v", req.Channel(), err)
+		return tx.Response(ErrInternal(res))
+	}
 	raw := ch.Raw()
 	if len(raw) == 0 {
 		return tx.Response(ErrInternal(res))
@@ -78,8 +99,17 @@ func (u *UnimplementedServerHandler) DESCRIBE(req Request, res Response, tx Tran
 
 func (u *UnimplementedServerHandler) SETUP(req Request, res Response, tx Transaction) error {
 	log.Debugf("setup request url: %s", req.URL().String())
+	if name, stream, ok := u.vodPath(req); ok {
+		return u.setupVOD(req, res, tx, name, stream)
+	}
 	tr, _ := req.Transport()
-	if tr.Multicast() {
+	// the multicast is available for playing only.
+	if tr.Multicast() && (u.mp == nil || tr.Record()) {
+		return tx.Response(ErrUnsupportedTransport(res))
+	}
+	// the secure rtp is available for the unicast only,
+	// and for the readers if it is enabled.
+	if tr.Secure() && (tr.Multicast() || !tr.Record() && !u.srtp) {
 		return tx.Response(ErrUnsupportedTransport(res))
 	}
 
@@ -87,41 +117,70 @@ func (u *UnimplementedServerHandler) SETUP(req Request, res Response, tx Transac
 	if !ok {
 		return tx.Response(ErrInternal(res))
 	}
-	for _, m := range ch.SDP().Medias {
+	// the recording session sets up the description it announced.
+	desc := ch.SDP()
+	if tr.Record() {
+		desc = ch.SourceSDP()
+	}
+	for i, m := range desc.Medias {
 		stream := m.Attribute("control")
 		if stream == req.Stream() {
-			// add tcp stream.
-			if p1, p2, ok1 := tr.Interleaved(); ok1 && tr.LowerTransportTCP() {
-				log.Debugf("rtp tpc channel: %d, rtcp tpc channel: %d", p1, p2)
-				tx.AddMedia(&Media{
-					interleaved: true,
-					rtp:         p1,
-					rtcp:        p2,
-					control:     stream,
-					record:      tr.Record(),
-				})
-				res.SetHeader(header.Transport,
-					header.NewTransportHeader(header.LowerTransTCP,
-						header.ParamUnicast,
-						header.NewInterleavedParam(p1, p1),
-					))
+			var secure *secureMedia
+			if tr.Secure() {
+				var err error
+				secure, err = newSecureMedia(req, res, desc, m, tr.Record(), tx.Secure())
+				if err != nil {
+					log.Errorf("can not set up srtp: %v", err)
+					return tx.Response(ErrUnsupportedTransport(res))
+				}
 			}
-			// add udp stream.
-			if p1, p2, ok1 := tr.ClientPort(); ok1 && !tr.LowerTransportTCP() {
-				log.Debugf("rtp udp port: %d, rtcp udp port: %d", p1, p2)
+			// add multicast stream.
+			if tr.Multicast() {
+				group, err := ch.Multicast(i, u.mp)
+				if err != nil {
+					log.Errorf("can not allocate multicast group: %v", err)
+					return tx.Response(ErrUnsupportedTransport(res))
+				}
+				log.Debugf("rtp multicast group: %s", group)
 				tx.AddMedia(&Media{
-					interleaved: false,
-					rtp:         p1,
-					rtcp:        p2,
-					control:     stream,
-					record:      tr.Record(),
+					multicast: true,
+					rtp:       group.Port,
+					rtcp:      group.Port + 1,
+					control:   stream,
 				})
+				params := []string{header.ParamMulticast}
+				// rtsp 2.0 signals the group by dest_addr.
+				if req.Proto() == Version2 {
+					params = append(params, header.NewDestAddr(group.IP.String(), group.Port, group.Port+1))
+				} else {
+					params = append(params,
+						header.NewDestination(group.IP.String()),
+						header.NewPort(group.Port, group.Port+1),
+					)
+				}
 				res.SetHeader(header.Transport,
 					header.NewTransportHeader(header.LoweTransUDP,
-						header.ParamUnicast,
-						header.NewClientPort(p1, p2),
-						header.NewServerPort(tx.RTP(), tx.RTCP()),
+						append(params, header.NewTTL(u.mp.ttl))...))
+			}
+			if !tr.Multicast() && !u.setupUnicast(req, res, tx, tr, m, secure) {
+				return tx.Response(ErrUnsupportedTransport(res))
+			}
+			// the live stream can not be seeked unless it is time-shifted, rfc 7826.
+			if req.Proto() == Version2 && !tr.Record() {
+				res.SetHeader(header.AcceptRanges, "npt, smpte, clock")
+				if window := ch.ShiftWindow(); window > 0 {
+					res.SetHeader(header.MediaProperties, header.NewMediaProperties(
+						header.PropRandomAccess,
+						header.PropTimeProgressing,
+						header.PropTimeDuration+"="+header.FormatFloat(window.Seconds()),
 					))
+				} else {
+					res.SetHeader(header.MediaProperties, header.NewMediaProperties(
+						header.PropNoSeeking,
+						header.PropTimeProgressing,
+						header.PropTimeDuration+"=0.0",
+					))
+				}
 			}
 
 			// send response.
@@ -130,7 +189,7 @@ func (u *UnimplementedServerHandler) SETUP(req Request, res Response, tx Transac
 				return err
 			}
 			// refresh the session status.
-			ok = tx.PreReady(ch.SDP())
+			ok = tx.PreReady(desc)
 			if ok {
 				log.Debugf("session setup complete")
 			}
@@ -141,8 +200,112 @@ func (u *UnimplementedServerHandler) SETUP(req Request, res Response, tx Transac
 	return tx.Response(ErrInternal(res))
 }
 
+// setupUnicast add the tcp or udp media of the session and answer its transport,
+// it returns false if the server ports of the media can not be allocated.
+func (u *UnimplementedServerHandler) setupUnicast(req Request, res Response, tx Transaction, tr header.TransportHeader, m sdp.Media, secure *secureMedia) bool {
+	stream := m.Attribute("control")
+	// add tcp stream.
+	if p1, p2, ok1 := tr.Interleaved(); ok1 && tr.LowerTransportTCP() {
+		log.Debugf("rtp tpc channel: %d, rtcp tpc channel: %d", p1, p2)
+		tx.AddMedia(&Media{
+			interleaved: true,
+			rtp:         p1,
+			rtcp:        p2,
+			control:     stream,
+			record:      tr.Record(),
+			secure:      secure,
+		})
+		profile := header.LowerTransTCP
+		if secure != nil {
+			profile = header.SecureTransTCP
+		}
+		res.SetHeader(header.Transport,
+			header.NewTransportHeader(profile,
+				header.ParamUnicast,
+				header.NewInterleavedParam(p1, p2),
+			))
+	}
+	// add udp stream.
+	if p1, p2, ok1 := tr.ClientPort(); ok1 && !tr.LowerTransportTCP() && !tr.Multicast() {
+		log.Debugf("rtp udp port: %d, rtcp udp port: %d", p1, p2)
+		media := &Media{
+			interleaved: false,
+			rtp:         p1,
+			rtcp:        p2,
+			control:     stream,
+			record:      tr.Record(),
+			secure:      secure,
+			mux:         tr.RTCPMux(),
+			payloads:    payloadTypes(m),
+		}
+		// the ssrc of the play request is the one of the server,
+		// so only the recording one validates the packages.
+		if ssrc, has := tr.SSRC(); has && tr.Record() {
+			media.ssrc, media.hasSSRC = ssrc, true
+		}
+		// the reader resends the lost packages by the nack,
+		// in the rtx format only if it opts in by the transport.
+		if u.nack > 0 && !tr.Record() {
+			var rtx map[uint8]uint8
+			if tr.RTX() {
+				rtx = rtxTypes(m)
+			}
+			media.nack = newRetransmitter(u.nack, rtx)
+		}
+		var serverRTP, serverRTCP int
+		// allocate the server ports of the media,
+		// otherwise the shared sockets are used.
+		if u.pp == nil {
+			serverRTP, serverRTCP = tx.RTP(), tx.RTCP()
+		} else {
+			pair, err := u.pp.alloc(media.mux)
+			if err != nil {
+				log.Errorf("can not allocate server ports: %v", err)
+				return false
+			}
+			media.pair = pair
+			pair.bind(media, tx.IP())
+			serverRTP, serverRTCP = pair.rtpPort, pair.rtcpPort
+		}
+		tx.AddMedia(media)
+		profile := header.LoweTransUDP
+		if secure != nil {
+			profile = header.SecureTransUDP
+		}
+		params := []string{header.ParamUnicast}
+		// the muxed media is answered by the single rtp port.
+		if media.mux {
+			serverRTCP = serverRTP
+		}
+		// rtsp 2.0 signals the ports by src_addr and dest_addr.
+		if req.Proto() == Version2 {
+			params = append(params,
+				header.NewDestAddr(tx.IP().String(), p1, p2),
+				header.NewSrcAddr(serverRTP, serverRTCP),
+			)
+		} else {
+			params = append(params,
+				header.NewClientPort(p1, p2),
+				header.NewServerPort(serverRTP, serverRTCP),
+			)
+		}
+		if media.mux {
+			params = append(params, header.ParamRTCPMux)
+		}
+		if media.nack != nil && len(media.nack.rtx) > 0 {
+			params = append(params, header.ParamRTX)
+		}
+		res.SetHeader(header.Transport,
+			header.NewTransportHeader(profile, params...))
+	}
+	return true
+}
+
 func (u *UnimplementedServerHandler) PLAY(req Request, res Response, tx Transaction) error {
 	log.Debugf("play request url: %s", req.URL().String())
+	if _, _, ok := u.vodPath(req); ok {
+		return u.playVOD(req, res, tx)
+	}
 	ch, ok := u.tc.GetCh(req.Channel())
 	if !ok {
 		return tx.Response(ErrInternal(res))
@@ -151,6 +314,36 @@ func (u *UnimplementedServerHandler) PLAY(req Request, res Response, tx Transact
 	if !ok {
 		return tx.Response(ErrInternal(res))
 	}
+	// the live stream plays from now at the normal rate,
+	// or from the past by the clock if the channel is time-shifted.
+	played := header.TimeRange{Unit: header.RangeNPT, Now: true}
+	scale, speed := 1.0, 1.0
+	rng, hasRange := req.Range()
+	if hasRange && rng.Unit == header.RangeClock && rng.HasStart {
+		if v, has := req.Scale(); has {
+			scale = clampRate(v)
+		}
+		if lo, hi, has := req.Speed(); has {
+			speed = clampRate(math.Min(math.Max(1, lo), hi))
+		}
+		if start, shifted := ch.TimeShift(tx, rng.StartTime, scale*speed); shifted {
+			played = header.TimeRange{Unit: header.RangeClock, StartTime: start, HasStart: true}
+		} else {
+			scale, speed = 1, 1
+		}
+	}
+	if info := rtpInfo(req, ch, tx); info != "" {
+		res.SetHeader(header.RTPInfo, info)
+	}
+	if hasRange || req.Proto() == Version2 {
+		res.SetHeader(header.Range, played.String())
+	}
+	if _, ok := req.Scale(); ok {
+		res.SetHeader(header.Scale, header.FormatFloat(scale))
+	}
+	if _, _, ok := req.Speed(); ok {
+		res.SetHeader(header.Speed, header.FormatFloat(speed))
+	}
 	err := tx.Response(res)
 	if err != nil {
 		return err
@@ -160,6 +353,15 @@ func (u *UnimplementedServerHandler) PLAY(req Request, res Response, tx Transact
 	return ch.Play(tx)
 }
 
+// PAUSE is available for the mp4 files played on demand, the live stream can not be paused.
+func (u *UnimplementedServerHandler) PAUSE(req Request, res Response, tx Transaction) error {
+	log.Debugf("pause request url: %s", req.URL().String())
+	if _, _, ok := u.vodPath(req); ok {
+		return u.pauseVOD(req, res, tx)
+	}
+	return tx.Response(ErrMethodNotAllowed(res))
+}
+
 func (u *UnimplementedServerHandler) RECORD(req Request, res Response, tx Transaction) error {
 	log.Debugf("record request url: %s", req.URL().String())
 	ch, ok := u.tc.GetCh(req.Channel())
@@ -170,7 +372,7 @@ func (u *UnimplementedServerHandler) RECORD(req Request, res Response, tx Transa
 	if !ok {
 		return tx.Response(ErrInternal(res))
 	}
-	ok = tx.PreRecord(ch.SDP())
+	ok = tx.PreRecord(ch.SourceSDP())
 	if !ok {
 		return tx.Response(ErrInternal(res))
 	}
@@ -179,10 +381,13 @@ func (u *UnimplementedServerHandler) RECORD(req Request, res Response, tx Transa
 		return err
 	}
 	// if is interleaved, fun recordServe serve
-	// and blocked until err.
+	// and blocked until err or a request in between.
 	// if is udp, fun recordServe just return.
 	err = ch.Record(tx)
 	if err != nil {
+		if err == errInterleavedRequest {
+			return nil
+		}
 		if err == io.EOF {
 			return err
 		}
@@ -193,6 +398,9 @@ func (u *UnimplementedServerHandler) RECORD(req Request, res Response, tx Transa
 
 func (u *UnimplementedServerHandler) TEARDOWN(req Request, res Response, tx Transaction) error {
 	log.Debugf("teardown request url: %s", req.URL().String())
+	if _, _, ok := u.vodPath(req); ok {
+		return u.teardownVOD(req, res, tx)
+	}
 	ch, ok := u.tc.GetCh(req.Channel())
 	if !ok {
 		return tx.Response(ErrInternal(res))
@@ -200,3 +408,29 @@ func (u *UnimplementedServerHandler) TEARDOWN(req Request, res Response, tx Tran
 	_ = ch.Teardown(tx)
 	return tx.Response(res)
 }
+
+// rtpInfo returns the rtp info header of the medias the session set up,
+// ordered by the medias of the sdp.
+func rtpInfo(req Request, ch Channel, tx Transaction) string {
+	medias := tx.Medias()
+	infos := ch.RTPInfo(tx)
+	base := strings.TrimSuffix(req.URL().String(), "/")
+	rv := make([]string, 0, len(medias))
+	for i, m := range ch.SDP().Medias {
+		control := m.Attribute("control")
+		media, ok := medias[control]
+		if !ok {
+			continue
+		}
+		info, ok := infos[media.order]
+		if !ok || i != media.order {
+			continue
+		}
+		url := control
+		if !strings.Contains(control, "://") {
+			url = base + "/" + control
+		}
+		rv = append(rv, header.NewRTPInfo(url, info.Seq, info.RTPTime))
+	}
+	return header.JoinRTPInfo(rv...)
+}
@@ -1,8 +1,50 @@
 package header
 
+import "strings"
+
+const (
+	Public          = "Public"
+	ContentType     = "Content-Type"
+	ContentLength   = "Content-Length"
+	ContentBase     = "Content-Base"
+	Session         = "Session"
+	Transport       = "Transport"
+	CSeq            = "CSeq"
+	Authorization   = "Authorization"
+	WWWAuthenticate = "WWW-Authenticate"
+	Location        = "Location"
+	UserAgent       = "User-Agent"
+	Accept          = "Accept"
+	RTPInfo         = "RTP-Info"
+	KeyMgmt         = "KeyMgmt"
+	// the headers of rtsp 2.0, rfc 7826.
+	AcceptRanges      = "Accept-Ranges"
+	MediaProperties   = "Media-Properties"
+	PipelinedRequests = "Pipelined-Requests"
+	NotifyReason      = "Notify-Reason"
+	Range             = "Range"
+	Scale             = "Scale"
+	Speed             = "Speed"
+)
+
+// the media properties of the live and the on demand streams.
 const (
-	Public      = "Public"
-	ContentType = "Content-Type"
-	Session     = "Session"
-	Transport   = "Transport"
+	PropNoSeeking       = "No-Seeking"
+	PropTimeProgressing = "Time-Progressing"
+	PropTimeDuration    = "Time-Duration"
+	PropRandomAccess    = "Random-Access"
+	PropImmutable       = "Immutable"
+	PropUnlimited       = "Unlimited"
 )
+
+// the notify reasons of PLAY_NOTIFY.
+const (
+	NotifyEndOfStream      = "end-of-stream"
+	NotifyMediaPropsUpdate = "media-properties-update"
+	NotifyScaleChange      = "scale-change"
+)
+
+// NewMediaProperties join the media properties, eg: No-Seeking, Time-Progressing.
+func NewMediaProperties(props ...string) string {
+	return strings.Join(props, ", ")
+}
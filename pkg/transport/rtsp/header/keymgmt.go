@@ -0,0 +1,35 @@
+package header
+
+import (
+	"fmt"
+	"strings"
+)
+
+const ProtMIKEY = "mikey"
+
+// NewKeyMgmt returns the key management header of the data by the protocol for the url.
+func NewKeyMgmt(prot string, uri string, data string) string {
+	return fmt.Sprintf("prot=%s; uri=\"%s\"; data=\"%s\"", prot, uri, data)
+}
+
+// ParseKeyMgmt returns the key management data of the protocol,
+// eg: prot=mikey; uri="rtsp://host/live/streamid=0"; data="base64"
+func ParseKeyMgmt(raw string, prot string) (string, bool) {
+	var p, data string
+	for _, part := range strings.Split(raw, ";") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch strings.ToLower(kv[0]) {
+		case "prot":
+			p = strings.ToLower(kv[1])
+		case "data":
+			data = strings.Trim(kv[1], "\"")
+		}
+	}
+	if p != prot || data == "" {
+		return "", false
+	}
+	return data, true
+}
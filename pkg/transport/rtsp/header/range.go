@@ -0,0 +1,307 @@
+package header
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the units of the range.
+const (
+	RangeNPT   = "npt"
+	RangeSMPTE = "smpte"
+	RangeClock = "clock"
+)
+
+const (
+	clockLayout = "20060102T150405Z"
+	// the clock range keeps the fraction of the second if any.
+	clockRangeLayout = "20060102T150405.999Z"
+)
+
+// TimeRange is the Range header, rfc 2326 section 3.5-3.7 and 12.29.
+// The npt and smpte ranges are the offsets from the beginning of the
+// presentation, the clock range is the absolute time.
+type TimeRange struct {
+	// the unit, eg: npt, clock, smpte, smpte-25, smpte-30-drop.
+	Unit string
+	// the live range starts now, eg: npt=now-
+	Now bool
+	// the offsets of the npt and smpte ranges.
+	Start time.Duration
+	End   time.Duration
+	// the time of the clock range.
+	StartTime time.Time
+	EndTime   time.Time
+	HasStart  bool
+	HasEnd    bool
+	// the time the range takes effect, eg: ;time=19970123T143720Z
+	Time time.Time
+}
+
+// NewNPTRange returns the npt range from the start, the end is open if negative.
+func NewNPTRange(start time.Duration, end time.Duration) TimeRange {
+	return TimeRange{
+		Unit:     RangeNPT,
+		Start:    start,
+		End:      end,
+		HasStart: true,
+		HasEnd:   end >= 0,
+	}
+}
+
+// ParseRange parse the range in npt, smpte or clock format,
+// eg: npt=10-15.5, smpte-25=10:07:00-10:07:33:05.01, clock=19961108T142300Z-
+func ParseRange(raw string) (TimeRange, error) {
+	spec, params, _ := strings.Cut(raw, ";")
+	rv := TimeRange{}
+	for _, param := range strings.Split(params, ";") {
+		k, v, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if ok && k == "time" {
+			t, err := time.Parse(clockLayout, v)
+			if err != nil {
+				return TimeRange{}, fmt.Errorf("invalid range time: %s", v)
+			}
+			rv.Time = t
+		}
+	}
+	unit, value, ok := strings.Cut(strings.TrimSpace(spec), "=")
+	if !ok {
+		return TimeRange{}, fmt.Errorf("invalid range: %s", raw)
+	}
+	rv.Unit = strings.ToLower(unit)
+	start, end, ok := strings.Cut(value, "-")
+	if !ok || start == "" && end == "" {
+		return TimeRange{}, fmt.Errorf("invalid range: %s", raw)
+	}
+	rv.HasStart, rv.HasEnd = start != "", end != ""
+	var err error
+	switch {
+	case rv.Unit == RangeNPT:
+		if start == "now" {
+			rv.Now, rv.HasStart = true, false
+		} else if rv.HasStart {
+			rv.Start, err = parseNPT(start)
+		}
+		if err == nil && rv.HasEnd {
+			rv.End, err = parseNPT(end)
+		}
+	case strings.HasPrefix(rv.Unit, RangeSMPTE):
+		if rv.HasStart {
+			rv.Start, err = parseSMPTE(start, rv.Unit)
+		}
+		if err == nil && rv.HasEnd {
+			rv.End, err = parseSMPTE(end, rv.Unit)
+		}
+	case rv.Unit == RangeClock:
+		if rv.HasStart {
+			rv.StartTime, err = parseClock(start)
+		}
+		if err == nil && rv.HasEnd {
+			rv.EndTime, err = parseClock(end)
+		}
+	default:
+		return TimeRange{}, fmt.Errorf("unsupported range unit: %s", unit)
+	}
+	if err != nil {
+		return TimeRange{}, err
+	}
+	if rv.HasStart && rv.HasEnd && (rv.End < rv.Start || rv.EndTime.Before(rv.StartTime)) {
+		return TimeRange{}, fmt.Errorf("invalid range: %s", raw)
+	}
+	return rv, nil
+}
+
+func (r TimeRange) String() string {
+	var start, end string
+	switch {
+	case r.Unit == RangeClock:
+		if r.HasStart {
+			start = r.StartTime.UTC().Format(clockRangeLayout)
+		}
+		if r.HasEnd {
+			end = r.EndTime.UTC().Format(clockRangeLayout)
+		}
+	case strings.HasPrefix(r.Unit, RangeSMPTE):
+		if r.HasStart {
+			start = formatSMPTE(r.Start, r.Unit)
+		}
+		if r.HasEnd {
+			end = formatSMPTE(r.End, r.Unit)
+		}
+	default:
+		if r.Now {
+			start = "now"
+		} else if r.HasStart {
+			start = formatNPT(r.Start)
+		}
+		if r.HasEnd {
+			end = formatNPT(r.End)
+		}
+	}
+	rv := fmt.Sprintf("%s=%s-%s", r.Unit, start, end)
+	if !r.Time.IsZero() {
+		rv += ";time=" + r.Time.UTC().Format(clockLayout)
+	}
+	return rv
+}
+
+// parseNPT parse the npt time in seconds or hh:mm:ss, eg: 123.45, 1:02:03.5
+func parseNPT(v string) (time.Duration, error) {
+	parts := strings.Split(v, ":")
+	if len(parts) != 1 && len(parts) != 3 {
+		return 0, fmt.Errorf("invalid npt time: %s", v)
+	}
+	var seconds float64
+	for i, part := range parts {
+		f, err := strconv.ParseFloat(part, 64)
+		if err != nil || f < 0 || i > 0 && i < len(parts)-1 && f >= 60 {
+			return 0, fmt.Errorf("invalid npt time: %s", v)
+		}
+		seconds = seconds*60 + f
+	}
+	d, ok := toDuration(seconds)
+	if !ok {
+		return 0, fmt.Errorf("invalid npt time: %s", v)
+	}
+	return d, nil
+}
+
+// toDuration convert the seconds to the duration, it fails
+// if the seconds are not a number or out of the range of the duration.
+func toDuration(seconds float64) (time.Duration, bool) {
+	if math.IsNaN(seconds) || seconds < 0 || seconds >= math.MaxInt64/float64(time.Second) {
+		return 0, false
+	}
+	return time.Duration(seconds * float64(time.Second)), true
+}
+
+func formatNPT(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+// smpteRate returns the frames per second of the smpte unit, and whether
+// the frame numbers are dropped, eg: smpte-30-drop.
+func smpteRate(unit string) (int, bool) {
+	switch unit {
+	case "smpte-25":
+		return 25, false
+	case "smpte-30-drop":
+		return 30, true
+	}
+	return 30, false
+}
+
+// parseSMPTE parse the smpte time code hh:mm:ss[:frames[.subframes]].
+func parseSMPTE(v string, unit string) (time.Duration, error) {
+	parts := strings.Split(v, ":")
+	if len(parts) != 3 && len(parts) != 4 {
+		return 0, fmt.Errorf("invalid smpte time: %s", v)
+	}
+	fps, drop := smpteRate(unit)
+	var fields [3]int
+	for i := 0; i < 3; i++ {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil || n < 0 || i > 0 && n >= 60 {
+			return 0, fmt.Errorf("invalid smpte time: %s", v)
+		}
+		fields[i] = n
+	}
+	var frames float64
+	if len(parts) == 4 {
+		f, sub, _ := strings.Cut(parts[3], ".")
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 0 || n >= fps {
+			return 0, fmt.Errorf("invalid smpte time: %s", v)
+		}
+		frames = float64(n)
+		if sub != "" {
+			s, err := strconv.Atoi(sub)
+			if err != nil || s < 0 || s >= 100 {
+				return 0, fmt.Errorf("invalid smpte time: %s", v)
+			}
+			frames += float64(s) / 100
+		}
+	}
+	h, m, s := fields[0], fields[1], fields[2]
+	frames += (float64(h)*3600 + float64(m*60+s)) * float64(fps)
+	seconds := frames / float64(fps)
+	if drop {
+		// the frame numbers 0 and 1 are dropped every minute except
+		// every tenth one, at 29.97 frames per second.
+		minutes := float64(h)*60 + float64(m)
+		frames -= 2 * (minutes - math.Floor(minutes/10))
+		seconds = frames * 1001 / 30000
+	}
+	d, ok := toDuration(seconds)
+	if !ok {
+		return 0, fmt.Errorf("invalid smpte time: %s", v)
+	}
+	return d, nil
+}
+
+func formatSMPTE(d time.Duration, unit string) string {
+	fps, drop := smpteRate(unit)
+	var frames int
+	if drop {
+		frames = int(math.Round(d.Seconds() * 30000 / 1001))
+		// add back the dropped frame numbers, 17982 frames per 10 minutes.
+		tens, rest := frames/17982, frames%17982
+		frames += 18 * tens
+		if rest > 1 {
+			frames += 2 * ((rest - 2) / 1798)
+		}
+	} else {
+		frames = int(math.Round(d.Seconds() * float64(fps)))
+	}
+	f := frames % fps
+	seconds := frames / fps
+	return fmt.Sprintf("%02d:%02d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60, f)
+}
+
+// parseClock parse the utc time, eg: 19961108T142300Z, 19961108T142300.25Z
+func parseClock(v string) (time.Time, error) {
+	t, err := time.Parse("20060102T150405.999999999Z", v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid clock time: %s", v)
+	}
+	return t, nil
+}
+
+// maxRate bounds the Scale and Speed values, so the
+// durations played at the rate do not overflow.
+const maxRate = 1e6
+
+// ParseScale parse the Scale header, the negative scale plays backward.
+func ParseScale(raw string) (float64, error) {
+	v, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+	if err != nil || v == 0 || math.IsNaN(v) || math.Abs(v) > maxRate {
+		return 0, fmt.Errorf("invalid scale: %s", raw)
+	}
+	return v, nil
+}
+
+// ParseSpeed parse the Speed header, it is a single speed of rtsp 1.0,
+// or the lower and upper bounds of rtsp 2.0, eg: 1.0-2.5
+func ParseSpeed(raw string) (float64, float64, error) {
+	lo, hi, ok := strings.Cut(strings.TrimSpace(raw), "-")
+	min, err := strconv.ParseFloat(lo, 64)
+	if err != nil || min <= 0 || math.IsNaN(min) || min > maxRate {
+		return 0, 0, fmt.Errorf("invalid speed: %s", raw)
+	}
+	if !ok {
+		return min, min, nil
+	}
+	max, err := strconv.ParseFloat(hi, 64)
+	if err != nil || max < min || math.IsNaN(max) || max > maxRate {
+		return 0, 0, fmt.Errorf("invalid speed: %s", raw)
+	}
+	return min, max, nil
+}
+
+// FormatFloat format the Scale and Speed header values, eg: 1.5
+func FormatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
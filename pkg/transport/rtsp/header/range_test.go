@@ -0,0 +1,162 @@
+package header
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRange(t *testing.T) {
+	clock := func(v string) time.Time {
+		rv, _ := time.Parse(time.RFC3339Nano, v)
+		return rv
+	}
+	for _, tc := range []struct {
+		raw  string
+		want TimeRange
+		err  bool
+	}{
+		{raw: "npt=10-15.5", want: TimeRange{Unit: RangeNPT, Start: 10 * time.Second, End: 15500 * time.Millisecond, HasStart: true, HasEnd: true}},
+		{raw: "npt=now-", want: TimeRange{Unit: RangeNPT, Now: true}},
+		{raw: "npt=-20", want: TimeRange{Unit: RangeNPT, End: 20 * time.Second, HasEnd: true}},
+		{raw: "npt=1:02:03.5-", want: TimeRange{Unit: RangeNPT, Start: 3723500 * time.Millisecond, HasStart: true}},
+		{raw: "npt=0-;time=19970123T143720Z", want: TimeRange{Unit: RangeNPT, HasStart: true, Time: clock("1997-01-23T14:37:20Z")}},
+		{raw: "smpte=10:07:00-10:07:33:05.01", want: TimeRange{Unit: RangeSMPTE, Start: 36420 * time.Second, End: 36453*time.Second + 167*time.Millisecond, HasStart: true, HasEnd: true}},
+		{raw: "smpte-25=00:00:01:05-", want: TimeRange{Unit: "smpte-25", Start: 1200 * time.Millisecond, HasStart: true}},
+		{raw: "clock=19961108T142300Z-19961108T143520.25Z", want: TimeRange{Unit: RangeClock,
+			StartTime: clock("1996-11-08T14:23:00Z"), EndTime: clock("1996-11-08T14:35:20.25Z"), HasStart: true, HasEnd: true}},
+		{raw: "npt=nan-", err: true},
+		{raw: "npt=inf-", err: true},
+		{raw: "npt=-Infinity", err: true},
+		{raw: "npt=1e300-", err: true},
+		{raw: "npt=0:60:00-", err: true},
+		{raw: "npt=-1-", err: true},
+		{raw: "npt=20-10", err: true},
+		{raw: "npt=-", err: true},
+		{raw: "smpte=10:60:00-", err: true},
+		{raw: "smpte-25=00:00:00:25-", err: true},
+		{raw: "smpte=9999999999999:00:00-", err: true},
+		{raw: "clock=19961108T142300-", err: true},
+		{raw: "clock=19961108T143000Z-19961108T142300Z", err: true},
+		{raw: "frames=1-", err: true},
+		{raw: "npt=0-;time=now", err: true},
+	} {
+		got, err := ParseRange(tc.raw)
+		if tc.err {
+			if err == nil {
+				t.Errorf("ParseRange(%q) = %+v, want error", tc.raw, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseRange(%q): %v", tc.raw, err)
+			continue
+		}
+		// the frames are rounded to the milliseconds.
+		got.Start, got.End = got.Start.Round(time.Millisecond), got.End.Round(time.Millisecond)
+		if got != tc.want {
+			t.Errorf("ParseRange(%q) = %+v, want %+v", tc.raw, got, tc.want)
+		}
+	}
+}
+
+func TestFormatRange(t *testing.T) {
+	for _, tc := range []struct {
+		raw  string
+		want string
+	}{
+		{raw: "npt=10-15.5", want: "npt=10.000-15.500"},
+		{raw: "npt=now-", want: "npt=now-"},
+		{raw: "smpte=10:07:00-10:07:33:05", want: "smpte=10:07:00:00-10:07:33:05"},
+		{raw: "clock=19961108T142300Z-;time=19970123T143720Z", want: "clock=19961108T142300Z-;time=19970123T143720Z"},
+	} {
+		r, err := ParseRange(tc.raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.String(); got != tc.want {
+			t.Errorf("ParseRange(%q).String() = %q, want %q", tc.raw, got, tc.want)
+		}
+	}
+}
+
+func TestSMPTEDropFrame(t *testing.T) {
+	const unit = "smpte-30-drop"
+	// the frame numbers 0 and 1 of the minute are dropped,
+	// except the tenth minutes.
+	for _, tc := range []struct {
+		code  string
+		frame int
+	}{
+		{code: "00:00:00:00", frame: 0},
+		{code: "00:00:59:29", frame: 1799},
+		{code: "00:01:00:02", frame: 1800},
+		{code: "00:01:59:29", frame: 3597},
+		{code: "00:02:00:02", frame: 3598},
+		{code: "00:09:59:29", frame: 17981},
+		{code: "00:10:00:00", frame: 17982},
+		{code: "00:10:00:01", frame: 17983},
+		{code: "00:11:00:02", frame: 19782},
+		{code: "01:00:00:00", frame: 107892},
+	} {
+		d, err := parseSMPTE(tc.code, unit)
+		if err != nil {
+			t.Fatalf("parseSMPTE(%q): %v", tc.code, err)
+		}
+		want := time.Duration(float64(tc.frame) * 1001 / 30000 * float64(time.Second))
+		if diff := d - want; diff < -time.Microsecond || diff > time.Microsecond {
+			t.Errorf("parseSMPTE(%q) = %v, want %v", tc.code, d, want)
+		}
+		if got := formatSMPTE(d, unit); got != tc.code {
+			t.Errorf("formatSMPTE(%v) = %q, want %q", d, got, tc.code)
+		}
+	}
+}
+
+func TestParseScale(t *testing.T) {
+	for _, tc := range []struct {
+		raw  string
+		want float64
+		err  bool
+	}{
+		{raw: "1", want: 1},
+		{raw: " 2.5 ", want: 2.5},
+		{raw: "-1", want: -1},
+		{raw: "0", err: true},
+		{raw: "nan", err: true},
+		{raw: "inf", err: true},
+		{raw: "-inf", err: true},
+		{raw: "1e300", err: true},
+		{raw: "fast", err: true},
+	} {
+		got, err := ParseScale(tc.raw)
+		if tc.err != (err != nil) || got != tc.want {
+			t.Errorf("ParseScale(%q) = %v, %v", tc.raw, got, err)
+		}
+	}
+}
+
+func TestParseSpeed(t *testing.T) {
+	for _, tc := range []struct {
+		raw      string
+		min, max float64
+		err      bool
+	}{
+		{raw: "1", min: 1, max: 1},
+		{raw: "1.0-2.5", min: 1, max: 2.5},
+		{raw: "0.5-0.5", min: 0.5, max: 0.5},
+		{raw: "0", err: true},
+		{raw: "-1", err: true},
+		{raw: "2-1", err: true},
+		{raw: "nan", err: true},
+		{raw: "1-nan", err: true},
+		{raw: "inf", err: true},
+		{raw: "1-inf", err: true},
+		{raw: "1e300", err: true},
+		{raw: "1-1e300", err: true},
+	} {
+		min, max, err := ParseSpeed(tc.raw)
+		if tc.err != (err != nil) || min != tc.min || max != tc.max {
+			t.Errorf("ParseSpeed(%q) = %v, %v, %v", tc.raw, min, max, err)
+		}
+	}
+}
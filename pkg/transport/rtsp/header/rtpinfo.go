@@ -0,0 +1,16 @@
+package header
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NewRTPInfo returns the rtp info of a stream.
+func NewRTPInfo(url string, seq uint16, rtptime uint32) string {
+	return fmt.Sprintf("url=%s;seq=%d;rtptime=%d", url, seq, rtptime)
+}
+
+// JoinRTPInfo joins the rtp info of the streams.
+func JoinRTPInfo(infos ...string) string {
+	return strings.Join(infos, ",")
+}
@@ -2,6 +2,7 @@ package header
 
 import (
 	"fmt"
+	"net"
 	"strconv"
 	"strings"
 )
@@ -9,15 +10,48 @@ import (
 const defaultTrans = "RTP/AVP"
 const LowerTransTCP = "RTP/AVP/TCP"
 const LoweTransUDP = "RTP/AVP/UDP"
+const secureTrans = "RTP/SAVP"
+const SecureTransTCP = "RTP/SAVP/TCP"
+const SecureTransUDP = "RTP/SAVP/UDP"
 const ParamMulticast = "multicast"
 const ParamUnicast = "unicast"
+const ParamRTCPMux = "RTCP-mux"
+const ParamRTX = "rtx"
 const paramInterleaved = "interleaved"
-const modeRecord = "mode=record"
+const ModeRecord = "mode=record"
 const clientPort = "client_port"
 const serverPort = "server_port"
+const destination = "destination"
+const port = "port"
+const ttl = "ttl"
+const srcAddr = "src_addr"
+const destAddr = "dest_addr"
+const ssrc = "ssrc"
 
 type TransportHeader map[string]struct{}
 
+// ParseTransportHeader split the raw transport header value into parameters.
+func ParseTransportHeader(raw string) TransportHeader {
+	rv := make(TransportHeader)
+	for _, part := range strings.Split(raw, ";") {
+		rv[strings.TrimSpace(part)] = struct{}{}
+	}
+	return rv
+}
+
+// ParseTransports split the transport specifications the client
+// offers by its preference, separated by commas.
+func ParseTransports(raw string) []TransportHeader {
+	var rv []TransportHeader
+	for _, spec := range strings.Split(raw, ",") {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		rv = append(rv, ParseTransportHeader(spec))
+	}
+	return rv
+}
+
 func NewTransportHeader(lt string, param ...string) string {
 	ks := make([]string, 0)
 	ks = append(ks, lt)
@@ -29,14 +63,54 @@ func NewInterleavedParam(ch1 int, ch2 int) string {
 	return fmt.Sprintf("%s=%d-%d", paramInterleaved, ch1, ch2)
 }
 
+// NewClientPort returns the single port if rtp and rtcp are muxed on it.
 func NewClientPort(p1 int, p2 int) string {
+	if p1 == p2 {
+		return fmt.Sprintf("%s=%d", clientPort, p1)
+	}
 	return fmt.Sprintf("%s=%d-%d", clientPort, p1, p2)
 }
 
+// NewServerPort returns the single port if rtp and rtcp are muxed on it.
 func NewServerPort(p1 int, p2 int) string {
+	if p1 == p2 {
+		return fmt.Sprintf("%s=%d", serverPort, p1)
+	}
 	return fmt.Sprintf("%s=%d-%d", serverPort, p1, p2)
 }
 
+func NewDestination(ip string) string {
+	return fmt.Sprintf("%s=%s", destination, ip)
+}
+
+func NewPort(p1 int, p2 int) string {
+	return fmt.Sprintf("%s=%d-%d", port, p1, p2)
+}
+
+// NewSrcAddr returns the rtsp 2.0 source addresses of the server, the host is
+// omitted so the client uses the one it connects to, eg: src_addr=":6256"/":6257".
+func NewSrcAddr(p1 int, p2 int) string {
+	if p1 == p2 {
+		return fmt.Sprintf("%s=\":%d\"", srcAddr, p1)
+	}
+	return fmt.Sprintf("%s=\":%d\"/\":%d\"", srcAddr, p1, p2)
+}
+
+// NewDestAddr returns the rtsp 2.0 destination addresses,
+// eg: dest_addr="192.0.2.5:3456"/"192.0.2.5:3457".
+func NewDestAddr(host string, p1 int, p2 int) string {
+	h1 := net.JoinHostPort(host, strconv.Itoa(p1))
+	if p1 == p2 {
+		return fmt.Sprintf("%s=\"%s\"", destAddr, h1)
+	}
+	h2 := net.JoinHostPort(host, strconv.Itoa(p2))
+	return fmt.Sprintf("%s=\"%s\"/\"%s\"", destAddr, h1, h2)
+}
+
+func NewTTL(t int) string {
+	return fmt.Sprintf("%s=%d", ttl, t)
+}
+
 func (t TransportHeader) Has(key string) bool {
 	_, ok := t[key]
 	return ok
@@ -53,12 +127,17 @@ func (t TransportHeader) Value(k string) string {
 }
 
 func (t TransportHeader) LowerTransportTCP() bool {
-	if t.Has(LowerTransTCP) {
+	if t.Has(LowerTransTCP) || t.Has(SecureTransTCP) {
 		return true
 	}
 	return false
 }
 
+// Secure reports whether the profile is the secure rtp.
+func (t TransportHeader) Secure() bool {
+	return t.Has(secureTrans) || t.Has(SecureTransTCP) || t.Has(SecureTransUDP)
+}
+
 func (t TransportHeader) Multicast() bool {
 	if t.Has(ParamMulticast) {
 		return true
@@ -87,19 +166,82 @@ func (t TransportHeader) Interleaved() (int, int, bool) {
 	return int(c1), int(c2), true
 }
 
+// ClientPort returns the rtp and rtcp ports of the client by client_port,
+// or dest_addr of rtsp 2.0. The rtcp port of a single port is the next one,
+// unless they are muxed.
 func (t TransportHeader) ClientPort() (int, int, bool) {
-	v := t.Value(clientPort)
+	if p1, p2, ok := t.portPair(clientPort); ok {
+		return p1, p2, true
+	}
+	_, p1, p2, ok := t.DestAddr()
+	return p1, p2, ok
+}
+
+// DestAddr returns the host and the rtp and rtcp ports of dest_addr,
+// the host is empty if omitted, eg: dest_addr=":6000"/":6001".
+func (t TransportHeader) DestAddr() (string, int, int, bool) {
+	v := t.Value(destAddr)
+	if v == "" {
+		return "", 0, 0, false
+	}
+	addrs := strings.Split(v, "/")
+	if len(addrs) > 2 {
+		return "", 0, 0, false
+	}
+	host, p1, err := splitHostPort(addrs[0])
+	if err != nil {
+		return "", 0, 0, false
+	}
+	p2 := p1 + 1
+	if t.RTCPMux() {
+		p2 = p1
+	} else if len(addrs) == 2 {
+		_, p2, err = splitHostPort(addrs[1])
+		if err != nil {
+			return "", 0, 0, false
+		}
+	}
+	return host, p1, p2, true
+}
+
+func splitHostPort(quoted string) (string, int, error) {
+	host, p, err := net.SplitHostPort(strings.Trim(quoted, "\""))
+	if err != nil {
+		return "", 0, err
+	}
+	port, err := strconv.ParseUint(p, 10, 16)
+	if err != nil {
+		return "", 0, err
+	}
+	return host, int(port), nil
+}
+
+// ServerPort returns the rtp and rtcp ports of the server,
+// the rtcp port of a single port is the next one, unless they are muxed.
+func (t TransportHeader) ServerPort() (int, int, bool) {
+	return t.portPair(serverPort)
+}
+
+func (t TransportHeader) portPair(k string) (int, int, bool) {
+	v := t.Value(k)
 	if v == "" {
 		return 0, 0, false
 	}
+	// port = 1*5(DIGIT) [ "-" 1*5(DIGIT) ]
 	ps := strings.Split(v, "-")
-	if len(ps) != 2 {
+	if len(ps) > 2 {
 		return 0, 0, false
 	}
 	c1, err := strconv.ParseInt(ps[0], 10, 32)
 	if err != nil {
 		return 0, 0, false
 	}
+	if t.RTCPMux() {
+		return int(c1), int(c1), true
+	}
+	if len(ps) == 1 {
+		return int(c1), int(c1) + 1, true
+	}
 	c2, err := strconv.ParseInt(ps[1], 10, 32)
 	if err != nil {
 		return 0, 0, false
@@ -107,12 +249,46 @@ func (t TransportHeader) ClientPort() (int, int, bool) {
 	return int(c1), int(c2), true
 }
 
+// RTCPMux reports whether the rtcp is muxed on the rtp port, rfc 5761.
+func (t TransportHeader) RTCPMux() bool {
+	for key := range t {
+		if strings.EqualFold(key, ParamRTCPMux) {
+			return true
+		}
+	}
+	return false
+}
+
+// RTX reports whether the reader takes the lost packages resent
+// in the rtx format of the description, rfc 4588.
+func (t TransportHeader) RTX() bool {
+	for key := range t {
+		if strings.EqualFold(key, ParamRTX) {
+			return true
+		}
+	}
+	return false
+}
+
+// SSRC returns the synchronization source identifier, 8 hexadecimal digits.
+func (t TransportHeader) SSRC() (uint32, bool) {
+	v := t.Value(ssrc)
+	if v == "" {
+		return 0, false
+	}
+	rv, err := strconv.ParseUint(v, 16, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(rv), true
+}
+
 func (t TransportHeader) Record() bool {
-	return t.Has(modeRecord)
+	return t.Has(ModeRecord)
 }
 
 func (t TransportHeader) Validate() bool {
-	if !t.Has(defaultTrans) && !t.Has(LoweTransUDP) && !t.Has(LowerTransTCP) {
+	if !t.Has(defaultTrans) && !t.Has(LoweTransUDP) && !t.Has(LowerTransTCP) && !t.Secure() {
 		return false
 	}
 	if !t.Has(ParamUnicast) && !t.Has(ParamMulticast) {
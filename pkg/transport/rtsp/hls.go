@@ -0,0 +1,220 @@
+package rtsp
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the target duration of the hls fragments of the recordings,
+// the video fragments are cut at its sync samples.
+const hlsTarget = 6 * time.Second
+
+// the sample flags of the fragments, the sync sample depends on no
+// other one, the others depend on the ones before them.
+const (
+	fragmentSyncFlags  = 0x02000000
+	fragmentOtherFlags = 0x01010000
+)
+
+// fragments returns the positions the fragments of the file start from,
+// the video fragments start from its sync samples once the target elapsed.
+func (m *mp4File) fragments(target time.Duration) []time.Duration {
+	rv := []time.Duration{0}
+	for _, t := range m.tracks {
+		if t.codec == codecAAC {
+			continue
+		}
+		for _, s := range t.samples {
+			if d := t.time(s.dts); s.sync && d-rv[len(rv)-1] >= target {
+				rv = append(rv, d)
+			}
+		}
+		return rv
+	}
+	for pos := target; pos < m.duration; pos += target {
+		rv = append(rv, pos)
+	}
+	return rv
+}
+
+// span returns the samples of the track played from the position to the position.
+func (t *mp4Track) span(from, to time.Duration) (int, int) {
+	search := func(pos time.Duration) int {
+		return sort.Search(len(t.samples), func(i int) bool {
+			return t.time(t.samples[i].dts) >= pos
+		})
+	}
+	return search(from), search(to)
+}
+
+// initSegment returns the ftyp and the moov box of the fragmented file,
+// the tracks are without samples and extended by the fragments.
+func (m *mp4File) initSegment() []byte {
+	empty := &mp4File{}
+	trex := make([][]byte, 0, len(m.tracks))
+	for i, t := range m.tracks {
+		c := *t
+		c.samples, c.duration = nil, 0
+		empty.tracks = append(empty.tracks, &c)
+		trex = append(trex, mp4Full("trex", 0, 0, mp4U32(uint32(i+1), 1, 0, 0, 0)))
+	}
+	ftyp := mp4Make("ftyp", []byte("iso6"), mp4U32(0), []byte("iso6mp41"))
+	moov := empty.moov(nil, 0)
+	return append(ftyp, mp4Make("moov", moov[8:], mp4Make("mvex", trex...))...)
+}
+
+// moof returns the moof box of the fragment of the sequence number, the samples
+// of the spans of the tracks follow it in the mdat box in the order of the tracks.
+func (m *mp4File) moof(seq uint32, spans [][2]int) []byte {
+	build := func(base uint32) []byte {
+		parts := [][]byte{mp4Full("mfhd", 0, 0, mp4U32(seq))}
+		offset := base
+		for i, t := range m.tracks {
+			from, to := spans[i][0], spans[i][1]
+			if from == to {
+				continue
+			}
+			entries := make([]byte, 0, 16*(to-from))
+			var size uint32
+			for k := from; k < to; k++ {
+				s := t.samples[k]
+				flags := uint32(fragmentOtherFlags)
+				if s.sync {
+					flags = fragmentSyncFlags
+				}
+				entries = append(entries, mp4U32(t.delta(k), s.size, flags, uint32(s.cts))...)
+				size += s.size
+			}
+			// the data offsets are from the moof box, the version 1
+			// composition offsets are signed.
+			parts = append(parts, mp4Make("traf",
+				mp4Full("tfhd", 0, 0x020000, mp4U32(uint32(i+1))),
+				mp4Full("tfdt", 1, 0, mp4U64(t.samples[from].dts)),
+				mp4Full("trun", 1, 0x000f01, mp4U32(uint32(to-from), offset), entries),
+			))
+			offset += size
+		}
+		return mp4Make("moof", parts...)
+	}
+	// the size of the moof box is fixed, so are the data offsets.
+	return build(uint32(len(build(0)) + 8))
+}
+
+// writeFragment write the moof and the mdat box of the fragment of the spans.
+func (m *mp4File) writeFragment(w io.Writer, moof []byte, spans [][2]int) error {
+	var size uint32
+	for i, t := range m.tracks {
+		for k := spans[i][0]; k < spans[i][1]; k++ {
+			size += t.samples[k].size
+		}
+	}
+	head := append(moof, mp4U32(8+size)...)
+	if _, err := w.Write(append(head, "mdat"...)); err != nil {
+		return err
+	}
+	var buf []byte
+	var err error
+	for i, t := range m.tracks {
+		for k := spans[i][0]; k < spans[i][1]; k++ {
+			if buf, err = m.readSample(t.samples[k], buf); err != nil {
+				return err
+			}
+			if _, err = w.Write(buf); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// playlist returns the media playlist of the fragments starting from the positions,
+// the fragments and the init section are named relative to the playlist.
+func (m *mp4File) playlist(bounds []time.Duration, query string) []byte {
+	durations := make([]time.Duration, len(bounds))
+	var target float64
+	for i, b := range bounds {
+		end := m.duration
+		if i+1 < len(bounds) {
+			end = bounds[i+1]
+		}
+		durations[i] = end - b
+		target = math.Max(target, math.Ceil(durations[i].Seconds()))
+	}
+	if query != "" {
+		query = "?" + query
+	}
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:7\n")
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", int(target))
+	b.WriteString("#EXT-X-PLAYLIST-TYPE:VOD\n#EXT-X-INDEPENDENT-SEGMENTS\n")
+	fmt.Fprintf(&b, "#EXT-X-MAP:URI=\"init.mp4%s\"\n", query)
+	for i, pos := range bounds {
+		fmt.Fprintf(&b, "#EXT-X-PROGRAM-DATE-TIME:%s\n", m.clock(pos).UTC().Format("2006-01-02T15:04:05.000Z"))
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\n%d.m4s%s\n", durations[i].Seconds(), i, query)
+	}
+	b.WriteString("#EXT-X-ENDLIST\n")
+	return []byte(b.String())
+}
+
+// RecordingHLSHandler returns the handler streaming the recording of the channel
+// in the time range of the unix seconds by hls of the fragmented mp4, the playlist,
+// the init section and the fragments are named under the path of the handler,
+// eg: GET <path>/index.m3u8?channel=camera&start=1697709780&end=1697710620
+func (s *Server) RecordingHLSHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Base(r.URL.Path)
+		n := -1
+		if strings.HasSuffix(name, ".m4s") {
+			var err error
+			n, err = strconv.Atoi(strings.TrimSuffix(name, ".m4s"))
+			if err != nil || n < 0 {
+				http.NotFound(w, r)
+				return
+			}
+		} else if name != "index.m3u8" && name != "init.mp4" {
+			http.NotFound(w, r)
+			return
+		}
+		channel, f, ok := s.recording(w, r)
+		if !ok {
+			return
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		bounds := f.fragments(hlsTarget)
+		switch name {
+		case "index.m3u8":
+			w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+			_, _ = w.Write(f.playlist(bounds, r.URL.RawQuery))
+			return
+		case "init.mp4":
+			w.Header().Set("Content-Type", "video/mp4")
+			_, _ = w.Write(f.initSegment())
+			return
+		}
+		if n >= len(bounds) {
+			http.NotFound(w, r)
+			return
+		}
+		end := time.Duration(math.MaxInt64)
+		if n+1 < len(bounds) {
+			end = bounds[n+1]
+		}
+		spans := make([][2]int, len(f.tracks))
+		for i, t := range f.tracks {
+			spans[i][0], spans[i][1] = t.span(bounds[n], end)
+		}
+		w.Header().Set("Content-Type", "video/iso.segment")
+		if err := f.writeFragment(w, f.moof(uint32(n+1), spans), spans); err != nil {
+			s.log.Errorf("can not write the fragment %d of the recording of %s: %v", n, channel, err)
+		}
+	})
+}
@@ -0,0 +1,196 @@
+package rtsp
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+// the max packages held by the jitter buffer, a package further
+// ahead or behind resyncs the buffer to its sequence number.
+const jitterBufferSize = 512
+
+// jitterBuffer reorders the rtp packages of a udp source by their sequence
+// numbers, a missing package is waited for the latency at most.
+// The rtcp packages are delivered as they arrive.
+type jitterBuffer struct {
+	latency time.Duration
+	input   chan *Package
+	output  chan *Package
+	done    chan struct{}
+	once    sync.Once
+	ring    [jitterBufferSize]*Package
+	arrived [jitterBufferSize]time.Time
+	pending int
+	next    uint16
+	started bool
+}
+
+func newJitterBuffer(latency time.Duration, output chan *Package) *jitterBuffer {
+	j := &jitterBuffer{
+		latency: latency,
+		input:   make(chan *Package, 64),
+		output:  output,
+		done:    make(chan struct{}),
+	}
+	go j.run()
+	return j
+}
+
+func (j *jitterBuffer) push(p *Package) {
+	select {
+	case j.input <- p:
+	case <-j.done:
+		putPackage(p)
+	}
+}
+
+func (j *jitterBuffer) close() {
+	j.once.Do(func() {
+		close(j.done)
+	})
+}
+
+func (j *jitterBuffer) run() {
+	timer := time.NewTimer(j.latency)
+	timer.Stop()
+	defer func() {
+		timer.Stop()
+		j.release()
+	}()
+	for {
+		select {
+		case <-j.done:
+			return
+		case p := <-j.input:
+			if p.Ch == 1 || p.Len < 12 {
+				if !j.emit(p) {
+					return
+				}
+				continue
+			}
+			if !j.insert(p, time.Now()) {
+				return
+			}
+		case <-timer.C:
+		}
+		if !j.drain(time.Now()) {
+			return
+		}
+		timer.Stop()
+		if j.pending > 0 {
+			timer.Reset(time.Until(j.deadline()))
+		}
+	}
+}
+
+// insert the rtp package, it returns false if the buffer is closed.
+func (j *jitterBuffer) insert(p *Package, now time.Time) bool {
+	seq := binary.BigEndian.Uint16(p.Data[2:])
+	if !j.started {
+		j.next = seq
+		j.started = true
+	}
+	d := int16(seq - j.next)
+	if d < 0 && d > -jitterBufferSize {
+		// the package is late or duplicated.
+		putPackage(p)
+		return true
+	}
+	if d < 0 || d >= jitterBufferSize {
+		// the source jumps, deliver the held packages and resync.
+		for j.pending > 0 {
+			if !j.skip() {
+				return false
+			}
+		}
+		j.next = seq
+	}
+	i := int(seq) % jitterBufferSize
+	if j.ring[i] != nil {
+		putPackage(p)
+		return true
+	}
+	j.ring[i] = p
+	j.arrived[i] = now
+	j.pending++
+	return true
+}
+
+// drain deliver the packages in order, the missing one
+// is skipped if a held package has waited for the latency.
+func (j *jitterBuffer) drain(now time.Time) bool {
+	for j.pending > 0 {
+		i := int(j.next) % jitterBufferSize
+		if p := j.ring[i]; p != nil {
+			j.ring[i] = nil
+			j.pending--
+			j.next++
+			if !j.emit(p) {
+				return false
+			}
+			continue
+		}
+		if now.Before(j.deadline()) {
+			return true
+		}
+		if !j.skip() {
+			return false
+		}
+	}
+	return true
+}
+
+// skip the missing packages to the next held one and deliver it.
+func (j *jitterBuffer) skip() bool {
+	for k := 0; k < jitterBufferSize; k++ {
+		i := int(j.next) % jitterBufferSize
+		j.next++
+		if p := j.ring[i]; p != nil {
+			j.ring[i] = nil
+			j.pending--
+			return j.emit(p)
+		}
+	}
+	return true
+}
+
+// deadline returns the time the oldest held package waits until.
+func (j *jitterBuffer) deadline() time.Time {
+	var oldest time.Time
+	for i, p := range j.ring {
+		if p != nil && (oldest.IsZero() || j.arrived[i].Before(oldest)) {
+			oldest = j.arrived[i]
+		}
+	}
+	return oldest.Add(j.latency)
+}
+
+func (j *jitterBuffer) emit(p *Package) bool {
+	select {
+	case j.output <- p:
+		return true
+	case <-j.done:
+		putPackage(p)
+		return false
+	}
+}
+
+// release the held and the pending packages.
+func (j *jitterBuffer) release() {
+	for i, p := range j.ring {
+		if p != nil {
+			putPackage(p)
+			j.ring[i] = nil
+		}
+	}
+	j.pending = 0
+	for {
+		select {
+		case p := <-j.input:
+			putPackage(p)
+		default:
+			return
+		}
+	}
+}
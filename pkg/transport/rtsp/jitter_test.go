@@ -0,0 +1,48 @@
+package rtsp
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestJitterBufferReorder(t *testing.T) {
+	output := make(chan *Package, 16)
+	j := newJitterBuffer(50*time.Millisecond, output)
+	defer j.close()
+	// the 5 is lost, the 1 is duplicated.
+	for _, seq := range []uint16{0, 2, 1, 4, 3, 1, 7, 6} {
+		j.push(rtpPackage(0, seq))
+	}
+	for _, want := range []uint16{0, 1, 2, 3, 4, 6, 7} {
+		select {
+		case p := <-output:
+			if seq := binary.BigEndian.Uint16(p.Data[2:]); seq != want {
+				t.Fatalf("sequence number %d, want %d", seq, want)
+			}
+			putPackage(p)
+		case <-time.After(time.Second):
+			t.Fatalf("the package %d is not delivered", want)
+		}
+	}
+}
+
+func TestJitterBufferWrap(t *testing.T) {
+	output := make(chan *Package, 16)
+	j := newJitterBuffer(50*time.Millisecond, output)
+	defer j.close()
+	for _, seq := range []uint16{65534, 0, 65535, 1} {
+		j.push(rtpPackage(0, seq))
+	}
+	for _, want := range []uint16{65534, 65535, 0, 1} {
+		select {
+		case p := <-output:
+			if seq := binary.BigEndian.Uint16(p.Data[2:]); seq != want {
+				t.Fatalf("sequence number %d, want %d", seq, want)
+			}
+			putPackage(p)
+		case <-time.After(time.Second):
+			t.Fatalf("the package %d is not delivered", want)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package rtsp
+
+import (
+	"encoding/binary"
+	"gortc.io/sdp"
+	"strings"
+)
+
+// the video codecs whose keyframes can be detected.
+const (
+	codecH264 = "H264"
+	codecH265 = "H265"
+)
+
+// videoCodecs returns the detectable video codec of the medias by their order.
+func videoCodecs(msg *sdp.Message) map[int]string {
+	rv := map[int]string{}
+	for i, m := range msg.Medias {
+		if m.Description.Type != "video" {
+			continue
+		}
+		// rtpmap example: 96 H264/90000
+		fields := strings.Fields(m.Attribute("rtpmap"))
+		if len(fields) < 2 {
+			continue
+		}
+		codec := strings.ToUpper(strings.Split(fields[1], "/")[0])
+		if codec == "HEVC" {
+			codec = codecH265
+		}
+		if codec == codecH264 || codec == codecH265 {
+			rv[i] = codec
+		}
+	}
+	return rv
+}
+
+// keyframe reports whether the rtp package starts a keyframe,
+// the parameter sets sent before the idr frame are treated as its start.
+func keyframe(codec string, data []byte) bool {
+	payload := rtpPayload(data)
+	if len(payload) == 0 {
+		return false
+	}
+	switch codec {
+	case codecH264:
+		switch payload[0] & 0x1f {
+		case 5, 7:
+			return true
+		case 24:
+			// STAP-A, the type of the first aggregated nal.
+			if len(payload) > 3 {
+				t := payload[3] & 0x1f
+				return t == 5 || t == 7
+			}
+		case 28:
+			// FU-A, the start fragment of an idr.
+			if len(payload) > 1 {
+				return payload[1]&0x80 != 0 && payload[1]&0x1f == 5
+			}
+		}
+	case codecH265:
+		t := payload[0] >> 1 & 0x3f
+		switch {
+		case t >= 16 && t <= 21, t >= 32 && t <= 34:
+			return true
+		case t == 48:
+			// AP, the type of the first aggregated nal.
+			if len(payload) > 4 {
+				t = payload[4] >> 1 & 0x3f
+				return t >= 16 && t <= 21 || t >= 32 && t <= 34
+			}
+		case t == 49:
+			// FU, the start fragment of an irap.
+			if len(payload) > 2 {
+				t = payload[2] & 0x3f
+				return payload[2]&0x80 != 0 && t >= 16 && t <= 21
+			}
+		}
+	}
+	return false
+}
+
+// rtpPayload returns the payload of the rtp package.
+func rtpPayload(data []byte) []byte {
+	if len(data) < 12 || data[0]>>6 != 2 {
+		return nil
+	}
+	n := 12 + int(data[0]&0x0f)*4
+	// the header extension.
+	if data[0]&0x10 != 0 {
+		if len(data) < n+4 {
+			return nil
+		}
+		n += 4 + int(binary.BigEndian.Uint16(data[n+2:]))*4
+	}
+	end := len(data)
+	// the padding.
+	if data[0]&0x20 != 0 {
+		end -= int(data[end-1])
+	}
+	if end <= n {
+		return nil
+	}
+	return data[n:end]
+}
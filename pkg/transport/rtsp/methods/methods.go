@@ -16,4 +16,6 @@ const (
 	PLAY     Method = "PLAY"
 	PAUSE    Method = "PAUSE"
 	DOWN     Method = "DOWN"
+	// PLAYNOTIFY is sent by the server to the rtsp 2.0 client.
+	PLAYNOTIFY Method = "PLAY_NOTIFY"
 )
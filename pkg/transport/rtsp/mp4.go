@@ -0,0 +1,657 @@
+package rtsp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// the audio codec of the mp4 tracks, rfc 3640.
+const codecAAC = "MPEG4-GENERIC"
+
+// the limits of the mp4 boxes loaded in memory.
+const (
+	maxMP4Moov    = 64 << 20
+	maxMP4Samples = 1 << 24
+)
+
+// the files of the stitched recording kept open at most.
+const maxOpenParts = 4
+
+// mp4File is the demuxed mp4 file, the samples are read on demand.
+// The recording stitched from the segments reads the samples from
+// the file of their part, the parts are opened once read and the
+// least recently read ones are closed.
+type mp4File struct {
+	// the paths of the parts, and their files, nil if closed.
+	paths []string
+	files []*os.File
+	// the parts open, the least recently read first.
+	open     []int
+	tracks   []*mp4Track
+	duration time.Duration
+	// the wall clock time of the parts of the stitched recording.
+	wall []mp4Wall
+}
+
+// mp4Wall is the position a part of the stitched recording starts from,
+// and its wall clock time.
+type mp4Wall struct {
+	pos time.Duration
+	at  time.Time
+}
+
+// mp4Track is the h264, h265 or aac track of the mp4 file.
+type mp4Track struct {
+	id        uint32
+	codec     string
+	timescale uint32
+	duration  uint64
+	// the parameter sets of the video, the vps is of h265 only.
+	vps [][]byte
+	sps [][]byte
+	pps [][]byte
+	// the size of the nal length prefixes of the video samples.
+	nalLength int
+	// the audio specific config of the aac.
+	config     []byte
+	sampleRate int
+	channels   int
+	// the sample entry and the size of the video, kept for writing the track.
+	entry   mp4Box
+	width   uint16
+	height  uint16
+	samples []mp4Sample
+}
+
+type mp4Sample struct {
+	offset int64
+	size   uint32
+	// the decode time and the composition offset in the timescale.
+	dts  uint64
+	cts  int32
+	sync bool
+	// the part of the stitched recording.
+	part uint16
+}
+
+// openMP4 open and demux the mp4 file, the fragmented mp4 is not supported.
+func openMP4(path string) (*mp4File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	moov, err := findMoov(f, info.Size())
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	rv := &mp4File{paths: []string{path}, files: []*os.File{f}, open: []int{0}}
+	for _, b := range mp4Boxes(moov) {
+		if b.kind != "trak" {
+			continue
+		}
+		t, err1 := parseTrak(b.data, info.Size())
+		if err1 != nil {
+			_ = f.Close()
+			return nil, err1
+		}
+		if t == nil || len(t.samples) == 0 {
+			continue
+		}
+		rv.tracks = append(rv.tracks, t)
+		if d := t.time(t.duration); d > rv.duration {
+			rv.duration = d
+		}
+	}
+	if len(rv.tracks) == 0 {
+		_ = f.Close()
+		return nil, fmt.Errorf("no h264, h265 or aac track in %s", path)
+	}
+	return rv, nil
+}
+
+func (m *mp4File) Close() error {
+	var rv error
+	for _, i := range m.open {
+		if err := m.files[i].Close(); err != nil {
+			rv = err
+		}
+		m.files[i] = nil
+	}
+	m.open = nil
+	return rv
+}
+
+// part returns the file of the part, it is opened if closed.
+func (m *mp4File) part(i int) (*os.File, error) {
+	for k, open := range m.open {
+		if open == i {
+			m.open = append(append(m.open[:k], m.open[k+1:]...), i)
+			return m.files[i], nil
+		}
+	}
+	f, err := os.Open(m.paths[i])
+	if err != nil {
+		return nil, err
+	}
+	if len(m.open) >= maxOpenParts {
+		_ = m.files[m.open[0]].Close()
+		m.files[m.open[0]] = nil
+		m.open = m.open[1:]
+	}
+	m.files[i] = f
+	m.open = append(m.open, i)
+	return f, nil
+}
+
+// readSample read the sample into the buffer, it is grown if not large enough.
+func (m *mp4File) readSample(s mp4Sample, buf []byte) ([]byte, error) {
+	if cap(buf) < int(s.size) {
+		buf = make([]byte, s.size)
+	}
+	buf = buf[:s.size]
+	f, err := m.part(int(s.part))
+	if err != nil {
+		return buf, err
+	}
+	_, err = f.ReadAt(buf, s.offset)
+	return buf, err
+}
+
+// time returns the duration of the value in the timescale of the track.
+func (t *mp4Track) time(v uint64) time.Duration {
+	return time.Duration(float64(v) / float64(t.timescale) * float64(time.Second))
+}
+
+// units returns the value of the duration in the timescale of the track.
+func (t *mp4Track) units(d time.Duration) uint64 {
+	return uint64(d.Seconds()*float64(t.timescale) + 0.5)
+}
+
+// seek returns the index of the first sample played from the position,
+// the video starts from the last sync sample not after it.
+func (t *mp4Track) seek(pos time.Duration) int {
+	i := sort.Search(len(t.samples), func(i int) bool {
+		return t.time(t.samples[i].dts) > pos
+	})
+	if t.codec == codecAAC {
+		// the first sample not before the position.
+		if i > 0 && t.time(t.samples[i-1].dts) == pos {
+			return i - 1
+		}
+		return i
+	}
+	for i--; i > 0 && !t.samples[i].sync; i-- {
+	}
+	if i < 0 {
+		return 0
+	}
+	return i
+}
+
+type mp4Box struct {
+	kind string
+	data []byte
+}
+
+// findMoov read the moov box of the file.
+func findMoov(r io.ReaderAt, size int64) ([]byte, error) {
+	var hdr [16]byte
+	for offset := int64(0); offset+8 <= size; {
+		if _, err := r.ReadAt(hdr[:8], offset); err != nil {
+			return nil, err
+		}
+		n := int64(binary.BigEndian.Uint32(hdr[:]))
+		kind := string(hdr[4:8])
+		head := int64(8)
+		switch n {
+		case 0:
+			n = size - offset
+		case 1:
+			if _, err := r.ReadAt(hdr[8:16], offset+8); err != nil {
+				return nil, err
+			}
+			n = int64(binary.BigEndian.Uint64(hdr[8:]))
+			head = 16
+		}
+		if n < head || offset+n > size {
+			return nil, fmt.Errorf("invalid mp4 box %s at %d", kind, offset)
+		}
+		switch kind {
+		case "moov":
+			if n-head > maxMP4Moov {
+				return nil, fmt.Errorf("mp4 moov box too large: %d", n)
+			}
+			data := make([]byte, n-head)
+			if _, err := r.ReadAt(data, offset+head); err != nil {
+				return nil, err
+			}
+			return data, nil
+		case "moof":
+			return nil, fmt.Errorf("fragmented mp4 is not supported")
+		}
+		offset += n
+	}
+	return nil, fmt.Errorf("no moov box in mp4")
+}
+
+// mp4Boxes split the children boxes, the invalid tail is ignored.
+func mp4Boxes(data []byte) []mp4Box {
+	var rv []mp4Box
+	for len(data) >= 8 {
+		n := uint64(binary.BigEndian.Uint32(data))
+		head := uint64(8)
+		switch n {
+		case 0:
+			n = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return rv
+			}
+			n = binary.BigEndian.Uint64(data[8:])
+			head = 16
+		}
+		if n < head || n > uint64(len(data)) {
+			return rv
+		}
+		rv = append(rv, mp4Box{kind: string(data[4:8]), data: data[head:n]})
+		data = data[n:]
+	}
+	return rv
+}
+
+// mp4Child returns the first child box by the path, eg: mdia, minf, stbl.
+func mp4Child(data []byte, path ...string) ([]byte, bool) {
+	for _, kind := range path {
+		found := false
+		for _, b := range mp4Boxes(data) {
+			if b.kind == kind {
+				data, found = b.data, true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return data, true
+}
+
+// parseTrak parse the track of the file of the size,
+// it returns nil if the codec is not supported.
+func parseTrak(trak []byte, size int64) (*mp4Track, error) {
+	t := &mp4Track{}
+	if tkhd, ok := mp4Child(trak, "tkhd"); ok && len(tkhd) >= 24 {
+		if tkhd[0] == 1 {
+			t.id = binary.BigEndian.Uint32(tkhd[20:])
+		} else {
+			t.id = binary.BigEndian.Uint32(tkhd[12:])
+		}
+	}
+	mdhd, ok := mp4Child(trak, "mdia", "mdhd")
+	if !ok || len(mdhd) < 24 {
+		return nil, fmt.Errorf("no mdhd box of track")
+	}
+	if mdhd[0] == 1 {
+		if len(mdhd) < 36 {
+			return nil, fmt.Errorf("invalid mdhd box")
+		}
+		t.timescale = binary.BigEndian.Uint32(mdhd[20:])
+		t.duration = binary.BigEndian.Uint64(mdhd[24:])
+	} else {
+		t.timescale = binary.BigEndian.Uint32(mdhd[12:])
+		t.duration = uint64(binary.BigEndian.Uint32(mdhd[16:]))
+	}
+	if t.timescale == 0 {
+		return nil, fmt.Errorf("invalid timescale of track %d", t.id)
+	}
+	stbl, ok := mp4Child(trak, "mdia", "minf", "stbl")
+	if !ok {
+		return nil, fmt.Errorf("no stbl box of track %d", t.id)
+	}
+	stsd, ok := mp4Child(stbl, "stsd")
+	if !ok || len(stsd) < 8 {
+		return nil, fmt.Errorf("no stsd box of track %d", t.id)
+	}
+	entries := mp4Boxes(stsd[8:])
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	if err := t.parseSampleEntry(entries[0]); err != nil || t.codec == "" {
+		return nil, err
+	}
+	t.entry = mp4Box{kind: entries[0].kind, data: append([]byte(nil), entries[0].data...)}
+	if err := t.parseSamples(stbl, size); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *mp4Track) parseSampleEntry(entry mp4Box) error {
+	switch entry.kind {
+	case "avc1", "avc3":
+		// the visual sample entry is 78 bytes before the children.
+		if len(entry.data) < 78 {
+			return fmt.Errorf("invalid %s sample entry", entry.kind)
+		}
+		t.width = binary.BigEndian.Uint16(entry.data[24:])
+		t.height = binary.BigEndian.Uint16(entry.data[26:])
+		avcC, ok := mp4Child(entry.data[78:], "avcC")
+		if !ok {
+			return nil
+		}
+		t.codec = codecH264
+		return t.parseAVCC(avcC)
+	case "hvc1", "hev1":
+		if len(entry.data) < 78 {
+			return fmt.Errorf("invalid %s sample entry", entry.kind)
+		}
+		t.width = binary.BigEndian.Uint16(entry.data[24:])
+		t.height = binary.BigEndian.Uint16(entry.data[26:])
+		hvcC, ok := mp4Child(entry.data[78:], "hvcC")
+		if !ok {
+			return nil
+		}
+		t.codec = codecH265
+		return t.parseHVCC(hvcC)
+	case "mp4a":
+		// the audio sample entry is 28 bytes, the quicktime
+		// sound description version 1 and 2 are longer.
+		if len(entry.data) < 28 {
+			return fmt.Errorf("invalid mp4a sample entry")
+		}
+		head := 28
+		switch binary.BigEndian.Uint16(entry.data[8:]) {
+		case 1:
+			head += 16
+		case 2:
+			head += 36
+		}
+		t.channels = int(binary.BigEndian.Uint16(entry.data[16:]))
+		t.sampleRate = int(binary.BigEndian.Uint32(entry.data[24:]) >> 16)
+		if len(entry.data) < head {
+			return fmt.Errorf("invalid mp4a sample entry")
+		}
+		esds, ok := mp4Child(entry.data[head:], "esds")
+		if !ok || len(esds) < 4 {
+			return nil
+		}
+		config, ok := parseESDS(esds[4:])
+		if !ok {
+			return nil
+		}
+		t.codec = codecAAC
+		t.config = config
+		t.parseAudioConfig()
+	}
+	return nil
+}
+
+func (t *mp4Track) parseAVCC(data []byte) error {
+	if len(data) < 7 {
+		return fmt.Errorf("invalid avcC box")
+	}
+	t.nalLength = int(data[4]&3) + 1
+	var ok bool
+	rest := data[6:]
+	if t.sps, rest, ok = readParameterSets(rest, int(data[5]&0x1f)); !ok || len(rest) < 1 {
+		return fmt.Errorf("invalid avcC box")
+	}
+	if t.pps, _, ok = readParameterSets(rest[1:], int(rest[0])); !ok {
+		return fmt.Errorf("invalid avcC box")
+	}
+	return nil
+}
+
+func (t *mp4Track) parseHVCC(data []byte) error {
+	if len(data) < 23 {
+		return fmt.Errorf("invalid hvcC box")
+	}
+	t.nalLength = int(data[21]&3) + 1
+	rest := data[23:]
+	for i := 0; i < int(data[22]); i++ {
+		if len(rest) < 3 {
+			return fmt.Errorf("invalid hvcC box")
+		}
+		kind := rest[0] & 0x3f
+		sets, tail, ok := readParameterSets(rest[3:], int(binary.BigEndian.Uint16(rest[1:])))
+		if !ok {
+			return fmt.Errorf("invalid hvcC box")
+		}
+		switch kind {
+		case 32:
+			t.vps = append(t.vps, sets...)
+		case 33:
+			t.sps = append(t.sps, sets...)
+		case 34:
+			t.pps = append(t.pps, sets...)
+		}
+		rest = tail
+	}
+	return nil
+}
+
+// readParameterSets read the parameter sets prefixed by their 16 bits lengths.
+func readParameterSets(data []byte, n int) ([][]byte, []byte, bool) {
+	rv := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		if len(data) < 2 {
+			return nil, nil, false
+		}
+		size := int(binary.BigEndian.Uint16(data))
+		if len(data) < 2+size {
+			return nil, nil, false
+		}
+		rv = append(rv, data[2:2+size])
+		data = data[2+size:]
+	}
+	return rv, data, true
+}
+
+// parseESDS returns the audio specific config of the mpeg-4 audio,
+// from the decoder specific info of the es descriptor.
+func parseESDS(data []byte) ([]byte, bool) {
+	tag, body, ok := readDescriptor(data)
+	if !ok || tag != 0x03 || len(body) < 3 {
+		return nil, false
+	}
+	// skip the es id, the depended es id, the url and the ocr es id.
+	flags := body[2]
+	skip := 3
+	if flags&0x80 != 0 {
+		skip += 2
+	}
+	if flags&0x40 != 0 && len(body) > skip {
+		skip += 1 + int(body[skip])
+	}
+	if flags&0x20 != 0 {
+		skip += 2
+	}
+	if skip > len(body) {
+		return nil, false
+	}
+	tag, body, ok = readDescriptor(body[skip:])
+	// the object type of the mpeg-4 audio is 0x40.
+	if !ok || tag != 0x04 || len(body) < 13 || body[0] != 0x40 {
+		return nil, false
+	}
+	tag, body, ok = readDescriptor(body[13:])
+	if !ok || tag != 0x05 || len(body) < 2 {
+		return nil, false
+	}
+	return body, true
+}
+
+// readDescriptor read the tag and the body of the mpeg-4 descriptor,
+// the size is coded in 7 bits groups.
+func readDescriptor(data []byte) (byte, []byte, bool) {
+	if len(data) < 2 {
+		return 0, nil, false
+	}
+	tag := data[0]
+	size := 0
+	i := 1
+	for ; i < len(data) && i <= 4; i++ {
+		size = size<<7 | int(data[i]&0x7f)
+		if data[i]&0x80 == 0 {
+			break
+		}
+	}
+	i++
+	if i > len(data) || len(data)-i < size {
+		return 0, nil, false
+	}
+	return tag, data[i : i+size], true
+}
+
+// parseAudioConfig read the sample rate and the channels of the audio specific config.
+func (t *mp4Track) parseAudioConfig() {
+	rates := []int{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+	c := t.config
+	v := uint32(c[0])<<8 | uint32(c[1])
+	index := int(v >> 7 & 0x0f)
+	channels := int(v >> 3 & 0x0f)
+	if index == 0x0f {
+		if len(c) < 5 {
+			return
+		}
+		v = binary.BigEndian.Uint32(c[1:])
+		t.sampleRate = int(v >> 7 & 0xffffff)
+		channels = int(v >> 3 & 0x0f)
+	} else if index < len(rates) {
+		t.sampleRate = rates[index]
+	}
+	if channels > 0 {
+		t.channels = channels
+	}
+}
+
+// parseSamples build the samples of the track from the sample tables,
+// the samples of the fixed size are bounded by the size of the file.
+func (t *mp4Track) parseSamples(stbl []byte, size int64) error {
+	stsz, ok := mp4Child(stbl, "stsz")
+	if !ok || len(stsz) < 12 {
+		return fmt.Errorf("no stsz box of track %d", t.id)
+	}
+	fixed := binary.BigEndian.Uint32(stsz[4:])
+	count := int(binary.BigEndian.Uint32(stsz[8:]))
+	if count > maxMP4Samples || fixed == 0 && len(stsz) < 12+4*count || fixed != 0 && int64(count) > size/int64(fixed) {
+		return fmt.Errorf("invalid stsz box of track %d", t.id)
+	}
+	samples := make([]mp4Sample, count)
+	for i := range samples {
+		samples[i].size = fixed
+		if fixed == 0 {
+			samples[i].size = binary.BigEndian.Uint32(stsz[12+4*i:])
+		}
+	}
+
+	// the decode time of the samples.
+	stts, ok := mp4Child(stbl, "stts")
+	if !ok || len(stts) < 8 {
+		return fmt.Errorf("no stts box of track %d", t.id)
+	}
+	i := 0
+	var dts uint64
+	for _, e := range mp4Entries(stts, 8) {
+		n, delta := binary.BigEndian.Uint32(e), binary.BigEndian.Uint32(e[4:])
+		for ; n > 0 && i < count; n-- {
+			samples[i].dts = dts
+			dts += uint64(delta)
+			i++
+		}
+	}
+	for ; i < count; i++ {
+		samples[i].dts = dts
+	}
+
+	// the composition offsets, signed in version 1.
+	if ctts, has := mp4Child(stbl, "ctts"); has && len(ctts) >= 8 {
+		i = 0
+		for _, e := range mp4Entries(ctts, 8) {
+			n, offset := binary.BigEndian.Uint32(e), int32(binary.BigEndian.Uint32(e[4:]))
+			for ; n > 0 && i < count; n-- {
+				samples[i].cts = offset
+				i++
+			}
+		}
+	}
+
+	// the sync samples, all the samples are sync if absent.
+	if stss, has := mp4Child(stbl, "stss"); has && len(stss) >= 8 {
+		for _, e := range mp4Entries(stss, 4) {
+			n := int(binary.BigEndian.Uint32(e))
+			if n >= 1 && n <= count {
+				samples[n-1].sync = true
+			}
+		}
+	} else {
+		for i := range samples {
+			samples[i].sync = true
+		}
+	}
+
+	// the chunk offsets.
+	var chunks []int64
+	if stco, has := mp4Child(stbl, "stco"); has && len(stco) >= 8 {
+		for _, e := range mp4Entries(stco, 4) {
+			chunks = append(chunks, int64(binary.BigEndian.Uint32(e)))
+		}
+	} else if co64, has1 := mp4Child(stbl, "co64"); has1 && len(co64) >= 8 {
+		for _, e := range mp4Entries(co64, 8) {
+			chunks = append(chunks, int64(binary.BigEndian.Uint64(e)))
+		}
+	} else {
+		return fmt.Errorf("no chunk offsets of track %d", t.id)
+	}
+
+	// the samples of the chunks, the first chunk of an entry is counted from 1.
+	stsc, ok := mp4Child(stbl, "stsc")
+	if !ok || len(stsc) < 8 {
+		return fmt.Errorf("no stsc box of track %d", t.id)
+	}
+	entries := mp4Entries(stsc, 12)
+	i = 0
+	for k, e := range entries {
+		first := int(binary.BigEndian.Uint32(e))
+		perChunk := int(binary.BigEndian.Uint32(e[4:]))
+		last := len(chunks)
+		if k+1 < len(entries) {
+			last = int(binary.BigEndian.Uint32(entries[k+1])) - 1
+		}
+		for c := first; c <= last && c >= 1 && c <= len(chunks); c++ {
+			offset := chunks[c-1]
+			for n := 0; n < perChunk && i < count; n++ {
+				samples[i].offset = offset
+				offset += int64(samples[i].size)
+				i++
+			}
+		}
+	}
+	t.samples = samples[:i]
+	return nil
+}
+
+// mp4Entries returns the entries of the full box table, after
+// the version, flags and the entry count.
+func mp4Entries(data []byte, size int) [][]byte {
+	n := int(binary.BigEndian.Uint32(data[4:]))
+	data = data[8:]
+	if n > len(data)/size {
+		n = len(data) / size
+	}
+	rv := make([][]byte, n)
+	for i := range rv {
+		rv[i] = data[i*size : (i+1)*size]
+	}
+	return rv
+}
@@ -0,0 +1,149 @@
+package rtsp
+
+import (
+	"testing"
+	"time"
+)
+
+// testTrak returns the data of the trak box of the media header and the sample tables.
+func testTrak(mdhd []byte, tables ...[]byte) []byte {
+	return mp4Make("trak", mp4Make("mdia", mdhd, mp4Make("minf", mp4Make("stbl", tables...))))[8:]
+}
+
+// replaceTables returns the sample tables with the boxes of the same kinds replaced,
+// the box of the kind only is removed.
+func replaceTables(tables [][]byte, boxes ...[]byte) [][]byte {
+	rv := make([][]byte, 0, len(tables))
+	for _, table := range tables {
+		replaced := false
+		for _, b := range boxes {
+			if string(b[4:8]) == string(table[4:8]) {
+				if len(b) > 8 {
+					rv = append(rv, b)
+				}
+				replaced = true
+			}
+		}
+		if !replaced {
+			rv = append(rv, table)
+		}
+	}
+	return rv
+}
+
+func TestParseTrak(t *testing.T) {
+	track := testVideoTrack()
+	offsets := make([]uint64, len(track.samples))
+	for i := range offsets {
+		offsets[i] = uint64(1000 + i*testFrameSize)
+	}
+	tables := track.sampleTables(offsets)
+	mdhd := mp4Full("mdhd", 0, 0, make([]byte, 8), mp4U32(90000, testSegmentFrames*3600), make([]byte, 4))
+	valid := testTrak(mdhd, tables...)
+	for _, tc := range []struct {
+		name    string
+		trak    []byte
+		size    int64
+		samples int
+		err     bool
+	}{
+		{name: "valid", trak: valid, samples: testSegmentFrames},
+		{name: "fixed size", samples: testSegmentFrames, trak: testTrak(mdhd, replaceTables(tables,
+			mp4Full("stsz", 0, 0, mp4U32(testFrameSize, testSegmentFrames)))...)},
+		{name: "fixed size beyond the file", err: true, trak: testTrak(mdhd, replaceTables(tables,
+			mp4Full("stsz", 0, 0, mp4U32(testFrameSize, 1<<20)))...)},
+		{name: "fixed size of the small file", size: 1000 + 10*testFrameSize, err: true, trak: testTrak(mdhd, replaceTables(tables,
+			mp4Full("stsz", 0, 0, mp4U32(testFrameSize, testSegmentFrames)))...)},
+		{name: "sizes beyond the box", err: true, trak: testTrak(mdhd, replaceTables(tables,
+			mp4Full("stsz", 0, 0, mp4U32(0, testSegmentFrames+1), make([]byte, 4*testSegmentFrames)))...)},
+		{name: "too many samples", err: true, trak: testTrak(mdhd, replaceTables(tables,
+			mp4Full("stsz", 0, 0, mp4U32(1, maxMP4Samples+1)))...)},
+		{name: "no stsz", err: true, trak: testTrak(mdhd, replaceTables(tables, mp4Make("stsz"))...)},
+		{name: "no stts", err: true, trak: testTrak(mdhd, replaceTables(tables, mp4Make("stts"))...)},
+		{name: "no chunk offsets", err: true, trak: testTrak(mdhd, replaceTables(tables, mp4Make("co64"))...)},
+		{name: "no stsc", err: true, trak: testTrak(mdhd, replaceTables(tables, mp4Make("stsc"))...)},
+		// the hostile tables are cut to the samples described.
+		{name: "chunks out of range", trak: testTrak(mdhd, replaceTables(tables,
+			mp4Full("stsc", 0, 0, mp4U32(1, testSegmentFrames+1, 1, 1)))...)},
+		{name: "chunks of many samples", samples: testSegmentFrames, trak: testTrak(mdhd, replaceTables(tables,
+			mp4Full("stsc", 0, 0, mp4U32(1, 1, 1<<31, 1)))...)},
+		{name: "entries beyond the box", samples: testSegmentFrames, trak: testTrak(mdhd, replaceTables(tables,
+			mp4Full("stts", 0, 0, mp4U32(1<<30, testSegmentFrames, 3600)),
+			mp4Full("stss", 0, 0, mp4U32(4, 0, 1, testSegmentFrames+1, 26)))...)},
+		{name: "no mdhd", err: true, trak: testTrak(mp4Make("free"), tables...)},
+		{name: "zero timescale", err: true, trak: testTrak(mp4Full("mdhd", 0, 0, make([]byte, 20)), tables...)},
+		{name: "short mdhd", err: true, trak: testTrak(mp4Full("mdhd", 1, 0, make([]byte, 20)), tables...)},
+		{name: "truncated", err: true, trak: valid[:len(valid)/2]},
+		{name: "unsupported codec", trak: testTrak(mdhd, replaceTables(tables,
+			mp4Full("stsd", 0, 0, mp4U32(1), mp4Make("mp4v", make([]byte, 78))))...)},
+	} {
+		size := tc.size
+		if size == 0 {
+			size = 1 << 20
+		}
+		got, err := parseTrak(tc.trak, size)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%s: parsed", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if tc.samples == 0 {
+			if got != nil && len(got.samples) != 0 {
+				t.Errorf("%s: %d samples", tc.name, len(got.samples))
+			}
+			continue
+		}
+		if got == nil || len(got.samples) != tc.samples {
+			t.Errorf("%s: %+v", tc.name, got)
+			continue
+		}
+		if got.codec != codecH264 || got.timescale != 90000 || got.nalLength != 4 {
+			t.Errorf("%s: track %s of %d", tc.name, got.codec, got.timescale)
+		}
+		for i, s := range got.samples {
+			if s.dts != uint64(i*3600) || s.size != testFrameSize || s.sync != (i%25 == 0) {
+				t.Errorf("%s: sample %d %+v", tc.name, i, s)
+				break
+			}
+			if s.offset != int64(offsets[i]) {
+				t.Errorf("%s: sample %d at %d", tc.name, i, s.offset)
+				break
+			}
+		}
+	}
+}
+
+func TestMP4Seek(t *testing.T) {
+	video := testVideoTrack()
+	audio := &mp4Track{codec: codecAAC, timescale: 1000}
+	for i := 0; i < 100; i++ {
+		audio.samples = append(audio.samples, mp4Sample{dts: uint64(i * 20), sync: true})
+	}
+	for _, tc := range []struct {
+		track *mp4Track
+		pos   time.Duration
+		want  int
+	}{
+		// the video starts from the keyframe not after the position.
+		{track: video, pos: 0, want: 0},
+		{track: video, pos: 500 * time.Millisecond, want: 0},
+		{track: video, pos: time.Second, want: 25},
+		{track: video, pos: 1960 * time.Millisecond, want: 25},
+		{track: video, pos: time.Hour, want: 25},
+		{track: video, pos: -time.Second, want: 0},
+		// the audio starts from the first sample not before the position.
+		{track: audio, pos: 0, want: 0},
+		{track: audio, pos: 40 * time.Millisecond, want: 2},
+		{track: audio, pos: 50 * time.Millisecond, want: 3},
+		{track: audio, pos: time.Hour, want: 100},
+	} {
+		if got := tc.track.seek(tc.pos); got != tc.want {
+			t.Errorf("seek the %s track to %v = %d, want %d", tc.track.codec, tc.pos, got, tc.want)
+		}
+	}
+}
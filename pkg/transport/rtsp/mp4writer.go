@@ -0,0 +1,238 @@
+package rtsp
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// the unity matrix of the movie and the tracks.
+var mp4Matrix = []byte{
+	0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0x40, 0, 0, 0,
+}
+
+// mp4Ref is the sample of a track in the order written.
+type mp4Ref struct {
+	track int
+	index int
+}
+
+// mp4Layout returns the boxes ahead of the samples of the file written as a single
+// mp4 file, the order the samples are written in and the size of the file.
+// The moov box is ahead of the samples, so the file can be played while downloading.
+func (m *mp4File) mp4Layout() ([]byte, []mp4Ref, int64) {
+	// the samples of the tracks are interleaved by their decode time.
+	next := make([]int, len(m.tracks))
+	order := make([]mp4Ref, 0)
+	var data int64
+	for {
+		k := -1
+		var at time.Duration
+		for i, t := range m.tracks {
+			if next[i] >= len(t.samples) {
+				continue
+			}
+			if d := t.time(t.samples[next[i]].dts); k < 0 || d < at {
+				k, at = i, d
+			}
+		}
+		if k < 0 {
+			break
+		}
+		order = append(order, mp4Ref{track: k, index: next[k]})
+		data += int64(m.tracks[k].samples[next[k]].size)
+		next[k]++
+	}
+	ftyp := mp4Make("ftyp", []byte("isom"), mp4U32(0x200), []byte("isomiso2avc1mp41"))
+	// the size of the chunk offsets is fixed, so is the moov box.
+	moov := m.moov(order, 0)
+	base := int64(len(ftyp) + len(moov) + 16)
+	moov = m.moov(order, base)
+	head := make([]byte, 0, base)
+	head = append(head, ftyp...)
+	head = append(head, moov...)
+	// the mdat box of the large size.
+	head = append(head, mp4U32(1)...)
+	head = append(head, "mdat"...)
+	head = binary.BigEndian.AppendUint64(head, uint64(16+data))
+	return head, order, base + data
+}
+
+// writeMP4 write the boxes ahead and the samples in the order.
+func (m *mp4File) writeMP4(w io.Writer, head []byte, order []mp4Ref) error {
+	if _, err := w.Write(head); err != nil {
+		return err
+	}
+	var buf []byte
+	var err error
+	for _, r := range order {
+		buf, err = m.readSample(m.tracks[r.track].samples[r.index], buf)
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moov returns the moov box of the samples written in the order from the offset,
+// every sample is a chunk of its own.
+func (m *mp4File) moov(order []mp4Ref, base int64) []byte {
+	offsets := make([][]uint64, len(m.tracks))
+	for i, t := range m.tracks {
+		offsets[i] = make([]uint64, len(t.samples))
+	}
+	at := uint64(base)
+	for _, r := range order {
+		offsets[r.track][r.index] = at
+		at += uint64(m.tracks[r.track].samples[r.index].size)
+	}
+	// the timescale of the movie is in milliseconds.
+	duration := uint64(m.duration / time.Millisecond)
+	parts := [][]byte{mp4Full("mvhd", 1, 0,
+		make([]byte, 16), mp4U32(1000), mp4U64(duration), mp4U32(0x00010000), []byte{1, 0},
+		make([]byte, 10), mp4Matrix, make([]byte, 24), mp4U32(uint32(len(m.tracks)+1)),
+	)}
+	for i, t := range m.tracks {
+		parts = append(parts, t.trak(uint32(i+1), duration, offsets[i]))
+	}
+	return mp4Make("moov", parts...)
+}
+
+// trak returns the trak box of the track, the duration is of the movie timescale.
+func (t *mp4Track) trak(id uint32, duration uint64, offsets []uint64) []byte {
+	volume, handler, name := []byte{1, 0}, "soun", "SoundHandler"
+	header := mp4Full("smhd", 0, 0, make([]byte, 4))
+	if t.codec != codecAAC {
+		volume, handler, name = []byte{0, 0}, "vide", "VideoHandler"
+		header = mp4Full("vmhd", 0, 1, make([]byte, 8))
+	}
+	tkhd := mp4Full("tkhd", 1, 3,
+		make([]byte, 16), mp4U32(id, 0), mp4U64(duration), make([]byte, 12), volume, make([]byte, 2),
+		mp4Matrix, mp4U32(uint32(t.width)<<16, uint32(t.height)<<16),
+	)
+	// the language is und.
+	mdhd := mp4Full("mdhd", 1, 0, make([]byte, 16), mp4U32(t.timescale), mp4U64(t.duration), []byte{0x55, 0xc4, 0, 0})
+	hdlr := mp4Full("hdlr", 0, 0, make([]byte, 4), []byte(handler), make([]byte, 12), []byte(name), []byte{0})
+	dinf := mp4Make("dinf", mp4Full("dref", 0, 0, mp4U32(1), mp4Full("url ", 0, 1)))
+	stbl := mp4Make("stbl", t.sampleTables(offsets)...)
+	return mp4Make("trak", tkhd, mp4Make("mdia", mdhd, hdlr, mp4Make("minf", header, dinf, stbl)))
+}
+
+// delta returns the decode time delta of the sample to the next one, the last
+// sample lasts to the end of the track, or as long as the one before it.
+func (t *mp4Track) delta(i int) uint32 {
+	s := t.samples[i]
+	switch {
+	case i+1 < len(t.samples):
+		return uint32(t.samples[i+1].dts - s.dts)
+	case t.duration > s.dts:
+		return uint32(t.duration - s.dts)
+	case i > 0:
+		return uint32(s.dts - t.samples[i-1].dts)
+	}
+	return 0
+}
+
+// sampleTables returns the boxes of the sample table.
+func (t *mp4Track) sampleTables(offsets []uint64) [][]byte {
+	n := len(t.samples)
+	stsd := mp4Full("stsd", 0, 0, mp4U32(1), mp4Make(t.entry.kind, t.entry.data))
+	// the decode time deltas and the composition offsets are run length encoded.
+	var stts, ctts, stss []byte
+	var deltas, offs uint32
+	composed, synced := false, true
+	var last, lastOffset uint32
+	var count, offsetCount uint32
+	for i, s := range t.samples {
+		delta := t.delta(i)
+		if i > 0 && delta == last {
+			count++
+		} else {
+			if i > 0 {
+				stts = binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(stts, count), last)
+				deltas++
+			}
+			last, count = delta, 1
+		}
+		cts := uint32(s.cts)
+		if s.cts != 0 {
+			composed = true
+		}
+		if i > 0 && cts == lastOffset {
+			offsetCount++
+		} else {
+			if i > 0 {
+				ctts = binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(ctts, offsetCount), lastOffset)
+				offs++
+			}
+			lastOffset, offsetCount = cts, 1
+		}
+		if s.sync {
+			stss = binary.BigEndian.AppendUint32(stss, uint32(i+1))
+		} else {
+			synced = false
+		}
+	}
+	if n > 0 {
+		stts = binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(stts, count), last)
+		deltas++
+		ctts = binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(ctts, offsetCount), lastOffset)
+		offs++
+	}
+	rv := [][]byte{stsd, mp4Full("stts", 0, 0, mp4U32(deltas), stts)}
+	if composed {
+		// the version 1 composition offsets are signed.
+		rv = append(rv, mp4Full("ctts", 1, 0, mp4U32(offs), ctts))
+	}
+	if t.codec != codecAAC && !synced {
+		rv = append(rv, mp4Full("stss", 0, 0, mp4U32(uint32(len(stss)/4)), stss))
+	}
+	sizes := make([]byte, 0, 4*n)
+	chunks := make([]byte, 0, 8*n)
+	for i, s := range t.samples {
+		sizes = binary.BigEndian.AppendUint32(sizes, s.size)
+		chunks = binary.BigEndian.AppendUint64(chunks, offsets[i])
+	}
+	return append(rv,
+		mp4Full("stsz", 0, 0, mp4U32(0, uint32(n)), sizes),
+		mp4Full("stsc", 0, 0, mp4U32(1, 1, 1, 1)),
+		mp4Full("co64", 0, 0, mp4U32(uint32(n)), chunks),
+	)
+}
+
+// mp4Make returns the box of the kind with the parts as its data.
+func mp4Make(kind string, parts ...[]byte) []byte {
+	n := 8
+	for _, p := range parts {
+		n += len(p)
+	}
+	rv := make([]byte, 0, n)
+	rv = binary.BigEndian.AppendUint32(rv, uint32(n))
+	rv = append(rv, kind...)
+	for _, p := range parts {
+		rv = append(rv, p...)
+	}
+	return rv
+}
+
+// mp4Full returns the full box of the kind with the version and the flags.
+func mp4Full(kind string, version byte, flags uint32, parts ...[]byte) []byte {
+	return mp4Make(kind, append([][]byte{mp4U32(uint32(version)<<24 | flags&0xffffff)}, parts...)...)
+}
+
+func mp4U32(vs ...uint32) []byte {
+	rv := make([]byte, 0, 4*len(vs))
+	for _, v := range vs {
+		rv = binary.BigEndian.AppendUint32(rv, v)
+	}
+	return rv
+}
+
+func mp4U64(v uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, v)
+}
@@ -0,0 +1,86 @@
+package rtsp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"golang.org/x/net/ipv4"
+	"net"
+	"sync"
+)
+
+// multicastPool allocates the multicast groups for the channel medias,
+// every group uses the same port pair, rtp on port and rtcp on port+1.
+type multicastPool struct {
+	mu    sync.Mutex
+	ipNet *net.IPNet
+	port  int
+	ttl   int
+	used  map[string]struct{}
+	conn  *net.UDPConn
+}
+
+func newMulticastPool(cidr string, port int, ttl int) (*multicastPool, error) {
+	ip, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	if ip.To4() == nil || !ip.IsMulticast() {
+		return nil, fmt.Errorf("invalid ipv4 multicast range: %s", cidr)
+	}
+	if port <= 0 || port%2 != 0 {
+		return nil, fmt.Errorf("the multicast port must be even: %d", port)
+	}
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, err
+	}
+	err = ipv4.NewPacketConn(conn).SetMulticastTTL(ttl)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return &multicastPool{
+		ipNet: ipNet,
+		port:  port,
+		ttl:   ttl,
+		used:  map[string]struct{}{},
+		conn:  conn,
+	}, nil
+}
+
+// alloc returns the rtp address of a free group.
+func (m *multicastPool) alloc() (*net.UDPAddr, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ones, bits := m.ipNet.Mask.Size()
+	base := binary.BigEndian.Uint32(m.ipNet.IP.To4())
+	for i := uint32(0); i < uint32(1)<<(bits-ones); i++ {
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, base+i)
+		if _, ok := m.used[ip.String()]; ok {
+			continue
+		}
+		m.used[ip.String()] = struct{}{}
+		return &net.UDPAddr{IP: ip, Port: m.port}, nil
+	}
+	return nil, fmt.Errorf("multicast groups exhausted: %s", m.ipNet)
+}
+
+func (m *multicastPool) free(addr *net.UDPAddr) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.used, addr.IP.String())
+}
+
+func (m *multicastPool) send(data []byte, group *net.UDPAddr, rtcp bool) error {
+	addr := group
+	if rtcp {
+		addr = &net.UDPAddr{IP: group.IP, Port: group.Port + 1}
+	}
+	_, err := m.conn.WriteToUDP(data, addr)
+	return err
+}
+
+func (m *multicastPool) close() error {
+	return m.conn.Close()
+}
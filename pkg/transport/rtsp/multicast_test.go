@@ -0,0 +1,78 @@
+package rtsp
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestMulticastSetup(t *testing.T) {
+	// the range of two groups.
+	s, addr := newTestServer(t, Multicast("239.0.0.0/31", 5000, 3), WithChannel("other"))
+	pub := publishClient(t, addr, "live", true)
+	other := publishClient(t, addr, "other", true)
+	defer other.Close()
+	dial := func() (net.Conn, *bufio.Reader) {
+		t.Helper()
+		c, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			_ = c.Close()
+		})
+		return c, bufio.NewReader(c)
+	}
+	setup := func(c net.Conn, br *bufio.Reader, url string, session string) (uint64, string, string) {
+		t.Helper()
+		if session != "" {
+			session = "Session: " + session + "\r\n"
+		}
+		res := rawRequest(t, c, br, "SETUP %s RTSP/1.0\r\nCSeq: 1\r\n%sTransport: RTP/AVP;multicast\r\n\r\n", url, session)
+		tr, _ := res.Header("Transport")
+		id, _ := res.Header("Session")
+		if len(tr) == 0 || len(id) == 0 {
+			return res.Code(), "", ""
+		}
+		return res.Code(), tr[0], strings.Split(id[0], ";")[0]
+	}
+
+	// the medias of the channel have the groups of their own.
+	c, br := dial()
+	code, tr, id := setup(c, br, "rtsp://"+addr+"/live/streamid=0", "")
+	if code != 200 || !strings.Contains(tr, "multicast") || !strings.Contains(tr, "destination=239.0.0.0") ||
+		!strings.Contains(tr, "port=5000-5001") || !strings.Contains(tr, "ttl=3") {
+		t.Fatalf("SETUP %d, Transport %s", code, tr)
+	}
+	code, tr, _ = setup(c, br, "rtsp://"+addr+"/live/streamid=1", id)
+	if code != 200 || !strings.Contains(tr, "destination=239.0.0.1") {
+		t.Fatalf("SETUP %d, Transport %s", code, tr)
+	}
+	// the readers of the channel share the group.
+	c2, br2 := dial()
+	code, tr, _ = setup(c2, br2, "rtsp://"+addr+"/live/streamid=0", "")
+	if code != 200 || !strings.Contains(tr, "destination=239.0.0.0") {
+		t.Fatalf("SETUP %d, Transport %s", code, tr)
+	}
+	// the groups are exhausted by the other channel.
+	c3, br3 := dial()
+	if code, tr, _ = setup(c3, br3, "rtsp://"+addr+"/other/streamid=0", ""); code != 461 {
+		t.Fatalf("SETUP of the exhausted groups %d, Transport %s", code, tr)
+	}
+	// the multicast is not for recording.
+	res := rawRequest(t, c3, br3, "SETUP rtsp://%s/third/streamid=0 RTSP/1.0\r\nCSeq: 2\r\nTransport: RTP/AVP;multicast;mode=record\r\n\r\n", addr)
+	if res.Code() != 461 {
+		t.Fatalf("SETUP of the multicast recording %d", res.Code())
+	}
+
+	// the groups are freed once the source is gone without the playing readers.
+	_ = pub.Close()
+	live, _ := s.tc.GetCh("live")
+	waitFor(t, "the source gone", func() bool {
+		return live.Source() == nil
+	})
+	if code, tr, _ = setup(c3, br3, "rtsp://"+addr+"/other/streamid=0", ""); code != 200 || !strings.Contains(tr, "destination=239.0.0.0") {
+		t.Fatalf("SETUP of the freed group %d, Transport %s", code, tr)
+	}
+}
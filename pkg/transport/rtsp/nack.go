@@ -0,0 +1,257 @@
+package rtsp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"gortc.io/sdp"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const defaultNACKBuffer = 512
+
+// the rtcp transport layer feedback and its generic nack format.
+const (
+	rtcpRTPFB   = 205
+	rtcpNACKFmt = 1
+)
+
+// retransmitter keeps the recent rtp packages sent to the udp media of a reader,
+// and resends the ones the reader reports lost by the generic nack.
+type retransmitter struct {
+	resent uint64
+	mu     sync.Mutex
+	// the packages by their sequence numbers.
+	ring []*Package
+	// the rtx payload types by the original ones, the packages are
+	// resent as they are if rtx is not negotiated for the payload type.
+	rtx  map[uint8]uint8
+	ssrc uint32
+	seq  uint16
+	buf  []byte
+}
+
+func newRetransmitter(size int, rtx map[uint8]uint8) *retransmitter {
+	return &retransmitter{
+		ring: make([]*Package, size),
+		rtx:  rtx,
+		ssrc: rand.Uint32(),
+		seq:  uint16(rand.Uint32()),
+	}
+}
+
+// store the rtp package sent to the reader, it is retained until overwritten.
+func (r *retransmitter) store(p *Package) {
+	if p.Len < 12 {
+		return
+	}
+	seq := binary.BigEndian.Uint16(p.Data[2:])
+	i := int(seq) % len(r.ring)
+	p.retain()
+	r.mu.Lock()
+	old := r.ring[i]
+	r.ring[i] = p
+	r.mu.Unlock()
+	if old != nil {
+		old.release()
+	}
+}
+
+// feedback resend the packages the compound rtcp package reports lost.
+func (r *retransmitter) feedback(data []byte, send func(data []byte) error) {
+	for len(data) >= 12 {
+		n := (int(binary.BigEndian.Uint16(data[2:])) + 1) * 4
+		if n > len(data) {
+			return
+		}
+		if data[1] == rtcpRTPFB && data[0]&0x1f == rtcpNACKFmt {
+			// the pid and blp of the lost packages follow the media ssrc.
+			for fci := data[12:n]; len(fci) >= 4; fci = fci[4:] {
+				pid := binary.BigEndian.Uint16(fci)
+				blp := binary.BigEndian.Uint16(fci[2:])
+				r.resend(pid, send)
+				for i := uint16(0); i < 16; i++ {
+					if blp&(1<<i) != 0 {
+						r.resend(pid+i+1, send)
+					}
+				}
+			}
+		}
+		data = data[n:]
+	}
+}
+
+func (r *retransmitter) resend(seq uint16, send func(data []byte) error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p := r.ring[int(seq)%len(r.ring)]
+	if p == nil || binary.BigEndian.Uint16(p.Data[2:]) != seq {
+		return
+	}
+	data := p.Data[:p.Len]
+	pt, ok := r.rtx[data[1]&0x7f]
+	if !ok {
+		if send(data) == nil {
+			atomic.AddUint64(&r.resent, 1)
+		}
+		return
+	}
+	// the rtx package carries the original sequence number
+	// before the original payload, rfc 4588.
+	payload := rtpPayload(data)
+	if payload == nil {
+		return
+	}
+	n := 12 + int(data[0]&0x0f)*4
+	if data[0]&0x10 != 0 {
+		n += 4 + int(binary.BigEndian.Uint16(data[n+2:]))*4
+	}
+	r.buf = append(r.buf[:0], data[:n]...)
+	r.buf[0] &^= 0x20
+	r.buf[1] = data[1]&0x80 | pt
+	binary.BigEndian.PutUint16(r.buf[2:], r.seq)
+	binary.BigEndian.PutUint32(r.buf[8:], r.ssrc)
+	r.buf = append(r.buf, data[2], data[3])
+	r.buf = append(r.buf, payload...)
+	r.seq++
+	if send(r.buf) == nil {
+		atomic.AddUint64(&r.resent, 1)
+	}
+}
+
+// close release the kept packages.
+func (r *retransmitter) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, p := range r.ring {
+		if p != nil {
+			p.release()
+			r.ring[i] = nil
+		}
+	}
+}
+
+// rtxTypes returns the rtx payload types of the media by the original ones.
+func rtxTypes(m sdp.Media) map[uint8]uint8 {
+	rtx := map[string]bool{}
+	for _, v := range m.Attributes.Values("rtpmap") {
+		// rtpmap example: 97 rtx/90000
+		fields := strings.Fields(v)
+		if len(fields) == 2 && strings.HasPrefix(strings.ToLower(fields[1]), "rtx/") {
+			rtx[fields[0]] = true
+		}
+	}
+	rv := map[uint8]uint8{}
+	for _, v := range m.Attributes.Values("fmtp") {
+		// fmtp example: 97 apt=96
+		fields := strings.Fields(v)
+		if len(fields) != 2 || !rtx[fields[0]] || !strings.HasPrefix(fields[1], "apt=") {
+			continue
+		}
+		pt, err1 := strconv.ParseUint(fields[0], 10, 7)
+		apt, err2 := strconv.ParseUint(strings.TrimPrefix(fields[1], "apt="), 10, 7)
+		if err1 == nil && err2 == nil {
+			rv[uint8(apt)] = uint8(pt)
+		}
+	}
+	return rv
+}
+
+// offerNACK add the generic nack feedback of the payload types to the description,
+// the payload types already having it are kept, rfc 4585.
+func offerNACK(raw []byte) []byte {
+	return mapSections(raw, func(_ int, section [][]byte) [][]byte {
+		formats := strings.Fields(string(section[0]))
+		if len(formats) < 4 || !strings.HasPrefix(formats[2], "RTP/") {
+			return section
+		}
+		offered := map[string]bool{}
+		for _, line := range section[1:] {
+			v := strings.TrimPrefix(string(line), "a=rtcp-fb:")
+			if len(v) == len(line) {
+				continue
+			}
+			// rtcp-fb example: 96 nack
+			if fields := strings.Fields(v); len(fields) == 2 && fields[1] == "nack" {
+				offered[fields[0]] = true
+			}
+		}
+		if offered["*"] {
+			return section
+		}
+		for _, pt := range formats[3:] {
+			if !offered[pt] {
+				section = append(section, []byte("a=rtcp-fb:"+pt+" nack"))
+			}
+		}
+		return section
+	})
+}
+
+// offerRTX add the rtx payload types of the dynamic payload types
+// to the description, the medias already having rtx are kept.
+func offerRTX(raw []byte) []byte {
+	return mapSections(raw, func(_ int, section [][]byte) [][]byte {
+		return offerSectionRTX(section)
+	})
+}
+
+func offerSectionRTX(section [][]byte) [][]byte {
+	formats := strings.Fields(string(section[0]))
+	if len(formats) < 4 {
+		return section
+	}
+	used := map[int]bool{}
+	clocks := map[int]string{}
+	for _, f := range formats[3:] {
+		pt, err := strconv.Atoi(f)
+		if err == nil {
+			used[pt] = true
+		}
+	}
+	for _, line := range section[1:] {
+		v := strings.TrimPrefix(string(line), "a=rtpmap:")
+		if len(v) == len(line) {
+			continue
+		}
+		fields := strings.Fields(v)
+		if len(fields) != 2 {
+			continue
+		}
+		if strings.HasPrefix(strings.ToLower(fields[1]), "rtx/") {
+			return section
+		}
+		pt, err := strconv.Atoi(fields[0])
+		parts := strings.Split(fields[1], "/")
+		if err != nil || pt < 96 || len(parts) < 2 {
+			continue
+		}
+		clocks[pt] = parts[1]
+	}
+	next := 96
+	mline := string(section[0])
+	var attrs [][]byte
+	for pt := 96; pt < 128; pt++ {
+		clock, ok := clocks[pt]
+		if !ok {
+			continue
+		}
+		for next < 128 && used[next] {
+			next++
+		}
+		if next == 128 {
+			break
+		}
+		used[next] = true
+		mline += fmt.Sprintf(" %d", next)
+		attrs = append(attrs,
+			[]byte(fmt.Sprintf("a=rtpmap:%d rtx/%s", next, clock)),
+			[]byte(fmt.Sprintf("a=fmtp:%d apt=%d", next, pt)),
+		)
+	}
+	rv := append([][]byte{[]byte(mline)}, section[1:]...)
+	return append(rv, attrs...)
+}
@@ -0,0 +1,64 @@
+package rtsp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestOfferNACK(t *testing.T) {
+	offer := string(offerNACK([]byte(testSDP + "a=rtcp-fb:97 nack\r\n")))
+	for _, line := range []string{"a=rtcp-fb:96 nack\r\n", "a=rtcp-fb:97 nack\r\n"} {
+		if strings.Count(offer, line) != 1 {
+			t.Errorf("%q offered %d times:\n%s", line, strings.Count(offer, line), offer)
+		}
+	}
+	// the rtx offered along is not fed back itself.
+	offer = string(offerRTX(offerNACK([]byte(testSDP))))
+	if !strings.Contains(offer, "a=fmtp:97 apt=96") || strings.Count(offer, "a=rtcp-fb:") != 2 {
+		t.Errorf("unexpected rtx offer:\n%s", offer)
+	}
+}
+
+func TestRetransmitter(t *testing.T) {
+	// the nack of the package 1 in the rtpfb of the reader.
+	nack := []byte{0x80 | rtcpNACKFmt, rtcpRTPFB, 0, 3, 0, 0, 0, 1, 0, 0, 3, 233, 0, 1, 0, 0}
+	for _, tc := range []struct {
+		name string
+		rtx  map[uint8]uint8
+		pt   byte
+	}{
+		{name: "original", pt: 96},
+		{name: "rtx", rtx: map[uint8]uint8{96: 98}, pt: 98},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newRetransmitter(8, tc.rtx)
+			defer r.close()
+			// the package is released by the channel after sent.
+			p := rtpPackage(0, 1)
+			p.refs = 1
+			r.store(p)
+			original := append([]byte(nil), p.Data[:p.Len]...)
+			p.release()
+			var resent [][]byte
+			r.feedback(nack, func(data []byte) error {
+				resent = append(resent, append([]byte(nil), data...))
+				return nil
+			})
+			if len(resent) != 1 || resent[0][1]&0x7f != tc.pt {
+				t.Fatalf("resent %x", resent)
+			}
+			if tc.rtx == nil {
+				if !bytes.Equal(resent[0], original) {
+					t.Fatalf("resent %x, want %x", resent[0], original)
+				}
+				return
+			}
+			// the original sequence number leads the payload.
+			if seq := binary.BigEndian.Uint16(resent[0][12:]); seq != 1 {
+				t.Fatalf("original sequence number %d", seq)
+			}
+		})
+	}
+}
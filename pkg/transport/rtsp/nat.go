@@ -0,0 +1,169 @@
+package rtsp
+
+import (
+	"encoding/binary"
+	"net"
+	"strconv"
+	"sync"
+
+	"gortc.io/sdp"
+)
+
+// The clients behind the nat send from other ports than the ones
+// in their transport header, so the udp media is bound to the address
+// of the first accepted package and the server sends to that address,
+// the symmetric rtp.
+
+type udpPeer struct {
+	mu   sync.RWMutex
+	rtp  *net.UDPAddr
+	rtcp *net.UDPAddr
+	// the ssrc of the rtp package the rtp address is bound by.
+	ssrc    uint32
+	hasSSRC bool
+}
+
+// the matches of the package from the address behind the nat,
+// the strong ones are by the ssrc or the payload type.
+const (
+	natNone = iota
+	natWeak
+	natStrong
+)
+
+// accept reports whether the package from the addr belongs to the media,
+// ip is the address of the session.
+// The package from the signaled port is always accepted, otherwise it is
+// accepted only if nat is true and it carries the signaled ssrc, or it comes
+// from the session ip if no ssrc signaled.
+func (m *Media) accept(addr *net.UDPAddr, ip net.IP, rtcp bool, data []byte, nat bool) bool {
+	m.peer.mu.Lock()
+	defer m.peer.mu.Unlock()
+	bound, port := &m.peer.rtp, m.rtp
+	// the muxed rtcp comes from the rtp address.
+	if rtcp && !m.mux {
+		bound, port = &m.peer.rtcp, m.rtcp
+	}
+	if *bound != nil {
+		return (*bound).IP.Equal(addr.IP) && (*bound).Port == addr.Port
+	}
+	if !(addr.IP.Equal(ip) && addr.Port == port) && (!nat || m.natMatch(addr, ip, rtcp, data) == natNone) {
+		return false
+	}
+	*bound = addr
+	if ssrc, ok := packageSSRC(data, false); ok && !rtcp {
+		m.peer.ssrc, m.peer.hasSSRC = ssrc, true
+	}
+	return true
+}
+
+// natMatch returns how the package from the addr behind the nat matches the
+// media, the caller holds the lock of the peer.
+// The package with the signaled ssrc matches strongly, and so does the rtp one
+// of the payload type of the media, or the rtcp one with the sender ssrc of the
+// bound rtp. The other packages from the session ip match weakly.
+func (m *Media) natMatch(addr *net.UDPAddr, ip net.IP, rtcp bool, data []byte) int {
+	ssrc, ok := packageSSRC(data, rtcp)
+	if m.hasSSRC {
+		if !ok || ssrc != m.ssrc {
+			return natNone
+		}
+		return natStrong
+	}
+	if !addr.IP.Equal(ip) {
+		return natNone
+	}
+	if rtcp && ok && m.peer.hasSSRC && ssrc == m.peer.ssrc {
+		return natStrong
+	}
+	if !rtcp && ok && m.payloads[data[1]&0x7f] {
+		return natStrong
+	}
+	return natWeak
+}
+
+// learn bind the media the package from the addr behind the nat belongs to,
+// ip is the address of the session of the medias. The only strong match is
+// bound, otherwise the only weak one, the package matching several medias is
+// ambiguous and never bound, so the ports of the medias are not mixed up.
+func learn(medias []*Media, addr *net.UDPAddr, ip net.IP, rtcp bool, data []byte) *Media {
+	var strong, weak []*Media
+	for _, m := range medias {
+		m.peer.mu.RLock()
+		bound := m.peer.rtp
+		if rtcp && !m.mux {
+			bound = m.peer.rtcp
+		}
+		match := natNone
+		if bound == nil {
+			match = m.natMatch(addr, ip, rtcp, data)
+		}
+		m.peer.mu.RUnlock()
+		switch match {
+		case natStrong:
+			strong = append(strong, m)
+		case natWeak:
+			weak = append(weak, m)
+		}
+	}
+	candidates := strong
+	if len(candidates) == 0 {
+		candidates = weak
+	}
+	if len(candidates) != 1 || !candidates[0].accept(addr, ip, rtcp, data, true) {
+		return nil
+	}
+	return candidates[0]
+}
+
+// payloadTypes returns the rtp payload types of the media description.
+func payloadTypes(m sdp.Media) map[uint8]bool {
+	rv := map[uint8]bool{}
+	for _, f := range m.Description.Formats {
+		if pt, err := strconv.ParseUint(f, 10, 7); err == nil {
+			rv[uint8(pt)] = true
+		}
+	}
+	return rv
+}
+
+// dest returns the address the packages of the media are sent to.
+func (m *Media) dest(ip net.IP, rtcp bool) *net.UDPAddr {
+	m.peer.mu.RLock()
+	defer m.peer.mu.RUnlock()
+	if rtcp && !m.mux {
+		if m.peer.rtcp != nil {
+			return m.peer.rtcp
+		}
+		return &net.UDPAddr{IP: ip, Port: m.rtcp}
+	}
+	if m.peer.rtp != nil {
+		return m.peer.rtp
+	}
+	return &net.UDPAddr{IP: ip, Port: m.rtp}
+}
+
+// muxed reports whether the package read on the rtp port is a rtcp one of
+// the muxed media, the rtcp packet types 192-223 conflict with no rtp payload
+// type, rfc 5761. The packages of the port pairs are never muxed.
+func (m *Media) muxed(p *Package) bool {
+	return m != nil && m.mux && p.Ch == 0 && isMuxedRTCP(p.Data[:p.Len])
+}
+
+func isMuxedRTCP(data []byte) bool {
+	return len(data) >= 8 && data[1] >= 192 && data[1] <= 223
+}
+
+// the ssrc of the rtp package, or the sender ssrc of the rtcp package.
+func packageSSRC(data []byte, rtcp bool) (uint32, bool) {
+	if rtcp {
+		if len(data) < 8 {
+			return 0, false
+		}
+		return binary.BigEndian.Uint32(data[4:8]), true
+	}
+	if len(data) < 12 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(data[8:12]), true
+}
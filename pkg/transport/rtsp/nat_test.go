@@ -0,0 +1,84 @@
+package rtsp
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestLearnNATMedias(t *testing.T) {
+	s, addr := newTestServer(t)
+	pub := publishClient(t, addr, "live", false)
+	defer pub.Close()
+	ch, _ := s.tc.GetCh("live")
+	medias := map[int]*Media{}
+	for _, m := range ch.Source().Medias() {
+		medias[m.order] = m
+	}
+	// the ports behind the nat are other than the signaled ones.
+	dial := func(server *net.UDPAddr) *net.UDPConn {
+		t.Helper()
+		c, err := net.DialUDP("udp", nil, server)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			_ = c.Close()
+		})
+		return c
+	}
+	peer := func(m *Media, rtcp bool) *net.UDPAddr {
+		m.peer.mu.RLock()
+		defer m.peer.mu.RUnlock()
+		if rtcp {
+			return m.peer.rtcp
+		}
+		return m.peer.rtp
+	}
+	bound := func(c *net.UDPConn, data []byte, m *Media, rtcp bool) {
+		t.Helper()
+		for i := 0; i < 100; i++ {
+			if _, err := c.Write(data); err != nil {
+				t.Fatal(err)
+			}
+			if a := peer(m, rtcp); a != nil {
+				if a.Port != c.LocalAddr().(*net.UDPAddr).Port {
+					t.Fatalf("the media %d is bound to %v", m.order, a)
+				}
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		t.Fatalf("the media %d is not bound", m.order)
+	}
+	// the sender report of the audio ssrc.
+	sr := make([]byte, 28)
+	sr[0], sr[1] = 0x80, 200
+	binary.BigEndian.PutUint16(sr[2:], 6)
+	binary.BigEndian.PutUint32(sr[4:], 1001)
+
+	// the rtcp matches both medias before the rtp is learned.
+	rtcp := dial(pub.medias[0].rtcpAddr)
+	if _, err := rtcp.Write(sr); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if peer(medias[0], true) != nil || peer(medias[1], true) != nil {
+		t.Fatal("the ambiguous rtcp is learned")
+	}
+	// the rtp is bound by its payload type whatever the order of the medias.
+	for _, order := range []int{1, 0} {
+		p := rtpPackage(order, 0)
+		bound(dial(pub.medias[0].rtpAddr), p.Data[:p.Len], medias[order], false)
+		putPackage(p)
+	}
+	if peer(medias[0], false).Port == peer(medias[1], false).Port {
+		t.Fatal("the medias are bound to the same port")
+	}
+	// the rtcp of the learned ssrc.
+	bound(rtcp, sr, medias[1], true)
+	if peer(medias[0], true) != nil {
+		t.Fatal("the rtcp of the audio is learned by the video")
+	}
+}
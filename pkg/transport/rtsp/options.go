@@ -1,6 +1,7 @@
 package rtsp
 
 import (
+	"crypto/tls"
 	"github.com/ChinasMr/kaka/pkg/log"
 	"time"
 )
@@ -25,6 +26,14 @@ func Network(network string) ServerOption {
 	}
 }
 
+// TLS serve rtsps by the config, the srtp keys are exchanged in the clear
+// only over it, eg: the sdes of the publishers.
+func TLS(config *tls.Config) ServerOption {
+	return func(s *Server) {
+		s.tlsConfig = config
+	}
+}
+
 func Timeout(duration time.Duration) ServerOption {
 	return func(s *Server) {
 		s.timeout = duration
@@ -48,3 +57,178 @@ func WithChannel(ch string) ServerOption {
 		s.chs = append(s.chs, ch)
 	}
 }
+
+// WithPullChannel add a channel sourced by the stream pulled from the source url.
+// The on-demand channel starts pulling when the first reader describes it
+// and stops when the last reader leaves, otherwise it is always pulling.
+func WithPullChannel(ch string, source string, onDemand bool) ServerOption {
+	return func(s *Server) {
+		s.pulls = append(s.pulls, pullChannel{
+			name:     ch,
+			source:   source,
+			onDemand: onDemand,
+		})
+	}
+}
+
+// WithPush relay the channel to the target server once the channel gets a source.
+func WithPush(ch string, target string) ServerOption {
+	return func(s *Server) {
+		if s.pushes == nil {
+			s.pushes = map[string][]string{}
+		}
+		s.pushes[ch] = append(s.pushes[ch], target)
+	}
+}
+
+// Multicast enable the multicast delivery, the groups are allocated
+// from the cidr range and use the port pair port/port+1.
+func Multicast(cidr string, port int, ttl int) ServerOption {
+	return func(s *Server) {
+		s.multicast = &multicastConfig{
+			cidr: cidr,
+			port: port,
+			ttl:  ttl,
+		}
+	}
+}
+
+// UDPPorts allocate the server port pair of every udp session media
+// from the range, instead of sharing the rtp and rtcp sockets.
+func UDPPorts(min int, max int) ServerOption {
+	return func(s *Server) {
+		s.ports = &portRange{
+			min: min,
+			max: max,
+		}
+	}
+}
+
+// ReaderQueue set the queue size of every reader in packages and the policy
+// applied when the queue of a slow reader is full.
+func ReaderQueue(size int, policy string) ServerOption {
+	return func(s *Server) {
+		s.qc = queueConfig{
+			size:   size,
+			policy: policy,
+		}
+	}
+}
+
+// RewriteRTP rewrite the ssrc, sequence number and timestamp of the packages
+// to every reader, so they are continuous across the source changes.
+func RewriteRTP(rewrite bool) ServerOption {
+	return func(s *Server) {
+		s.rewrite = rewrite
+	}
+}
+
+// WithFailover add the backup sources of the channel by their priorities, a backup
+// is either the url it is pulled from or the name of the channel it publishes to.
+// The readers are switched to the next source when the active one stops sending
+// for the interval, and switched back once a source with the higher priority returns.
+func WithFailover(ch string, interval time.Duration, backups ...string) ServerOption {
+	return func(s *Server) {
+		s.failovers = append(s.failovers, failoverChannel{
+			name:     ch,
+			interval: interval,
+			backups:  backups,
+		})
+	}
+}
+
+// Retransmission keep the last size rtp packages of every udp reader media,
+// and resend the ones the reader reports lost by the rtcp generic nack.
+// The nack feedback is offered in the description, and the rtx payload types
+// too if rtx is set. The packages are resent in the rtx format only to the reader
+// opting in by the rtx parameter of its transport, otherwise as they were sent.
+func Retransmission(size int, rtx bool) ServerOption {
+	return func(s *Server) {
+		if size <= 0 {
+			size = defaultNACKBuffer
+		}
+		s.nack = size
+		s.rtx = rtx
+	}
+}
+
+// JitterBuffer reorder the rtp packages of every udp source by their sequence
+// numbers before they reach the channel, a missing package is waited
+// for the latency at most.
+func JitterBuffer(latency time.Duration) ServerOption {
+	return func(s *Server) {
+		s.latency = latency
+	}
+}
+
+// SRTP let the readers play by RTP/SAVP, every reader session encrypts by the keys
+// of its own, from the mikey of its KeyMgmt header, or generated and returned in the
+// KeyMgmt header of the SETUP response over tls. The publishers can record by RTP/SAVP
+// without it.
+func SRTP(enable bool) ServerOption {
+	return func(s *Server) {
+		s.srtp = enable
+	}
+}
+
+// VOD play the mp4 files under the root on demand, eg: rtsp://host/vod/a/b.mp4
+// plays the file a/b.mp4 of the root, it can be sought by Range and paused.
+func VOD(root string) ServerOption {
+	return func(s *Server) {
+		s.vod = newVODLibrary(root)
+	}
+}
+
+// TimeShift buffer the packages of every channel for the window, an hour at most,
+// so the readers can start from the past by the clock Range of PLAY and catch up
+// to the live by the Scale. A channel buffers size bytes at most, 256MB if 0.
+func TimeShift(window time.Duration, size int) ServerOption {
+	return func(s *Server) {
+		if window > maxDVRWindow {
+			window = maxDVRWindow
+		}
+		s.dvr = dvrConfig{
+			window: window,
+			size:   size,
+		}
+	}
+}
+
+// RecordRetention keep the recorded segments of the channel under the vod root for
+// the max age and the max bytes at most, either is unlimited if 0, the oldest
+// segments are deleted first. The policy of the channel * applies to the channels
+// without their own.
+func RecordRetention(ch string, maxAge time.Duration, maxSize int64) ServerOption {
+	return func(s *Server) {
+		if s.retention == nil {
+			s.retention = map[string]retentionPolicy{}
+		}
+		s.retention[ch] = retentionPolicy{
+			maxAge:  maxAge,
+			maxSize: maxSize,
+		}
+	}
+}
+
+// DiskFloor delete the oldest recorded segments of any channel while the free bytes
+// of the disk under the vod root are less than the floor.
+func DiskFloor(free uint64) ServerOption {
+	return func(s *Server) {
+		s.floor = free
+	}
+}
+
+// Webhook post the events of the channels and the complete recorded segments to the
+// url as json, see Event. The body is signed by the hmac-sha256 of the secret in the
+// X-Kaka-Signature header if the secret is not empty. A post times out in the timeout,
+// 5s if 0, and the failed one is retried the times with backoff, 3 if 0.
+func Webhook(url string, secret string, timeout time.Duration, retries int) ServerOption {
+	return func(s *Server) {
+		s.webhooks = append(s.webhooks, webhookConfig{
+			url:     url,
+			secret:  secret,
+			timeout: timeout,
+			retries: retries,
+		})
+	}
+}
@@ -1,15 +1,42 @@
 package rtsp
 
-import "sync"
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+)
 
-var packagePool = sync.Pool{
-	New: func() any {
-		return &Package{Data: make([]byte, 2048)}
-	},
-}
+// maxPackageSize holds the largest interleaved frame and udp datagram.
+const maxPackageSize = 65536
+
+// the size classes of the package buffers, most of the rtp packages
+// fit in the smallest one.
+var packageSizes = []int{2048, 16384, maxPackageSize}
+
+var packagePools = func() []*sync.Pool {
+	rv := make([]*sync.Pool, len(packageSizes))
+	for i, size := range packageSizes {
+		size := size
+		rv[i] = &sync.Pool{
+			New: func() any {
+				return &Package{Data: make([]byte, size)}
+			},
+		}
+	}
+	return rv
+}()
 
-func newPackage() *Package {
-	return packagePool.Get().(*Package)
+// newPackage returns a package from the smallest size class holds size bytes.
+func newPackage(size int) *Package {
+	for i, s := range packageSizes {
+		if size <= s {
+			return packagePools[i].Get().(*Package)
+		}
+	}
+	return &Package{Data: make([]byte, size)}
 }
 
 func putPackage(p *Package) {
@@ -17,7 +44,17 @@ func putPackage(p *Package) {
 	p.Len = 0
 	p.Order = 0
 	p.Interleaved = false
-	packagePool.Put(p)
+	p.refs = 0
+	p.video = false
+	p.key = false
+	p.gen = 0
+	for i, s := range packageSizes {
+		if cap(p.Data) == s {
+			p.Data = p.Data[:s]
+			packagePools[i].Put(p)
+			return
+		}
+	}
 }
 
 type Package struct {
@@ -26,4 +63,89 @@ type Package struct {
 	Order       int
 	Interleaved bool
 	Data        []byte
+	// the package is shared by the queues of the channel.
+	refs  int32
+	video bool
+	key   bool
+	// the source generation of the channel.
+	gen uint32
+}
+
+func (p *Package) retain() {
+	atomic.AddInt32(&p.refs, 1)
+}
+
+// release put the package back to the pool once it is released by all the holders.
+func (p *Package) release() {
+	if atomic.AddInt32(&p.refs, -1) == 0 {
+		putPackage(p)
+	}
+}
+
+// clone copy the data of the package to a pooled one.
+func (p *Package) clone() *Package {
+	rv := newPackage(int(p.Len))
+	copy(rv.Data, p.Data[:p.Len])
+	rv.Len = p.Len
+	rv.Ch = p.Ch
+	rv.Order = p.Order
+	rv.Interleaved = p.Interleaved
+	return rv
+}
+
+// the order of the media and whether it is a rtcp package.
+// the interleaved channel 2n and 2n+1 carry the rtp and rtcp of the media n.
+func (p *Package) media() (int, bool) {
+	if p.Interleaved {
+		return p.Ch / 2, p.Ch%2 == 1
+	}
+	return p.Order, p.Ch == 1
+}
+
+// readUDPPackage read the datagram into the scratch buffer of the reader,
+// then copy it to a package of its size class.
+func readUDPPackage(conn *net.UDPConn, buf []byte) (*Package, *net.UDPAddr, error) {
+	n, addr, err := conn.ReadFromUDP(buf)
+	if err != nil {
+		return nil, nil, err
+	}
+	p := newPackage(n)
+	p.Len = uint32(n)
+	copy(p.Data, buf[:n])
+	return p, addr, nil
+}
+
+// readInterleavedPackage read the interleaved frame, the 4 bytes header
+// buffer is reused by the reader.
+func readInterleavedPackage(rd io.Reader, interleavedHeader []byte) (*Package, error) {
+	_, err := io.ReadFull(rd, interleavedHeader)
+	if err != nil {
+		return nil, err
+	}
+	if interleavedHeader[0] != 0x24 {
+		return nil, fmt.Errorf("magic byte error")
+	}
+	return readInterleavedBody(rd, interleavedHeader)
+}
+
+// readInterleavedBody read the frame of the interleaved header into a package of its size class.
+func readInterleavedBody(rd io.Reader, interleavedHeader []byte) (*Package, error) {
+	frameLen := binary.BigEndian.Uint16(interleavedHeader[2:])
+	p := newPackage(int(frameLen))
+	_, err := io.ReadFull(rd, p.Data[:frameLen])
+	if err != nil {
+		putPackage(p)
+		return nil, err
+	}
+	p.Ch = int(interleavedHeader[1])
+	p.Len = uint32(frameLen)
+	p.Interleaved = true
+	return p, nil
+}
+
+// appendInterleavedFrame append the interleaved header and frame to buf.
+func appendInterleavedFrame(buf []byte, channel int, frame []byte) []byte {
+	buf = append(buf, 0x24, byte(channel), 0, 0)
+	binary.BigEndian.PutUint16(buf[len(buf)-2:], uint16(len(frame)))
+	return append(buf, frame...)
 }
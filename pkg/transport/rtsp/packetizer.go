@@ -0,0 +1,147 @@
+package rtsp
+
+import (
+	"encoding/binary"
+	"math/rand"
+)
+
+// the max rtp payload of the packetized samples, it keeps
+// the udp datagrams under the common mtu.
+const maxRTPPayload = 1400
+
+// packetizer split the mp4 samples of a track into the rtp packages.
+type packetizer struct {
+	codec     string
+	pt        uint8
+	ssrc      uint32
+	seq       uint16
+	nalLength int
+	// the parameter sets sent before every sync sample of the video.
+	params [][]byte
+	// the packages of the sample being packetized.
+	pkts [][]byte
+}
+
+func newPacketizer(t *mp4Track, pt uint8) *packetizer {
+	p := &packetizer{
+		codec:     t.codec,
+		pt:        pt,
+		ssrc:      rand.Uint32(),
+		seq:       uint16(rand.Uint32()),
+		nalLength: t.nalLength,
+	}
+	p.params = append(p.params, t.vps...)
+	p.params = append(p.params, t.sps...)
+	p.params = append(p.params, t.pps...)
+	return p
+}
+
+// packetize returns the rtp packages of the sample at the rtp timestamp,
+// they are valid until the next call.
+func (p *packetizer) packetize(sample []byte, ts uint32, sync bool) [][]byte {
+	p.pkts = p.pkts[:0]
+	if p.codec == codecAAC {
+		p.packetizeAAC(sample, ts)
+		return p.pkts
+	}
+	var nals [][]byte
+	if sync {
+		nals = append(nals, p.params...)
+	}
+	for len(sample) >= p.nalLength {
+		n := 0
+		for _, b := range sample[:p.nalLength] {
+			n = n<<8 | int(b)
+		}
+		sample = sample[p.nalLength:]
+		if n > len(sample) {
+			break
+		}
+		if n > 0 {
+			nals = append(nals, sample[:n])
+		}
+		sample = sample[n:]
+	}
+	for i, nal := range nals {
+		p.packetizeNAL(nal, ts, i == len(nals)-1)
+	}
+	return p.pkts
+}
+
+// packetizeNAL send the nal in a single nal unit package,
+// or in the fragmentation units if it is too large, rfc 6184 and rfc 7798.
+func (p *packetizer) packetizeNAL(nal []byte, ts uint32, last bool) {
+	if len(nal) <= maxRTPPayload {
+		p.add(ts, last, nal)
+		return
+	}
+	var head []byte
+	var payload []byte
+	if p.codec == codecH265 {
+		// the payload header of type 49 and the fu header of the nal type.
+		head = []byte{nal[0]&0x81 | 49<<1, nal[1], nal[0] >> 1 & 0x3f}
+		payload = nal[2:]
+	} else {
+		// the fu indicator of type 28 and the fu header of the nal type.
+		head = []byte{nal[0]&0xe0 | 28, nal[0] & 0x1f}
+		payload = nal[1:]
+	}
+	fu := len(head) - 1
+	for start := true; len(payload) > 0; start = false {
+		n := maxRTPPayload - len(head)
+		if n > len(payload) {
+			n = len(payload)
+		}
+		var h [3]byte
+		copy(h[:], head)
+		if start {
+			h[fu] |= 0x80
+		}
+		end := n == len(payload)
+		if end {
+			h[fu] |= 0x40
+		}
+		p.add(ts, last && end, h[:len(head)], payload[:n])
+		payload = payload[n:]
+	}
+}
+
+// packetizeAAC send the access unit in the AAC-hbr mode with a single
+// au header, the large one is fragmented, rfc 3640.
+func (p *packetizer) packetizeAAC(au []byte, ts uint32) {
+	// the au headers length in bits, and the 13 bits size with the 3 bits index.
+	head := []byte{0, 16, byte(len(au) >> 5), byte(len(au) << 3)}
+	for len(au) > 0 {
+		n := maxRTPPayload - len(head)
+		if n > len(au) {
+			n = len(au)
+		}
+		p.add(ts, n == len(au), head, au[:n])
+		au = au[n:]
+	}
+}
+
+func (p *packetizer) add(ts uint32, marker bool, payload ...[]byte) {
+	// the buffers of the previous sample are reused.
+	var pkt []byte
+	if n := len(p.pkts); n < cap(p.pkts) {
+		pkt = p.pkts[:n+1][n]
+	}
+	if pkt == nil {
+		pkt = make([]byte, 12, 12+maxRTPPayload)
+	}
+	pkt = pkt[:12]
+	pkt[0] = 0x80
+	pkt[1] = p.pt
+	if marker {
+		pkt[1] |= 0x80
+	}
+	binary.BigEndian.PutUint16(pkt[2:], p.seq)
+	binary.BigEndian.PutUint32(pkt[4:], ts)
+	binary.BigEndian.PutUint32(pkt[8:], p.ssrc)
+	for _, b := range payload {
+		pkt = append(pkt, b...)
+	}
+	p.seq++
+	p.pkts = append(p.pkts, pkt)
+}
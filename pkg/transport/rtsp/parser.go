@@ -2,6 +2,8 @@ package rtsp
 
 import (
 	"bufio"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"github.com/ChinasMr/kaka/pkg/transport/rtsp/methods"
 	"io"
@@ -15,24 +17,41 @@ import (
 // text proto reader pool.
 var readerPool sync.Pool
 
-// parse a request from reader.
-func parse0(rd io.Reader) (*request, error) {
-	br := bufio.NewReader(rd)
+// errResponseMessage is returned when the client answers a request of the server,
+// eg: PLAY_NOTIFY, the response is consumed.
+var errResponseMessage = errors.New("response message")
+
+// errInterleavedRequest is returned when a request is in between the interleaved frames,
+// the frames go on being read after the request is handled.
+var errInterleavedRequest = errors.New("interleaved request")
+
+// parse a request from the buffered reader of the connection, the reader
+// is kept across the requests so the pipelined ones are not lost.
+// The version of the request is checked by the server.
+func parse0(br *bufio.Reader) (*request, error) {
 	tp := newTextProtoReader(br)
 	defer func() {
 		putTextProtoReader(tp)
 	}()
+	// the interleaved frames of the client playing on demand are skipped,
+	// eg: the rtcp receiver reports.
+	if err := skipInterleaved(br); err != nil {
+		return nil, err
+	}
 	var s string
 	var err error
 	if s, err = tp.ReadLine(); err != nil {
 		return nil, err
 	}
+	if strings.HasPrefix(s, "RTSP/") {
+		return nil, skipMessage(tp, br)
+	}
 	method, urlRaw, proto, ok := parseRequestLine(s)
 	if !ok {
 		return nil, fmt.Errorf("malformed RTSP request: %s", s)
 	}
-	if proto != Version1 {
-		return nil, fmt.Errorf("unsupported rtsp version: %s", method)
+	if !strings.HasPrefix(proto, "RTSP/") {
+		return nil, fmt.Errorf("unsupported protocol: %s", proto)
 	}
 	urlParsed, err := url.Parse(urlRaw)
 	if err != nil {
@@ -72,6 +91,100 @@ func parse0(rd io.Reader) (*request, error) {
 	}, nil
 }
 
+func skipInterleaved(br *bufio.Reader) error {
+	for {
+		b, err := br.Peek(4)
+		if err != nil {
+			if len(b) > 0 && b[0] != '$' {
+				return nil
+			}
+			return err
+		}
+		if b[0] != '$' {
+			return nil
+		}
+		if _, err = br.Discard(4 + int(binary.BigEndian.Uint16(b[2:]))); err != nil {
+			return err
+		}
+	}
+}
+
+// skipMessage consume the headers and body of the response message.
+func skipMessage(tp *textproto.Reader, br *bufio.Reader) error {
+	mimeHeader, err := tp.ReadMIMEHeader()
+	if err != nil {
+		return err
+	}
+	if cl, ok := mimeHeader["Content-Length"]; ok && len(cl) > 0 {
+		ln, err1 := strconv.ParseInt(cl[0], 10, 64)
+		if err1 != nil {
+			return err1
+		}
+		if _, err1 = io.CopyN(io.Discard, br, ln); err1 != nil {
+			return err1
+		}
+	}
+	return errResponseMessage
+}
+
+// parse a response from the buffered reader.
+func parseResponse(br *bufio.Reader) (*response, error) {
+	tp := newTextProtoReader(br)
+	defer func() {
+		putTextProtoReader(tp)
+	}()
+	s, err := tp.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+	proto, code, st, ok := parseStatusLine(s)
+	if !ok {
+		return nil, fmt.Errorf("malformed RTSP response: %s", s)
+	}
+	if proto != Version1 && proto != Version2 {
+		return nil, fmt.Errorf("unsupported rtsp version: %s", proto)
+	}
+	mimeHeader, err := tp.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	var body []byte
+	cl, ok := mimeHeader["Content-Length"]
+	if ok && len(cl) > 0 {
+		ln, err1 := strconv.ParseUint(cl[0], 10, 64)
+		if err1 != nil {
+			return nil, err1
+		}
+		body = make([]byte, ln)
+		_, err1 = io.ReadFull(br, body)
+		if err1 != nil {
+			return nil, err1
+		}
+	}
+	return &response{
+		proto:   proto,
+		code:    code,
+		status:  st,
+		headers: mimeHeader,
+		body:    body,
+	}, nil
+}
+
+// parse the status line.
+// RTSP/1.0 200 OK
+func parseStatusLine(line string) (string, uint64, string, bool) {
+	proto, rest, ok1 := strings.Cut(line, " ")
+	code, st, _ := strings.Cut(rest, " ")
+	if !ok1 {
+		return "", 0, "", false
+	}
+	c, err := strconv.ParseUint(code, 10, 16)
+	if err != nil {
+		return "", 0, "", false
+	}
+	return proto, c, st, true
+}
+
 // parse the request line.
 // OPTIONS rtsp://192.168.0.1:554/live RTSP/1.0
 func parseRequestLine(line string) (string, string, string, bool) {
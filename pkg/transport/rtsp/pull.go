@@ -0,0 +1,270 @@
+package rtsp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/ChinasMr/kaka/pkg/log"
+	"sync"
+	"time"
+)
+
+const (
+	pullMinBackoff = time.Second
+	pullMaxBackoff = 30 * time.Second
+	// the upstream of an on-demand channel is closed
+	// when there is no reader for this duration.
+	pullLinger = 10 * time.Second
+	// the max duration a reader waits for the on-demand upstream.
+	pullTimeout = 10 * time.Second
+)
+
+// puller feeds the channel with the stream pulled from the source url.
+type puller struct {
+	ch       *channel
+	source   string
+	onDemand bool
+	log      *log.Helper
+	mu       sync.Mutex
+	cancel   context.CancelFunc
+	ready    chan struct{}
+	idle     *time.Timer
+	// the backoff of the reconnection and the linger of the idle upstream.
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	linger     time.Duration
+}
+
+func newPuller(ch *channel, source string, onDemand bool, logger *log.Helper) *puller {
+	return &puller{
+		ch:         ch,
+		source:     source,
+		onDemand:   onDemand,
+		log:        logger,
+		minBackoff: pullMinBackoff,
+		maxBackoff: pullMaxBackoff,
+		linger:     pullLinger,
+	}
+}
+
+// start pulling if it is not running.
+func (p *puller) start() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cancel != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	p.ready = make(chan struct{})
+	go p.run(ctx, p.ready)
+}
+
+func (p *puller) stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.idle != nil {
+		p.idle.Stop()
+		p.idle = nil
+	}
+	if p.cancel == nil {
+		return
+	}
+	p.cancel()
+	p.cancel = nil
+	p.ch.reset()
+}
+
+// demand start the pulling and wait until the presentation description is ready.
+func (p *puller) demand(ctx context.Context) error {
+	p.start()
+	p.mu.Lock()
+	ready := p.ready
+	p.mu.Unlock()
+	// a reader may never play, so the idle timer is armed as well.
+	p.readersChanged(p.ch.readers())
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// readersChanged arms the idle timer of an on-demand channel when the last reader leaves.
+func (p *puller) readersChanged(n int) {
+	if !p.onDemand {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.idle != nil {
+		p.idle.Stop()
+		p.idle = nil
+	}
+	if n > 0 || p.cancel == nil {
+		return
+	}
+	p.idle = time.AfterFunc(p.linger, func() {
+		if p.ch.readers() == 0 {
+			p.log.Debugf("close idle upstream %s of channel %s", p.source, p.ch.name)
+			p.stop()
+		}
+	})
+}
+
+// run pull the source until canceled, reconnect with backoff.
+func (p *puller) run(ctx context.Context, ready chan struct{}) {
+	once := &sync.Once{}
+	backoff := p.minBackoff
+	for {
+		begin := time.Now()
+		err := p.pull(ctx, func() {
+			once.Do(func() { close(ready) })
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		p.log.Errorf("pull %s for channel %s: %v", p.source, p.ch.name, err)
+		// the upstream has been stable for a while.
+		if time.Since(begin) > p.maxBackoff {
+			backoff = p.minBackoff
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > p.maxBackoff {
+			backoff = p.maxBackoff
+		}
+	}
+}
+
+func (p *puller) pull(ctx context.Context, ready func()) error {
+	client := NewClient()
+	defer func() {
+		_ = client.Close()
+	}()
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = client.Close()
+		case <-client.Done():
+		}
+	}()
+	err := client.Dial(ctx, p.source)
+	if err != nil {
+		return err
+	}
+	msg, raw, err := client.Describe()
+	if err != nil {
+		return err
+	}
+	for _, m := range msg.Medias {
+		err = client.Setup(m.Attribute("control"), false)
+		if err != nil {
+			return err
+		}
+	}
+	err = client.Play()
+	if err != nil {
+		return err
+	}
+	local := rewriteControls(raw)
+	desc, err := decodeSDP(local)
+	if err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	p.ch.setDescription(desc, local)
+	p.log.Debugf("channel %s is pulling from %s", p.ch.name, p.source)
+	p.ch.online()
+	// the pulled source is published until the upstream drops.
+	p.notify(EventPublish)
+	defer p.notify(EventUnpublish)
+	ready()
+
+	// the interleaved channels are mapped to the order of media.
+	client.mu.Lock()
+	kinds := map[int]int{}
+	for _, m := range client.medias {
+		kinds[m.rtp] = 2 * m.order
+		kinds[m.rtcp] = 2*m.order + 1
+	}
+	client.mu.Unlock()
+	for {
+		pk, err1 := client.ReadPackage()
+		if err1 != nil {
+			return err1
+		}
+		if pk.Interleaved {
+			k, ok := kinds[pk.Ch]
+			if !ok {
+				putPackage(pk)
+				continue
+			}
+			pk.Order = k / 2
+			pk.Ch = k % 2
+			pk.Interleaved = false
+		}
+		select {
+		case p.ch.input <- pk:
+		case <-ctx.Done():
+			putPackage(pk)
+			return ctx.Err()
+		}
+	}
+}
+
+// notify emit the event of the pulled source on the channel.
+func (p *puller) notify(kind string) {
+	p.ch.cc.hooks.emit(Event{
+		Type:    kind,
+		Channel: p.ch.name,
+		Source:  p.source,
+	})
+}
+
+// rewrite the control attributes of the upstream description,
+// so the readers can set up the streams with the local urls.
+func rewriteControls(raw []byte) []byte {
+	buf := bytes.Buffer{}
+	order := -1
+	controlled := true
+	flush := func() {
+		if !controlled {
+			buf.WriteString(fmt.Sprintf("a=control:streamid=%d\r\n", order))
+			controlled = true
+		}
+	}
+	for _, line := range bytes.Split(raw, []byte("\n")) {
+		line = bytes.TrimRight(line, "\r")
+		if len(line) == 0 {
+			continue
+		}
+		if bytes.HasPrefix(line, []byte("m=")) {
+			flush()
+			order++
+			controlled = false
+		}
+		if bytes.HasPrefix(line, []byte("a=control:")) {
+			if order == -1 {
+				buf.WriteString("a=control:*\r\n")
+				continue
+			}
+			if !controlled {
+				buf.WriteString(fmt.Sprintf("a=control:streamid=%d\r\n", order))
+				controlled = true
+			}
+			continue
+		}
+		buf.Write(line)
+		buf.WriteString("\r\n")
+	}
+	flush()
+	return buf.Bytes()
+}
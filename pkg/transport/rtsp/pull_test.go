@@ -0,0 +1,202 @@
+package rtsp
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ChinasMr/kaka/pkg/log"
+)
+
+func TestRewriteControls(t *testing.T) {
+	for _, tc := range []struct {
+		name, raw, want string
+	}{
+		{
+			name: "absolute urls",
+			raw: "v=0\r\ns=up\r\na=control:rtsp://up/live\r\n" +
+				"m=video 0 RTP/AVP 96\r\na=rtpmap:96 H264/90000\r\na=control:rtsp://up/live/trackID=1\r\n" +
+				"m=audio 0 RTP/AVP 97\r\na=control:trackID=2\r\na=rtpmap:97 MPEG4-GENERIC/44100/2\r\n",
+			want: "v=0\r\ns=up\r\na=control:*\r\n" +
+				"m=video 0 RTP/AVP 96\r\na=rtpmap:96 H264/90000\r\na=control:streamid=0\r\n" +
+				"m=audio 0 RTP/AVP 97\r\na=control:streamid=1\r\na=rtpmap:97 MPEG4-GENERIC/44100/2\r\n",
+		},
+		{
+			name: "no controls",
+			raw:  "v=0\ns=up\nm=video 0 RTP/AVP 96\na=rtpmap:96 H264/90000\nm=audio 0 RTP/AVP 97\n",
+			want: "v=0\r\ns=up\r\nm=video 0 RTP/AVP 96\r\na=rtpmap:96 H264/90000\r\na=control:streamid=0\r\n" +
+				"m=audio 0 RTP/AVP 97\r\na=control:streamid=1\r\n",
+		},
+		{
+			name: "duplicated controls",
+			raw:  "v=0\r\nm=video 0 RTP/AVP 96\r\na=control:a\r\na=control:b\r\n\r\n",
+			want: "v=0\r\nm=video 0 RTP/AVP 96\r\na=control:streamid=0\r\n",
+		},
+		{
+			name: "no medias",
+			raw:  "v=0\r\ns=up\r\n",
+			want: "v=0\r\ns=up\r\n",
+		},
+	} {
+		if got := string(rewriteControls([]byte(tc.raw))); got != tc.want {
+			t.Errorf("%s: rewritten\n%q\nwant\n%q", tc.name, got, tc.want)
+		}
+	}
+}
+
+// waitFor polls the condition for a while.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for i := 0; i < 300; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func TestPullOnDemand(t *testing.T) {
+	us, upstream := newTestServer(t)
+	pub := publishClient(t, upstream, "live", true)
+	defer pub.Close()
+	live, _ := us.tc.GetCh("live")
+	s, addr := newTestServer(t, WithPullChannel("pulled", "rtsp://"+upstream+"/live", true))
+	p := s.pullers[0]
+	p.mu.Lock()
+	p.linger = 200 * time.Millisecond
+	p.mu.Unlock()
+	pulling := func() bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return p.cancel != nil
+	}
+	upstreamReaders := func(n int) func() bool {
+		return func() bool {
+			return live.(*channel).readers() == n
+		}
+	}
+	// the on-demand source is not pulled until described.
+	time.Sleep(300 * time.Millisecond)
+	if pulling() || live.(*channel).readers() != 0 {
+		t.Fatal("the on-demand source is pulled without a reader")
+	}
+	describe := func(c net.Conn, br *bufio.Reader) string {
+		t.Helper()
+		res := rawRequest(t, c, br, "DESCRIBE rtsp://%s/pulled RTSP/1.0\r\nCSeq: 1\r\n\r\n", addr)
+		if res.Code() != 200 || !strings.Contains(string(res.Body()), "a=control:streamid=1") {
+			t.Fatalf("DESCRIBE %d:\n%s", res.Code(), res.Body())
+		}
+		return "rtsp://" + addr + "/pulled"
+	}
+
+	// the upstream is closed after the reader describing only is gone for the linger.
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	describe(c, bufio.NewReader(c))
+	waitFor(t, "the upstream reader", upstreamReaders(1))
+	_ = c.Close()
+	waitFor(t, "the idle upstream closed", func() bool {
+		return !pulling() && live.(*channel).readers() == 0
+	})
+
+	// the upstream is kept while the reader plays.
+	c, err = net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	br := bufio.NewReader(c)
+	url := describe(c, br)
+	res := rawRequest(t, c, br, "SETUP %s/streamid=0 RTSP/1.0\r\nCSeq: 2\r\nTransport: RTP/AVP/TCP;unicast;interleaved=0-1\r\n\r\n", url)
+	session, _ := res.Header("Session")
+	if res.Code() != 200 || len(session) == 0 {
+		t.Fatalf("SETUP %d", res.Code())
+	}
+	id := strings.Split(session[0], ";")[0]
+	res = rawRequest(t, c, br, "SETUP %s/streamid=1 RTSP/1.0\r\nCSeq: 3\r\nSession: %s\r\nTransport: RTP/AVP/TCP;unicast;interleaved=2-3\r\n\r\n", url, id)
+	if res.Code() != 200 {
+		t.Fatalf("SETUP %d", res.Code())
+	}
+	res = rawRequest(t, c, br, "PLAY %s RTSP/1.0\r\nCSeq: 4\r\nSession: %s\r\n\r\n", url, id)
+	if res.Code() != 200 {
+		t.Fatalf("PLAY %d", res.Code())
+	}
+	time.Sleep(600 * time.Millisecond)
+	if !pulling() || live.(*channel).readers() != 1 {
+		t.Fatal("the upstream is closed while the reader plays")
+	}
+	_, _ = c.Write([]byte("TEARDOWN " + url + " RTSP/1.0\r\nCSeq: 5\r\nSession: " + id + "\r\n\r\n"))
+	waitFor(t, "the upstream closed after the teardown", func() bool {
+		return !pulling() && live.(*channel).readers() == 0
+	})
+}
+
+func TestPullBackoff(t *testing.T) {
+	const minBackoff, maxBackoff = 20 * time.Millisecond, 500 * time.Millisecond
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	const stable = 4
+	var (
+		mu       sync.Mutex
+		accepted []time.Time
+		closed   time.Time
+	)
+	go func() {
+		for {
+			c, err1 := lis.Accept()
+			if err1 != nil {
+				return
+			}
+			mu.Lock()
+			accepted = append(accepted, time.Now())
+			n := len(accepted)
+			mu.Unlock()
+			// the upstream is stable for longer than the max backoff once.
+			if n == stable+1 {
+				time.Sleep(maxBackoff * 3 / 2)
+			}
+			_ = c.Close()
+			if n == stable+1 {
+				mu.Lock()
+				closed = time.Now()
+				mu.Unlock()
+			}
+		}
+	}()
+	p := newPuller(newChannel("pulled", defaultChannelConfig), "rtsp://"+lis.Addr().String()+"/live", false, log.NewHelper(log.DefaultLogger))
+	p.minBackoff, p.maxBackoff = minBackoff, maxBackoff
+	p.start()
+	defer p.stop()
+	var gaps []time.Duration
+	waitFor(t, "the reconnections", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(accepted) < stable+2 {
+			return false
+		}
+		for i := 1; i < stable+1; i++ {
+			gaps = append(gaps, accepted[i].Sub(accepted[i-1]))
+		}
+		gaps = append(gaps, accepted[stable+1].Sub(closed))
+		return true
+	})
+	// the backoff doubles after every failure.
+	for i := 0; i < stable; i++ {
+		if want := minBackoff << i; gaps[i] < want {
+			t.Errorf("reconnected after %v, want %v at least", gaps[i], want)
+		}
+	}
+	// and is reset once the upstream has been stable.
+	if gaps[stable] >= maxBackoff/2 {
+		t.Errorf("reconnected after %v of the stable upstream", gaps[stable])
+	}
+}
@@ -0,0 +1,250 @@
+package rtsp
+
+import (
+	"context"
+	"fmt"
+	"github.com/ChinasMr/kaka/pkg/log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	PushIdle       = "idle"
+	PushConnecting = "connecting"
+	PushPushing    = "pushing"
+	PushFailed     = "failed"
+)
+
+// PushStatus is the status of a push relay.
+type PushStatus struct {
+	Channel string
+	Target  string
+	State   string
+	Error   string
+	Retries uint32
+	Packets uint64
+	Dropped uint64
+	Since   time.Time
+}
+
+// pusher relays the channel to the target server by ANNOUNCE and RECORD,
+// it runs while the channel has a source.
+type pusher struct {
+	packets uint64
+	dropped uint64
+	ch      *channel
+	target  string
+	log     *log.Helper
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	client  *Client
+	queue   *packageQueue
+	qc      queueConfig
+	state   string
+	err     error
+	retries uint32
+	since   time.Time
+}
+
+func newPusher(ch *channel, target string, qc queueConfig, logger *log.Helper) *pusher {
+	return &pusher{
+		ch:     ch,
+		target: target,
+		qc:     qc,
+		log:    logger,
+		state:  PushIdle,
+		since:  time.Now(),
+	}
+}
+
+func (p *pusher) start() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cancel != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	p.retries = 0
+	go p.run(ctx)
+}
+
+func (p *pusher) stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cancel == nil {
+		return
+	}
+	p.cancel()
+	p.cancel = nil
+	p.detach()
+	p.setState(PushIdle, nil)
+}
+
+func (p *pusher) Status() PushStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	rv := PushStatus{
+		Channel: p.ch.name,
+		Target:  p.target,
+		State:   p.state,
+		Retries: p.retries,
+		Packets: atomic.LoadUint64(&p.packets),
+		Dropped: atomic.LoadUint64(&p.dropped),
+		Since:   p.since,
+	}
+	if p.queue != nil {
+		_, _, dropped := p.queue.stats()
+		rv.Dropped += dropped
+	}
+	if p.err != nil {
+		rv.Error = p.err.Error()
+	}
+	return rv
+}
+
+// detach the client and its queue, must be called with the lock held.
+func (p *pusher) detach() {
+	if p.queue != nil {
+		p.queue.close()
+		_, _, dropped := p.queue.stats()
+		atomic.AddUint64(&p.dropped, dropped)
+	}
+	p.client = nil
+	p.queue = nil
+}
+
+// must be called with the lock held.
+func (p *pusher) setState(state string, err error) {
+	if p.state != state {
+		p.since = time.Now()
+	}
+	p.state = state
+	p.err = err
+}
+
+func (p *pusher) run(ctx context.Context) {
+	backoff := pullMinBackoff
+	for {
+		begin := time.Now()
+		err := p.push(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		p.log.Errorf("push channel %s to %s: %v", p.ch.name, p.target, err)
+		p.mu.Lock()
+		if ctx.Err() == nil {
+			p.detach()
+			p.retries++
+			p.setState(PushFailed, err)
+		}
+		p.mu.Unlock()
+		if time.Since(begin) > pullMaxBackoff {
+			backoff = pullMinBackoff
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > pullMaxBackoff {
+			backoff = pullMaxBackoff
+		}
+	}
+}
+
+func (p *pusher) push(ctx context.Context) error {
+	p.mu.Lock()
+	if ctx.Err() == nil {
+		p.setState(PushConnecting, p.err)
+	}
+	p.mu.Unlock()
+
+	client := NewClient()
+	defer func() {
+		_ = client.Close()
+	}()
+	// the handshake is cut off once the pusher stops.
+	connected := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = client.Close()
+		case <-connected:
+		case <-client.Done():
+		}
+	}()
+	err := client.Dial(ctx, p.target)
+	if err != nil {
+		return err
+	}
+	raw := rewriteControls(p.ch.Raw())
+	desc, err := decodeSDP(raw)
+	if err != nil {
+		return err
+	}
+	err = client.Announce(raw)
+	if err != nil {
+		return err
+	}
+	for i := range desc.Medias {
+		err = client.Setup(fmt.Sprintf("streamid=%d", i), true)
+		if err != nil {
+			return err
+		}
+	}
+	err = client.Record()
+	if err != nil {
+		return err
+	}
+	close(connected)
+	// the rtcp reports of the target are dropped,
+	// so the client never blocks on reading them.
+	go func() {
+		for {
+			pk, err1 := client.ReadPackage()
+			if err1 != nil {
+				return
+			}
+			putPackage(pk)
+		}
+	}()
+	p.mu.Lock()
+	// the pusher may be stopped while connecting.
+	if ctx.Err() == nil {
+		p.client = client
+		p.queue = newPackageQueue(p.qc, func(pk *Package) error {
+			err1 := client.WritePackage(pk)
+			if err1 == nil {
+				atomic.AddUint64(&p.packets, 1)
+			}
+			return err1
+		}, func() {
+			p.log.Errorf("push channel %s to %s: the target is too slow", p.ch.name, p.target)
+			_ = client.Close()
+		})
+		p.setState(PushPushing, nil)
+	}
+	p.mu.Unlock()
+	p.log.Debugf("channel %s is pushing to %s", p.ch.name, p.target)
+
+	select {
+	case <-ctx.Done():
+		_ = client.Teardown()
+		return ctx.Err()
+	case <-client.Done():
+		return client.Err()
+	}
+}
+
+// forward the package of the channel to the queue of the target.
+func (p *pusher) forward(pk *Package) {
+	p.mu.Lock()
+	queue := p.queue
+	p.mu.Unlock()
+	if queue != nil {
+		queue.push(pk)
+	}
+}
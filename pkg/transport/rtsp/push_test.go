@@ -0,0 +1,81 @@
+package rtsp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ChinasMr/kaka/pkg/transport/rtsp/header"
+	"github.com/ChinasMr/kaka/pkg/transport/rtsp/methods"
+)
+
+// answerPush answer the requests of the pusher by 200 until the one of the method,
+// the transport of the setup is echoed.
+func answerPush(t *testing.T, c net.Conn, br *bufio.Reader, until methods.Method) {
+	t.Helper()
+	for {
+		_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+		req, err := parse0(br)
+		if err != nil {
+			t.Fatalf("read the request of the pusher: %v", err)
+		}
+		res := fmt.Sprintf("RTSP/1.0 200 OK\r\nCSeq: %s\r\nSession: 42\r\n", req.cSeq)
+		if tr, ok := req.Header(header.Transport); ok && len(tr) > 0 {
+			res += "Transport: " + tr[0] + "\r\n"
+		}
+		if _, err = io.WriteString(c, res+"\r\n"); err != nil {
+			t.Fatal(err)
+		}
+		if req.Method() == until {
+			return
+		}
+	}
+}
+
+func TestPushDropsTargetReports(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	s, addr := newTestServer(t, WithPush("live", "rtsp://"+lis.Addr().String()+"/edge"))
+	pub := publishClient(t, addr, "live", true)
+	defer pub.Close()
+	accept := func() (net.Conn, *bufio.Reader) {
+		t.Helper()
+		_ = lis.(*net.TCPListener).SetDeadline(time.Now().Add(5 * time.Second))
+		c, err1 := lis.Accept()
+		if err1 != nil {
+			t.Fatalf("the pusher does not connect: %v", err1)
+		}
+		return c, bufio.NewReader(c)
+	}
+
+	// the receiver reports of the target fill the packages of the client,
+	// the pusher reconnects once the target drops.
+	c, br := accept()
+	answerPush(t, c, br, methods.RECORD)
+	rr := []byte{'$', 1, 0, 8, 0x80, 201, 0, 1, 0, 0, 0, 42}
+	for i := 0; i < 200; i++ {
+		if _, err = c.Write(rr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = c.Close()
+	c, br = accept()
+	defer c.Close()
+
+	// the handshake in flight is cut off once the pusher stops.
+	_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err = parse0(br); err != nil {
+		t.Fatal(err)
+	}
+	s.pushers[0].stop()
+	_ = c.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err = br.ReadByte(); err != io.EOF {
+		t.Fatalf("the connection of the stopped pusher: %v", err)
+	}
+}
@@ -0,0 +1,180 @@
+package rtsp
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// the policies applied when the queue of a slow reader is full.
+const (
+	PolicyDropOldest        = "drop_oldest"
+	PolicyDropUntilKeyframe = "drop_until_keyframe"
+	PolicyDisconnect        = "disconnect"
+)
+
+const defaultQueueSize = 512
+
+type queueConfig struct {
+	size   int
+	policy string
+}
+
+var defaultQueueConfig = queueConfig{
+	size:   defaultQueueSize,
+	policy: PolicyDropOldest,
+}
+
+func (c queueConfig) validate() error {
+	if c.size <= 0 {
+		return fmt.Errorf("invalid queue size: %d", c.size)
+	}
+	switch c.policy {
+	case PolicyDropOldest, PolicyDropUntilKeyframe, PolicyDisconnect:
+		return nil
+	}
+	return fmt.Errorf("invalid slow reader policy: %s", c.policy)
+}
+
+// packageQueue is the bounded ring buffer of a consumer, the packages
+// are written by its own goroutine, so a slow consumer never blocks
+// the channel and the others.
+type packageQueue struct {
+	sent       uint64
+	dropped    uint64
+	mu         sync.Mutex
+	cond       *sync.Cond
+	ring       []*Package
+	head       int
+	size       int
+	policy     string
+	waiting    bool
+	closed     bool
+	overflowed bool
+	write      func(p *Package) error
+	overflow   func()
+	done       chan struct{}
+}
+
+// newPackageQueue start the writer of the queue, overflow is called
+// by the writer if the queue is full and the policy is disconnect.
+func newPackageQueue(c queueConfig, write func(p *Package) error, overflow func()) *packageQueue {
+	q := &packageQueue{
+		ring:     make([]*Package, c.size),
+		policy:   c.policy,
+		write:    write,
+		overflow: overflow,
+		done:     make(chan struct{}),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	go q.run()
+	return q
+}
+
+// push the shared package to the queue without blocking.
+func (q *packageQueue) push(p *Package) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	// the video is dropped until the next keyframe to be decodable.
+	if q.waiting && p.video {
+		if !p.key {
+			atomic.AddUint64(&q.dropped, 1)
+			return
+		}
+		q.waiting = false
+	}
+	if q.size == len(q.ring) {
+		switch q.policy {
+		case PolicyDropOldest:
+			q.ring[q.head].release()
+			q.ring[q.head] = nil
+			q.head = (q.head + 1) % len(q.ring)
+			q.size--
+			atomic.AddUint64(&q.dropped, 1)
+		case PolicyDropUntilKeyframe:
+			atomic.AddUint64(&q.dropped, uint64(q.size))
+			q.clear()
+			if p.video && !p.key {
+				q.waiting = true
+				atomic.AddUint64(&q.dropped, 1)
+				return
+			}
+			q.waiting = !p.key
+		case PolicyDisconnect:
+			atomic.AddUint64(&q.dropped, uint64(q.size)+1)
+			q.closed = true
+			q.overflowed = true
+			q.clear()
+			q.cond.Broadcast()
+			return
+		}
+	}
+	p.retain()
+	q.ring[(q.head+q.size)%len(q.ring)] = p
+	q.size++
+	q.cond.Signal()
+}
+
+// release the queued packages, must be called with the lock held.
+func (q *packageQueue) clear() {
+	for q.size > 0 {
+		q.ring[q.head].release()
+		q.ring[q.head] = nil
+		q.head = (q.head + 1) % len(q.ring)
+		q.size--
+	}
+}
+
+func (q *packageQueue) run() {
+	defer close(q.done)
+	for {
+		q.mu.Lock()
+		for q.size == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		if q.closed {
+			q.clear()
+			overflowed := q.overflowed
+			q.mu.Unlock()
+			// the overflow is called by the writer, so the consumer
+			// is still alive until the writer exits.
+			if overflowed && q.overflow != nil {
+				q.overflow()
+			}
+			return
+		}
+		p := q.ring[q.head]
+		q.ring[q.head] = nil
+		q.head = (q.head + 1) % len(q.ring)
+		q.size--
+		q.mu.Unlock()
+
+		if q.write(p) == nil {
+			atomic.AddUint64(&q.sent, 1)
+		}
+		p.release()
+	}
+}
+
+func (q *packageQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+// wait for the writer exits after closed.
+func (q *packageQueue) wait() {
+	<-q.done
+}
+
+// the number of the queued, sent and dropped packages.
+func (q *packageQueue) stats() (int, uint64, uint64) {
+	q.mu.Lock()
+	queued := q.size
+	q.mu.Unlock()
+	return queued, atomic.LoadUint64(&q.sent), atomic.LoadUint64(&q.dropped)
+}
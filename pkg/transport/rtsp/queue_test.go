@@ -0,0 +1,123 @@
+package rtsp
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPackageQueueOverflow(t *testing.T) {
+	type push struct {
+		seq        uint16
+		video, key bool
+	}
+	audio := func(seqs ...uint16) []push {
+		rv := make([]push, 0, len(seqs))
+		for _, seq := range seqs {
+			rv = append(rv, push{seq: seq})
+		}
+		return rv
+	}
+	for _, tc := range []struct {
+		policy  string
+		pushes  []push
+		queued  int
+		written []uint16
+		dropped uint64
+		closed  bool
+	}{
+		{
+			policy: PolicyDropOldest,
+			pushes: audio(1, 2, 3, 4, 5, 6),
+			// the oldest 1 and 2 are dropped for 5 and 6.
+			queued: 4, written: []uint16{0, 3, 4, 5, 6}, dropped: 2,
+		},
+		{
+			policy: PolicyDropUntilKeyframe,
+			pushes: []push{
+				{seq: 1, video: true}, {seq: 2, video: true}, {seq: 3, video: true}, {seq: 4, video: true},
+				// the queue is cleared and the video waits for the keyframe.
+				{seq: 5, video: true},
+				{seq: 6},
+				{seq: 7, video: true},
+				{seq: 8, video: true, key: true},
+				{seq: 9, video: true},
+			},
+			queued: 3, written: []uint16{0, 6, 8, 9}, dropped: 6,
+		},
+		{
+			policy: PolicyDropUntilKeyframe,
+			pushes: []push{
+				{seq: 1, video: true}, {seq: 2, video: true}, {seq: 3, video: true}, {seq: 4, video: true},
+				// the keyframe is queued once the queue is cleared.
+				{seq: 5, video: true, key: true},
+				{seq: 6, video: true},
+			},
+			queued: 2, written: []uint16{0, 5, 6}, dropped: 4,
+		},
+		{
+			policy: PolicyDisconnect,
+			pushes: audio(1, 2, 3, 4, 5, 6),
+			// the queued and the overflowed are dropped, the later are ignored.
+			queued: 0, written: []uint16{0}, dropped: 5, closed: true,
+		},
+	} {
+		taken := make(chan uint16, 16)
+		resume := make(chan struct{})
+		overflowed := make(chan struct{})
+		q := newPackageQueue(queueConfig{size: 4, policy: tc.policy}, func(p *Package) error {
+			taken <- binary.BigEndian.Uint16(p.Data[2:])
+			<-resume
+			return nil
+		}, func() {
+			close(overflowed)
+		})
+		pushPackage := func(pp push) {
+			p := rtpPackage(0, pp.seq)
+			p.refs = 1
+			p.video, p.key = pp.video, pp.key
+			q.push(p)
+			p.release()
+		}
+		// the writer is blocked by the first package.
+		pushPackage(push{seq: 0})
+		<-taken
+		for _, pp := range tc.pushes {
+			pushPackage(pp)
+		}
+		if queued, _, dropped := q.stats(); queued != tc.queued || dropped != tc.dropped {
+			t.Fatalf("%s: %d queued, %d dropped", tc.policy, queued, dropped)
+		}
+		close(resume)
+		if tc.closed {
+			// the writer exits by itself.
+			q.wait()
+			select {
+			case <-overflowed:
+			default:
+				t.Fatalf("%s: the overflow is not called", tc.policy)
+			}
+		} else {
+			deadline := time.Now().Add(time.Second)
+			for _, sent, _ := q.stats(); sent != uint64(len(tc.written)); _, sent, _ = q.stats() {
+				if time.Now().After(deadline) {
+					t.Fatalf("%s: %d sent", tc.policy, sent)
+				}
+				time.Sleep(time.Millisecond)
+			}
+			q.close()
+			q.wait()
+		}
+		written := []uint16{0}
+		for len(taken) > 0 {
+			written = append(written, <-taken)
+		}
+		if !reflect.DeepEqual(written, tc.written) {
+			t.Errorf("%s: written %v, want %v", tc.policy, written, tc.written)
+		}
+		if _, _, dropped := q.stats(); dropped != tc.dropped {
+			t.Errorf("%s: %d dropped", tc.policy, dropped)
+		}
+	}
+}
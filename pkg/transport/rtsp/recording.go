@@ -0,0 +1,404 @@
+package rtsp
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/ChinasMr/kaka/pkg/log"
+	"github.com/ChinasMr/kaka/pkg/transport/rtsp/header"
+	"io/fs"
+	"math"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// playbackPrefix is the path prefix of the recordings played by the time range,
+// eg: rtsp://host/playback/camera/20231019T100300Z-20231019T101700Z
+const playbackPrefix = "/playback/"
+
+// the segment is named by the wall clock time it starts at, eg: 20231019T100000Z.mp4
+const segmentLayout = "20060102T150405.999999999Z"
+
+// the segments are scanned once in the interval at most.
+const recordScanInterval = 5 * time.Second
+
+// the longest range of a recording played or downloaded, the samples of the range
+// are indexed in memory. The open or longer ranges played by rtsp are cut to it.
+const maxRecordingRange = 6 * time.Hour
+
+// RecordSegment is a recorded mp4 file of a channel.
+type RecordSegment struct {
+	Channel string `json:"channel"`
+	// the path of the file relative to the root.
+	Path  string    `json:"path"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Size  int64     `json:"size"`
+}
+
+type recordFile struct {
+	RecordSegment
+	mod time.Time
+}
+
+// recordIndex is the recorded segments of the channels under the root, a segment
+// is in the directory of its channel, eg: camera/2023/10/19/20231019T100000Z.mp4
+// The files changed are demuxed again for their durations, the ones being
+// written are indexed once they are complete.
+type recordIndex struct {
+	root    string
+	mu      sync.Mutex
+	files   map[string]*recordFile
+	scanned time.Time
+	// called with the segments complete since the first scan, nil if unused.
+	complete func(seg RecordSegment)
+}
+
+func newRecordIndex(root string) *recordIndex {
+	return &recordIndex{
+		root:  root,
+		files: map[string]*recordFile{},
+	}
+}
+
+// segmentStart returns the wall clock time the segment of the name starts at.
+func segmentStart(name string) (time.Time, bool) {
+	if !strings.EqualFold(path.Ext(name), ".mp4") {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(segmentLayout, name[:len(name)-4])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// scan the segments under the root, must be called with the lock held.
+func (x *recordIndex) scan() {
+	files := make(map[string]*recordFile, len(x.files))
+	_ = filepath.WalkDir(x.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(x.root, p)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		i := strings.Index(rel, "/")
+		start, ok := segmentStart(path.Base(rel))
+		if i <= 0 || !ok {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if old, ok := x.files[rel]; ok && old.mod.Equal(info.ModTime()) && old.Size == info.Size() {
+			files[rel] = old
+			return nil
+		}
+		f, err := openMP4(p)
+		if err != nil {
+			return nil
+		}
+		_ = f.Close()
+		rf := &recordFile{
+			RecordSegment: RecordSegment{
+				Channel: rel[:i],
+				Path:    rel,
+				Start:   start,
+				End:     start.Add(f.duration),
+				Size:    info.Size(),
+			},
+			mod: info.ModTime(),
+		}
+		files[rel] = rf
+		// the segments found by the first scan were complete before.
+		if _, ok := x.files[rel]; !ok && !x.scanned.IsZero() && x.complete != nil {
+			x.complete(rf.RecordSegment)
+		}
+		return nil
+	})
+	x.files = files
+	x.scanned = time.Now()
+}
+
+// refresh scan the segments if they were scanned the age ago.
+func (x *recordIndex) refresh(age time.Duration) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if time.Since(x.scanned) >= age {
+		x.scan()
+	}
+}
+
+// find returns the segments of the channel overlapping the time range by their
+// start, every channel if the channel is empty, the end is open if zero.
+func (x *recordIndex) find(channel string, from, to time.Time) []RecordSegment {
+	x.refresh(recordScanInterval)
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	rv := make([]RecordSegment, 0)
+	for _, f := range x.files {
+		if channel != "" && f.Channel != channel {
+			continue
+		}
+		if f.End.After(from) && (to.IsZero() || f.Start.Before(to)) {
+			rv = append(rv, f.RecordSegment)
+		}
+	}
+	sort.Slice(rv, func(i, j int) bool {
+		return rv[i].Start.Before(rv[j].Start)
+	})
+	return rv
+}
+
+// stitch demux the segments into a recording played from the time to the time,
+// the end is open if zero. The gaps between the segments are skipped, and the
+// segments whose tracks differ from the first one are left out, they can not be
+// decoded by the same description.
+func (x *recordIndex) stitch(segments []RecordSegment, from, to time.Time) (*mp4File, error) {
+	rv := &mp4File{}
+	var pos time.Duration
+	for _, seg := range segments {
+		if len(rv.paths) > math.MaxUint16 {
+			break
+		}
+		f, err := openMP4(filepath.Join(x.root, filepath.FromSlash(seg.Path)))
+		if err != nil {
+			log.Errorf("can not open the segment %s: %v", seg.Path, err)
+			continue
+		}
+		if len(rv.tracks) > 0 && !sameTracks(rv.tracks, f.tracks) {
+			log.Infof("the tracks of the segment %s differ, it is skipped", seg.Path)
+			_ = f.Close()
+			continue
+		}
+		cut, end := from.Sub(seg.Start), to.Sub(seg.Start)
+		if cut < 0 {
+			cut = 0
+		}
+		if to.IsZero() || end > f.duration {
+			end = f.duration
+		}
+		// the video starts from its sync sample.
+		for _, t := range f.tracks {
+			if t.codec == codecAAC {
+				continue
+			}
+			if i := t.seek(cut); i < len(t.samples) {
+				cut = t.time(t.samples[i].dts)
+			}
+			break
+		}
+		if end <= cut {
+			_ = f.Close()
+			continue
+		}
+		if len(rv.tracks) == 0 {
+			for _, t := range f.tracks {
+				c := *t
+				c.samples = nil
+				rv.tracks = append(rv.tracks, &c)
+			}
+		}
+		// the part is opened again once its samples are read.
+		part := uint16(len(rv.paths))
+		rv.paths = append(rv.paths, f.paths...)
+		rv.files = append(rv.files, nil)
+		_ = f.Close()
+		for i, t := range f.tracks {
+			dst := rv.tracks[i]
+			for _, s := range t.samples {
+				d := t.time(s.dts)
+				if d < cut || d >= end {
+					continue
+				}
+				s.dts = dst.units(pos + d - cut)
+				s.cts = int32(int64(s.cts) * int64(dst.timescale) / int64(t.timescale))
+				s.part = part
+				dst.samples = append(dst.samples, s)
+			}
+		}
+		rv.wall = append(rv.wall, mp4Wall{pos: pos, at: seg.Start.Add(cut)})
+		pos += end - cut
+		// the overlapped part of the next segment is skipped.
+		from = seg.Start.Add(end)
+	}
+	if len(rv.paths) == 0 {
+		return nil, &os.PathError{Op: "stitch", Path: x.root, Err: os.ErrNotExist}
+	}
+	rv.duration = pos
+	for _, t := range rv.tracks {
+		t.duration = t.units(pos)
+	}
+	return rv, nil
+}
+
+// sameTracks returns true if the samples of the tracks are decoded by the same parameters.
+func sameTracks(a []*mp4Track, b []*mp4Track) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	equal := func(x [][]byte, y [][]byte) bool {
+		if len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !bytes.Equal(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	for i := range a {
+		if a[i].codec != b[i].codec || a[i].nalLength != b[i].nalLength || !bytes.Equal(a[i].config, b[i].config) ||
+			!equal(a[i].vps, b[i].vps) || !equal(a[i].sps, b[i].sps) || !equal(a[i].pps, b[i].pps) {
+			return false
+		}
+	}
+	return true
+}
+
+// position returns the position of the wall clock time in the stitched recording.
+func (m *mp4File) position(at time.Time) time.Duration {
+	var rv time.Duration
+	for i, w := range m.wall {
+		if at.Before(w.at) {
+			break
+		}
+		rv = w.pos + at.Sub(w.at)
+		if i+1 < len(m.wall) && rv > m.wall[i+1].pos {
+			rv = m.wall[i+1].pos
+		}
+	}
+	if rv > m.duration {
+		rv = m.duration
+	}
+	return rv
+}
+
+// clock returns the wall clock time of the position in the stitched recording.
+func (m *mp4File) clock(pos time.Duration) time.Time {
+	var rv time.Time
+	for _, w := range m.wall {
+		if pos < w.pos {
+			break
+		}
+		rv = w.at.Add(pos - w.pos)
+	}
+	return rv
+}
+
+// playbackPath returns the recording of the path and the stream,
+// eg: /playback/camera/20231019T100300Z-20231019T101700Z/streamid=0
+func playbackPath(p string) (string, string, bool) {
+	if !strings.HasPrefix(p, playbackPrefix) {
+		return "", "", false
+	}
+	parts := strings.SplitN(p[len(playbackPrefix):], "/", 3)
+	if len(parts) < 2 || parts[0] == "" {
+		return "", "", false
+	}
+	if _, ok := playbackRange(parts[1]); !ok {
+		return "", "", false
+	}
+	stream := ""
+	if len(parts) == 3 {
+		stream = strings.Trim(parts[2], "/")
+	}
+	return playbackPrefix + parts[0] + "/" + parts[1], stream, true
+}
+
+// playbackRange parse the clock range of the recording, the end is open if omitted.
+func playbackRange(s string) (header.TimeRange, bool) {
+	rng, err := header.ParseRange(header.RangeClock + "=" + s)
+	if err != nil || !rng.HasStart {
+		return header.TimeRange{}, false
+	}
+	return rng, true
+}
+
+// playback stitch the segments of the recording by its name,
+// the range is cut to the longest one from its start.
+func (l *vodLibrary) playback(name string) (*mp4File, error) {
+	parts := strings.SplitN(name[len(playbackPrefix):], "/", 2)
+	rng, _ := playbackRange(parts[1])
+	to := rng.StartTime.Add(maxRecordingRange)
+	if rng.HasEnd && rng.EndTime.Before(to) {
+		to = rng.EndTime
+	}
+	return l.index.stitch(l.index.find(parts[0], rng.StartTime, to), rng.StartTime, to)
+}
+
+// Recordings returns the recorded segments of the channel overlapping the time range,
+// every channel if the channel is empty, the end is open if zero.
+func (s *Server) Recordings(channel string, from, to time.Time) []RecordSegment {
+	if s.vod == nil {
+		return nil
+	}
+	return s.vod.index.find(channel, from, to)
+}
+
+// recording stitch the recording of the channel in the time range of the unix seconds
+// of the query, eg: ?channel=camera&start=1697709780&end=1697710620 It writes the
+// error and returns false if the query is invalid or no segment is recorded.
+func (s *Server) recording(w http.ResponseWriter, r *http.Request) (string, *mp4File, bool) {
+	if s.vod == nil {
+		http.NotFound(w, r)
+		return "", nil, false
+	}
+	q := r.URL.Query()
+	channel := q.Get("channel")
+	start, err1 := strconv.ParseInt(q.Get("start"), 10, 64)
+	end, err2 := strconv.ParseInt(q.Get("end"), 10, 64)
+	if channel == "" || err1 != nil || err2 != nil || end <= start {
+		http.Error(w, "channel, start and end are required", http.StatusBadRequest)
+		return "", nil, false
+	}
+	if end-start > int64(maxRecordingRange/time.Second) {
+		http.Error(w, fmt.Sprintf("the range is longer than %v", maxRecordingRange), http.StatusBadRequest)
+		return "", nil, false
+	}
+	from, to := time.Unix(start, 0), time.Unix(end, 0)
+	f, err := s.vod.index.stitch(s.vod.index.find(channel, from, to), from, to)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.NotFound(w, r)
+			return "", nil, false
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return "", nil, false
+	}
+	return channel, f, true
+}
+
+// RecordingHandler returns the handler downloading the recording of the channel
+// in the time range of the unix seconds as a single mp4 file,
+// eg: GET ?channel=camera&start=1697709780&end=1697710620
+func (s *Server) RecordingHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		channel, f, ok := s.recording(w, r)
+		if !ok {
+			return
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		head, order, size := f.mp4Layout()
+		w.Header().Set("Content-Type", "video/mp4")
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s-%s.mp4\"",
+			channel, f.wall[0].at.UTC().Format("20060102T150405Z")))
+		if err := f.writeMP4(w, head, order); err != nil {
+			s.log.Errorf("can not write the recording of %s: %v", channel, err)
+		}
+	})
+}
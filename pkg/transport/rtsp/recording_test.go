@@ -0,0 +1,256 @@
+package rtsp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// the segments of the test recording, each lasts 2 seconds of the 25 fps video.
+const (
+	testSegmentFrames = 50
+	testFrameSize     = 64
+)
+
+var testRecordingStart = time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+
+// testFrame returns the sample of the frame of the segment, the keyframe every second.
+func testFrame(segment int, frame int) []byte {
+	rv := make([]byte, testFrameSize)
+	binary.BigEndian.PutUint32(rv, testFrameSize-4)
+	rv[4], rv[5], rv[6] = 0x41, byte(segment), byte(frame)
+	if frame%25 == 0 {
+		rv[4] = 0x65
+	}
+	return rv
+}
+
+// testVideoTrack returns the h264 track of the segment, the samples
+// of the frames follow one another from the start of the file.
+func testVideoTrack() *mp4Track {
+	sps, pps := []byte{0x67, 0x42, 0xc0, 0x1e}, []byte{0x68, 0xce, 0x38}
+	avcC := mp4Make("avcC", []byte{1, 0x42, 0xc0, 0x1e, 0xff, 0xe1, 0, byte(len(sps))}, sps, []byte{1, 0, byte(len(pps))}, pps)
+	track := &mp4Track{
+		id:        1,
+		codec:     codecH264,
+		timescale: 90000,
+		duration:  testSegmentFrames * 3600,
+		sps:       [][]byte{sps},
+		pps:       [][]byte{pps},
+		nalLength: 4,
+		entry:     mp4Box{kind: "avc1", data: append(make([]byte, 78), avcC...)},
+	}
+	for i := 0; i < testSegmentFrames; i++ {
+		track.samples = append(track.samples, mp4Sample{
+			offset: int64(i * testFrameSize),
+			size:   testFrameSize,
+			dts:    uint64(i * 3600),
+			sync:   i%25 == 0,
+		})
+	}
+	return track
+}
+
+// writeTestSegments record the segments of the channel cam under the root.
+func writeTestSegments(t *testing.T, root string, segments int) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Join(root, "cam"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for n := 0; n < segments; n++ {
+		// the samples are read from the raw file when the segment is written.
+		var raw []byte
+		track := testVideoTrack()
+		for i := 0; i < testSegmentFrames; i++ {
+			raw = append(raw, testFrame(n, i)...)
+		}
+		rawPath := filepath.Join(t.TempDir(), "raw")
+		if err := os.WriteFile(rawPath, raw, 0644); err != nil {
+			t.Fatal(err)
+		}
+		f := &mp4File{paths: []string{rawPath}, files: []*os.File{nil}, tracks: []*mp4Track{track}, duration: 2 * time.Second}
+		name := testRecordingStart.Add(time.Duration(n)*2*time.Second).Format("20060102T150405Z") + ".mp4"
+		var b bytes.Buffer
+		head, order, _ := f.mp4Layout()
+		if err := f.writeMP4(&b, head, order); err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+		if err := os.WriteFile(filepath.Join(root, "cam", name), b.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestStitchOpensPartsLazily(t *testing.T) {
+	root := t.TempDir()
+	writeTestSegments(t, root, 2*maxOpenParts)
+	x := newRecordIndex(root)
+	from := testRecordingStart.Add(time.Second)
+	f, err := x.stitch(x.find("cam", from, time.Time{}), from, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if len(f.paths) != 2*maxOpenParts || len(f.open) != 0 {
+		t.Fatalf("%d parts, %d open after stitched", len(f.paths), len(f.open))
+	}
+	// the first segment starts from its keyframe of the second 1.
+	var buf []byte
+	for i, s := range f.tracks[0].samples {
+		if buf, err = f.readSample(s, buf); err != nil {
+			t.Fatal(err)
+		}
+		segment, frame := (i+25)/testSegmentFrames, (i+25)%testSegmentFrames
+		if !bytes.Equal(buf, testFrame(segment, frame)) {
+			t.Fatalf("sample %d of the segment %d frame %d: %x", i, buf[5], buf[6], buf[:8])
+		}
+		if len(f.open) > maxOpenParts {
+			t.Fatalf("%d parts open", len(f.open))
+		}
+	}
+	if err = f.Close(); err != nil || len(f.open) != 0 {
+		t.Fatalf("close: %v, %d open", err, len(f.open))
+	}
+}
+
+func TestRecordingHandler(t *testing.T) {
+	root := t.TempDir()
+	writeTestSegments(t, root, 3)
+	s := NewServer(VOD(root))
+	srv := httptest.NewServer(s.RecordingHandler())
+	defer srv.Close()
+	start := testRecordingStart.Unix()
+	for _, tc := range []struct {
+		query string
+		code  int
+	}{
+		{query: fmt.Sprintf("channel=cam&start=%d&end=%d", start, start+5), code: http.StatusOK},
+		{query: fmt.Sprintf("channel=cam&start=%d&end=%d", start, start+int64(maxRecordingRange/time.Second)+1), code: http.StatusBadRequest},
+		{query: fmt.Sprintf("channel=cam&start=%d&end=%d", start+5, start), code: http.StatusBadRequest},
+		// the seconds of the range overflow the duration.
+		{query: "channel=cam&start=0&end=9223372037", code: http.StatusBadRequest},
+		{query: fmt.Sprintf("channel=other&start=%d&end=%d", start, start+5), code: http.StatusNotFound},
+	} {
+		res, err := http.Get(srv.URL + "?" + tc.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		_ = res.Body.Close()
+		if res.StatusCode != tc.code {
+			t.Fatalf("GET ?%s: %d", tc.query, res.StatusCode)
+		}
+		if tc.code != http.StatusOK {
+			continue
+		}
+		p := filepath.Join(t.TempDir(), "recording.mp4")
+		if err = os.WriteFile(p, body, 0644); err != nil {
+			t.Fatal(err)
+		}
+		f, err := openMP4(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := len(f.tracks[0].samples); f.duration != 5*time.Second || n != 125 {
+			t.Errorf("downloaded %v of %d samples", f.duration, n)
+		}
+		_ = f.Close()
+	}
+}
+
+func TestRecordingHLSHandler(t *testing.T) {
+	root := t.TempDir()
+	writeTestSegments(t, root, 5)
+	s := NewServer(VOD(root))
+	srv := httptest.NewServer(http.StripPrefix("/hls", s.RecordingHLSHandler()))
+	defer srv.Close()
+	query := fmt.Sprintf("channel=cam&start=%d&end=%d", testRecordingStart.Unix(), testRecordingStart.Unix()+10)
+	get := func(name string, code int) []byte {
+		t.Helper()
+		res, err := http.Get(srv.URL + "/hls/" + name + "?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		if res.StatusCode != code {
+			t.Fatalf("GET %s: %d", name, res.StatusCode)
+		}
+		return body
+	}
+	// the 10 seconds are cut at the keyframes after 6 seconds.
+	playlist := string(get("index.m3u8", http.StatusOK))
+	for _, line := range []string{
+		"#EXT-X-TARGETDURATION:6\n",
+		"#EXT-X-MAP:URI=\"init.mp4?" + query + "\"\n",
+		"#EXT-X-PROGRAM-DATE-TIME:2026-10-19T10:00:06.000Z\n",
+		"#EXTINF:6.000,\n0.m4s?" + query + "\n",
+		"#EXTINF:4.000,\n1.m4s?" + query + "\n",
+		"#EXT-X-ENDLIST\n",
+	} {
+		if !strings.Contains(playlist, line) {
+			t.Fatalf("no %q in the playlist:\n%s", line, playlist)
+		}
+	}
+	if init := get("init.mp4", http.StatusOK); !bytes.Contains(init, []byte("mvex")) || !bytes.Contains(init, []byte("trex")) {
+		t.Fatal("the init section is not fragmented")
+	}
+	for n, frames := range []int{150, 100} {
+		fragment := get(fmt.Sprintf("%d.m4s", n), http.StatusOK)
+		boxes := mp4Boxes(fragment)
+		if len(boxes) != 2 || boxes[0].kind != "moof" || boxes[1].kind != "mdat" || len(boxes[1].data) != frames*testFrameSize {
+			t.Fatalf("fragment %d of %d boxes", n, len(boxes))
+		}
+		trun, _ := mp4Child(boxes[0].data, "traf", "trun")
+		count, offset := binary.BigEndian.Uint32(trun[4:]), binary.BigEndian.Uint32(trun[8:])
+		if int(count) != frames || int(offset) != len(boxes[0].data)+16 {
+			t.Fatalf("fragment %d of %d samples from %d", n, count, offset)
+		}
+		if first := boxes[1].data[:testFrameSize]; !bytes.Equal(first, testFrame(3*n, 0)) {
+			t.Fatalf("fragment %d starts from %x", n, first[:8])
+		}
+	}
+	get("2.m4s", http.StatusNotFound)
+	get("index.m3u", http.StatusNotFound)
+}
+
+func TestPlaybackRangeCut(t *testing.T) {
+	root := t.TempDir()
+	writeTestSegments(t, root, 3)
+	l := newVODLibrary(root)
+	before := testRecordingStart.Add(-maxRecordingRange)
+	for _, tc := range []struct {
+		name     string
+		duration time.Duration
+	}{
+		// the open range ends before the recording.
+		{name: before.Format("20060102T150405Z") + "-"},
+		{name: before.Add(time.Second).Format("20060102T150405Z") + "-", duration: time.Second},
+		{name: before.Add(time.Second).Format("20060102T150405Z") + "-" + testRecordingStart.Add(3*time.Second).Format("20060102T150405Z"), duration: time.Second},
+		{name: "20261019T100001Z-", duration: 5 * time.Second},
+	} {
+		f, err := l.playback(playbackPrefix + "cam/" + tc.name)
+		if tc.duration == 0 {
+			if !os.IsNotExist(err) {
+				t.Errorf("playback %s: %v", tc.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("playback %s: %v", tc.name, err)
+		}
+		if f.duration != tc.duration {
+			t.Errorf("playback %s of %v, want %v", tc.name, f.duration, tc.duration)
+		}
+		_ = f.Close()
+	}
+}
@@ -1,11 +1,14 @@
 package rtsp
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/ChinasMr/kaka/pkg/transport/rtsp/header"
 	"github.com/ChinasMr/kaka/pkg/transport/rtsp/methods"
 	"gortc.io/sdp"
+	"net/textproto"
 	"net/url"
+	"sort"
 	"strings"
 )
 
@@ -27,6 +30,13 @@ type Request interface {
 	Encode() []byte
 	ParseSDP() (*sdp.Message, error)
 	Channel() string
+	// Range returns the Range header, it is false if absent or invalid.
+	Range() (header.TimeRange, bool)
+	// Scale returns the Scale header, it is false if absent or invalid.
+	Scale() (float64, bool)
+	// Speed returns the bounds of the Speed header, they are the same
+	// for rtsp 1.0. It is false if absent or invalid.
+	Speed() (float64, float64, bool)
 }
 
 type request struct {
@@ -54,7 +64,12 @@ func (r request) ParseSDP() (*sdp.Message, error) {
 	if len(r.body) == 0 {
 		return nil, fmt.Errorf("paerse sdp error empty request body")
 	}
-	s, err := sdp.DecodeSession(r.body, nil)
+	return decodeSDP(r.body)
+}
+
+// decode the raw session description.
+func decodeSDP(raw []byte) (*sdp.Message, error) {
+	s, err := sdp.DecodeSession(raw, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -67,9 +82,46 @@ func (r request) ParseSDP() (*sdp.Message, error) {
 	return rv, nil
 }
 
+func newRequest(method methods.Method, u *url.URL) *request {
+	return &request{
+		method:  method,
+		url:     u,
+		headers: map[string][]string{},
+		proto:   Version1,
+	}
+}
+
+func (r request) setHeader(key string, value ...string) {
+	r.headers[key] = value
+}
+
 func (r request) Encode() []byte {
-	//TODO implement me
-	panic("implement me")
+	// never leak the credentials in the request line.
+	u := *r.url
+	u.User = nil
+	buf := bytes.Buffer{}
+	buf.WriteString(fmt.Sprintf("%s %s %s\r\n", r.method, u.String(), r.proto))
+	buf.WriteString(fmt.Sprintf("%s: %s\r\n", header.CSeq, r.cSeq))
+
+	var keys []string
+	for key := range r.headers {
+		if strings.EqualFold(key, header.CSeq) || strings.EqualFold(key, header.ContentLength) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range r.headers[key] {
+			buf.WriteString(fmt.Sprintf("%s: %s\r\n", key, value))
+		}
+	}
+	if len(r.body) > 0 {
+		buf.WriteString(fmt.Sprintf("%s: %d\r\n", header.ContentLength, len(r.body)))
+	}
+	buf.WriteString("\r\n")
+	buf.Write(r.body)
+	return buf.Bytes()
 }
 
 func (r request) ContentType() string {
@@ -104,20 +156,32 @@ func (r request) CSeq() string {
 	return r.cSeq
 }
 
+// Transport returns the first valid transport the client offers,
+// or the first one if none is valid.
 func (r request) Transport() (header.TransportHeader, bool) {
 	trans, ok := r.headers["Transport"]
 	if ok == false || len(trans) == 0 {
 		return nil, ok
 	}
-	transports := make(map[string]struct{})
-	for _, part := range strings.Split(trans[0], ";") {
-		transports[part] = struct{}{}
+	specs := header.ParseTransports(strings.Join(trans, ","))
+	if len(specs) == 0 {
+		return header.ParseTransportHeader(trans[0]), true
+	}
+	for _, spec := range specs {
+		if spec.Validate() {
+			return spec, true
+		}
 	}
-	return transports, true
+	return specs[0], true
 }
 
 func (r request) Header(key string) ([]string, bool) {
 	rv, ok := r.headers[key]
+	if ok {
+		return rv, ok
+	}
+	// the parsed request use the canonical mime header keys, eg: KeyMgmt.
+	rv, ok = r.headers[textproto.CanonicalMIMEHeaderKey(key)]
 	return rv, ok
 }
 
@@ -141,3 +205,82 @@ func (r request) Channel() string {
 	}
 	return str
 }
+
+// mapSections rewrite the media sections of the description by their orders,
+// the first line of a section is the media line.
+func mapSections(raw []byte, fn func(order int, section [][]byte) [][]byte) []byte {
+	out := bytes.Buffer{}
+	var section [][]byte
+	order := -1
+	flush := func() {
+		if order >= 0 {
+			section = fn(order, section)
+		}
+		for _, line := range section {
+			out.Write(line)
+			out.WriteString("\r\n")
+		}
+		section = nil
+	}
+	for _, line := range bytes.Split(raw, []byte("\n")) {
+		line = bytes.TrimRight(line, "\r")
+		if len(line) == 0 {
+			continue
+		}
+		if bytes.HasPrefix(line, []byte("m=")) {
+			flush()
+			order++
+		}
+		section = append(section, line)
+	}
+	flush()
+	return out.Bytes()
+}
+
+func (r request) Range() (header.TimeRange, bool) {
+	v, ok := r.Header(header.Range)
+	if !ok || len(v) == 0 {
+		return header.TimeRange{}, false
+	}
+	rv, err := header.ParseRange(v[0])
+	return rv, err == nil
+}
+
+func (r request) Scale() (float64, bool) {
+	v, ok := r.Header(header.Scale)
+	if !ok || len(v) == 0 {
+		return 0, false
+	}
+	rv, err := header.ParseScale(v[0])
+	return rv, err == nil
+}
+
+func (r request) Speed() (float64, float64, bool) {
+	v, ok := r.Header(header.Speed)
+	if !ok || len(v) == 0 {
+		return 0, 0, false
+	}
+	min, max, err := header.ParseSpeed(v[0])
+	return min, max, err == nil
+}
+
+// validPlayback returns the error response if the Range, Scale
+// or Speed header of the request is invalid.
+func (r request) validPlayback(res Response) (Response, bool) {
+	if v, ok := r.Header(header.Range); ok && len(v) > 0 {
+		if _, err := header.ParseRange(v[0]); err != nil {
+			return ErrInvalidRange(res), false
+		}
+	}
+	if v, ok := r.Header(header.Scale); ok && len(v) > 0 {
+		if _, err := header.ParseScale(v[0]); err != nil {
+			return ErrBadRequest(res), false
+		}
+	}
+	if v, ok := r.Header(header.Speed); ok && len(v) > 0 {
+		if _, _, err := header.ParseSpeed(v[0]); err != nil {
+			return ErrBadRequest(res), false
+		}
+	}
+	return res, true
+}
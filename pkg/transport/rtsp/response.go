@@ -3,6 +3,7 @@ package rtsp
 import (
 	"bytes"
 	"fmt"
+	"net/textproto"
 	"sort"
 	"strconv"
 	"strings"
@@ -13,6 +14,10 @@ type Response interface {
 	SetBody(body []byte)
 	SetStatus(status string)
 	SetCode(code uint64)
+	Code() uint64
+	Status() string
+	Header(key string) ([]string, bool)
+	Body() []byte
 	Encoding() []byte
 }
 
@@ -61,6 +66,28 @@ func (r *response) SetCode(code uint64) {
 	r.code = code
 }
 
+func (r *response) Code() uint64 {
+	return r.code
+}
+
+func (r *response) Status() string {
+	return r.status
+}
+
+func (r *response) Header(key string) ([]string, bool) {
+	rv, ok := r.headers[key]
+	if ok {
+		return rv, ok
+	}
+	// the parsed response use the canonical mime header keys.
+	rv, ok = r.headers[textproto.CanonicalMIMEHeaderKey(key)]
+	return rv, ok
+}
+
+func (r *response) Body() []byte {
+	return r.body
+}
+
 func (r *response) SetBody(body []byte) {
 	r.body = body
 }
@@ -0,0 +1,315 @@
+package rtsp
+
+import (
+	"context"
+	"fmt"
+	"github.com/ChinasMr/kaka/pkg/log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the interval the recordings are checked against the retention.
+const retentionInterval = time.Minute
+
+// the cleanup events kept for the status.
+const maxCleanupEvents = 100
+
+// the reasons a segment is deleted for.
+const (
+	ReasonMaxAge    = "max_age"
+	ReasonMaxSize   = "max_size"
+	ReasonDiskFloor = "disk_floor"
+)
+
+type retentionPolicy struct {
+	maxAge  time.Duration
+	maxSize int64
+}
+
+// CleanupEvent is a recorded segment deleted by the retention.
+type CleanupEvent struct {
+	Time    time.Time
+	Channel string
+	Path    string
+	Size    int64
+	Reason  string
+}
+
+// ChannelStorage is the disk usage of the recordings of a channel.
+type ChannelStorage struct {
+	Channel  string
+	Segments int
+	Bytes    int64
+	// the segments and the bytes deleted since the server started.
+	Deleted      uint64
+	DeletedBytes uint64
+}
+
+// StorageStatus is the disk usage of the recordings and the recent cleanups.
+type StorageStatus struct {
+	Channels []ChannelStorage
+	// the free and the total bytes of the disk of the recordings, 0 if unknown.
+	Free   uint64
+	Total  uint64
+	Events []CleanupEvent
+}
+
+type cleanupKey struct {
+	channel string
+	reason  string
+}
+
+type cleanupCount struct {
+	segments uint64
+	bytes    uint64
+}
+
+// recordCleaner delete the oldest segments of the channels beyond their retention,
+// and the oldest ones of any channel while the free bytes of the disk are under the floor.
+type recordCleaner struct {
+	index    *recordIndex
+	policies map[string]retentionPolicy
+	floor    uint64
+	mu       sync.Mutex
+	events   []CleanupEvent
+	counts   map[cleanupKey]cleanupCount
+	cancel   context.CancelFunc
+}
+
+func newRecordCleaner(index *recordIndex, policies map[string]retentionPolicy, floor uint64) *recordCleaner {
+	return &recordCleaner{
+		index:    index,
+		policies: policies,
+		floor:    floor,
+		counts:   map[cleanupKey]cleanupCount{},
+	}
+}
+
+func (c *recordCleaner) start() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cancel != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	go c.run(ctx)
+}
+
+func (c *recordCleaner) stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cancel == nil {
+		return
+	}
+	c.cancel()
+	c.cancel = nil
+}
+
+func (c *recordCleaner) run(ctx context.Context) {
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+	for {
+		c.clean()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// policy returns the retention of the channel, or the one of every channel.
+func (c *recordCleaner) policy(ch string) (retentionPolicy, bool) {
+	if p, ok := c.policies[ch]; ok {
+		return p, true
+	}
+	p, ok := c.policies["*"]
+	return p, ok
+}
+
+// clean delete the segments beyond the retention, the oldest ones first.
+func (c *recordCleaner) clean() {
+	segments := c.index.find("", time.Time{}, time.Time{})
+	now := time.Now()
+	usage := map[string]int64{}
+	for _, seg := range segments {
+		usage[seg.Channel] += seg.Size
+	}
+	kept := make([]RecordSegment, 0, len(segments))
+	for _, seg := range segments {
+		reason := ""
+		if p, ok := c.policy(seg.Channel); ok {
+			switch {
+			case p.maxAge > 0 && now.Sub(seg.End) > p.maxAge:
+				reason = ReasonMaxAge
+			case p.maxSize > 0 && usage[seg.Channel] > p.maxSize:
+				reason = ReasonMaxSize
+			}
+		}
+		if reason != "" && c.delete(seg, reason) {
+			usage[seg.Channel] -= seg.Size
+			continue
+		}
+		kept = append(kept, seg)
+	}
+	if c.floor == 0 {
+		return
+	}
+	free, _, err := diskSpace(c.index.root)
+	if err != nil {
+		log.Errorf("can not check the disk of the recordings: %v", err)
+		return
+	}
+	for _, seg := range kept {
+		if free >= c.floor {
+			break
+		}
+		if c.delete(seg, ReasonDiskFloor) {
+			free += uint64(seg.Size)
+		}
+	}
+}
+
+// delete the segment and its empty directories up to the channel.
+func (c *recordCleaner) delete(seg RecordSegment, reason string) bool {
+	err := os.Remove(filepath.Join(c.index.root, filepath.FromSlash(seg.Path)))
+	if err != nil && !os.IsNotExist(err) {
+		log.Errorf("can not delete the segment %s: %v", seg.Path, err)
+		return false
+	}
+	c.index.remove(seg.Path)
+	for dir := path.Dir(seg.Path); dir != seg.Channel && dir != "."; dir = path.Dir(dir) {
+		if os.Remove(filepath.Join(c.index.root, filepath.FromSlash(dir))) != nil {
+			break
+		}
+	}
+	log.Infof("delete the segment %s of channel %s by %s", seg.Path, seg.Channel, reason)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.events) == maxCleanupEvents {
+		c.events = append(c.events[:0], c.events[1:]...)
+	}
+	c.events = append(c.events, CleanupEvent{
+		Time:    time.Now(),
+		Channel: seg.Channel,
+		Path:    seg.Path,
+		Size:    seg.Size,
+		Reason:  reason,
+	})
+	key := cleanupKey{channel: seg.Channel, reason: reason}
+	count := c.counts[key]
+	count.segments++
+	count.bytes += uint64(seg.Size)
+	c.counts[key] = count
+	return true
+}
+
+// remove the deleted segment from the index.
+func (x *recordIndex) remove(p string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	delete(x.files, p)
+}
+
+// StorageStatus returns the disk usage of the recordings under the vod root,
+// and the segments deleted by the retention.
+func (s *Server) StorageStatus() StorageStatus {
+	rv := StorageStatus{}
+	if s.vod == nil {
+		return rv
+	}
+	channels := map[string]*ChannelStorage{}
+	storage := func(ch string) *ChannelStorage {
+		cs, ok := channels[ch]
+		if !ok {
+			cs = &ChannelStorage{Channel: ch}
+			channels[ch] = cs
+		}
+		return cs
+	}
+	for _, seg := range s.vod.index.find("", time.Time{}, time.Time{}) {
+		cs := storage(seg.Channel)
+		cs.Segments++
+		cs.Bytes += seg.Size
+	}
+	if s.cleaner != nil {
+		s.cleaner.mu.Lock()
+		for key, count := range s.cleaner.counts {
+			cs := storage(key.channel)
+			cs.Deleted += count.segments
+			cs.DeletedBytes += count.bytes
+		}
+		rv.Events = append(rv.Events, s.cleaner.events...)
+		s.cleaner.mu.Unlock()
+	}
+	for _, cs := range channels {
+		rv.Channels = append(rv.Channels, *cs)
+	}
+	sort.Slice(rv.Channels, func(i, j int) bool {
+		return rv.Channels[i].Channel < rv.Channels[j].Channel
+	})
+	rv.Free, rv.Total, _ = diskSpace(s.vod.root)
+	return rv
+}
+
+// MetricsHandler returns the handler exposing the disk usage of the recordings
+// and the segments deleted by the retention in the prometheus text format.
+func (s *Server) MetricsHandler() http.Handler {
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		st := s.StorageStatus()
+		b := &strings.Builder{}
+		metric := func(name string, kind string, help string) {
+			fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+		}
+		metric("kaka_recording_bytes", "gauge", "The bytes of the recorded segments of the channel.")
+		for _, cs := range st.Channels {
+			fmt.Fprintf(b, "kaka_recording_bytes{channel=\"%s\"} %d\n", escape.Replace(cs.Channel), cs.Bytes)
+		}
+		metric("kaka_recording_segments", "gauge", "The recorded segments of the channel.")
+		for _, cs := range st.Channels {
+			fmt.Fprintf(b, "kaka_recording_segments{channel=\"%s\"} %d\n", escape.Replace(cs.Channel), cs.Segments)
+		}
+		if s.cleaner != nil {
+			s.cleaner.mu.Lock()
+			keys := make([]cleanupKey, 0, len(s.cleaner.counts))
+			counts := make(map[cleanupKey]cleanupCount, len(s.cleaner.counts))
+			for key, count := range s.cleaner.counts {
+				keys = append(keys, key)
+				counts[key] = count
+			}
+			s.cleaner.mu.Unlock()
+			sort.Slice(keys, func(i, j int) bool {
+				if keys[i].channel != keys[j].channel {
+					return keys[i].channel < keys[j].channel
+				}
+				return keys[i].reason < keys[j].reason
+			})
+			metric("kaka_recording_deleted_segments_total", "counter", "The recorded segments deleted by the retention.")
+			for _, key := range keys {
+				fmt.Fprintf(b, "kaka_recording_deleted_segments_total{channel=\"%s\",reason=\"%s\"} %d\n",
+					escape.Replace(key.channel), key.reason, counts[key].segments)
+			}
+			metric("kaka_recording_deleted_bytes_total", "counter", "The bytes of the recorded segments deleted by the retention.")
+			for _, key := range keys {
+				fmt.Fprintf(b, "kaka_recording_deleted_bytes_total{channel=\"%s\",reason=\"%s\"} %d\n",
+					escape.Replace(key.channel), key.reason, counts[key].bytes)
+			}
+		}
+		if st.Total > 0 {
+			metric("kaka_disk_free_bytes", "gauge", "The free bytes of the disk of the recordings.")
+			fmt.Fprintf(b, "kaka_disk_free_bytes %d\n", st.Free)
+			metric("kaka_disk_total_bytes", "gauge", "The total bytes of the disk of the recordings.")
+			fmt.Fprintf(b, "kaka_disk_total_bytes %d\n", st.Total)
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		_, _ = w.Write([]byte(b.String()))
+	})
+}
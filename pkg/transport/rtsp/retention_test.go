@@ -0,0 +1,103 @@
+package rtsp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecordCleaner(t *testing.T) {
+	// the copies of a recorded segment, named by the times they start at.
+	src := t.TempDir()
+	writeTestSegments(t, src, 1)
+	names, _ := filepath.Glob(filepath.Join(src, "cam", "*.mp4"))
+	if len(names) != 1 {
+		t.Fatalf("segments %v", names)
+	}
+	segment, err := os.ReadFile(names[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := int64(len(segment))
+	root := t.TempDir()
+	now := time.Now().UTC()
+	write := func(p string, data []byte) {
+		t.Helper()
+		p = filepath.Join(root, filepath.FromSlash(p))
+		if err1 := os.MkdirAll(filepath.Dir(p), 0755); err1 != nil {
+			t.Fatal(err1)
+		}
+		if err1 := os.WriteFile(p, data, 0644); err1 != nil {
+			t.Fatal(err1)
+		}
+	}
+	ago := func(d time.Duration) string {
+		return now.Add(-d).Format("20060102T150405Z") + ".mp4"
+	}
+	for _, p := range []string{
+		"cam/2020/01/" + ago(72*time.Hour),
+		"cam/" + ago(time.Hour),
+		"big/" + ago(3*time.Minute),
+		"big/" + ago(2*time.Minute),
+		"big/" + ago(time.Minute),
+		"other/" + ago(3*time.Minute),
+		"other/" + ago(2*time.Minute),
+		"other/" + ago(time.Minute),
+		// the files out of the channels are never removed.
+		ago(72 * time.Hour),
+	} {
+		write(p, segment)
+	}
+	// nor the files not of the segments.
+	old := ago(100 * time.Hour)
+	write("cam/"+old[:16]+".txt", segment)
+	write("cam/"+old, []byte("not a segment"))
+
+	c := newRecordCleaner(newRecordIndex(root), map[string]retentionPolicy{
+		"*":   {maxAge: 48 * time.Hour, maxSize: 2 * size},
+		"big": {maxSize: size},
+	}, 0)
+	c.clean()
+	deleted := map[string]string{
+		"cam/2020/01/" + ago(72*time.Hour): ReasonMaxAge,
+		"big/" + ago(3*time.Minute):        ReasonMaxSize,
+		"big/" + ago(2*time.Minute):        ReasonMaxSize,
+		"other/" + ago(3*time.Minute):      ReasonMaxSize,
+	}
+	if len(c.events) != len(deleted) {
+		t.Fatalf("deleted %+v", c.events)
+	}
+	// the oldest segments are deleted first.
+	for i, e := range c.events {
+		if deleted[e.Path] != e.Reason || e.Size != size || i > 0 && e.Channel == c.events[i-1].Channel && e.Path < c.events[i-1].Path {
+			t.Errorf("deleted %+v", e)
+		}
+	}
+	_ = filepath.WalkDir(root, func(p string, d os.DirEntry, err error) error {
+		rel, _ := filepath.Rel(root, p)
+		if _, ok := deleted[filepath.ToSlash(rel)]; ok {
+			t.Errorf("%s is not deleted", rel)
+		}
+		return nil
+	})
+	for _, p := range []string{"cam", "cam/" + ago(time.Hour), "big/" + ago(time.Minute), ago(72 * time.Hour),
+		"cam/" + old[:16] + ".txt", "cam/" + old} {
+		if _, err = os.Stat(filepath.Join(root, filepath.FromSlash(p))); err != nil {
+			t.Errorf("%s is removed: %v", p, err)
+		}
+	}
+	// the empty directories of the channel are removed up to it.
+	if _, err = os.Stat(filepath.Join(root, "cam", "2020")); !os.IsNotExist(err) {
+		t.Errorf("the empty directories are kept: %v", err)
+	}
+	if key := (cleanupKey{channel: "big", reason: ReasonMaxSize}); c.counts[key].segments != 2 || c.counts[key].bytes != uint64(2*size) {
+		t.Errorf("the count of big %+v", c.counts[key])
+	}
+
+	// nothing more is beyond the retention.
+	c.clean()
+	if len(c.events) != len(deleted) {
+		t.Fatalf("deleted again %+v", c.events[len(deleted):])
+	}
+}
@@ -0,0 +1,226 @@
+package rtsp
+
+import (
+	"encoding/binary"
+	"gortc.io/sdp"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the clock rate of the medias whose rtpmap is unknown.
+const defaultClockRate = 90000
+
+// RTPInfo is the sequence number and rtp timestamp
+// of the first package a reader receives.
+type RTPInfo struct {
+	Seq     uint16
+	RTPTime uint32
+}
+
+// clockRates returns the clock rate of the medias by their order.
+func clockRates(msg *sdp.Message) map[int]uint32 {
+	rv := map[int]uint32{}
+	for i, m := range msg.Medias {
+		rv[i] = defaultClockRate
+		// rtpmap example: 96 H264/90000
+		fields := strings.Fields(m.Attribute("rtpmap"))
+		if len(fields) < 2 {
+			continue
+		}
+		parts := strings.Split(fields[1], "/")
+		if len(parts) < 2 {
+			continue
+		}
+		clock, err := strconv.ParseUint(parts[1], 10, 32)
+		if err == nil && clock > 0 {
+			rv[i] = uint32(clock)
+		}
+	}
+	return rv
+}
+
+// rtpRewriter keeps the ssrc, sequence number and timestamp of a media
+// continuous to the reader across the source changes.
+type rtpRewriter struct {
+	ssrc    uint32
+	clock   uint32
+	started bool
+	gen     uint32
+	inSSRC  uint32
+	seqOff  uint16
+	tsOff   uint32
+	lastSeq uint16
+	lastTS  uint32
+	last    time.Time
+	// the sequence number and timestamp of the first package.
+	info RTPInfo
+}
+
+func newRTPRewriter(clock uint32) *rtpRewriter {
+	return &rtpRewriter{
+		ssrc:  rand.Uint32(),
+		clock: clock,
+		info: RTPInfo{
+			Seq:     uint16(rand.Uint32()),
+			RTPTime: rand.Uint32(),
+		},
+	}
+}
+
+// rtp rewrite the header of the rtp package in place.
+func (r *rtpRewriter) rtp(data []byte, gen uint32) bool {
+	if len(data) < 12 {
+		return false
+	}
+	seq := binary.BigEndian.Uint16(data[2:])
+	ts := binary.BigEndian.Uint32(data[4:])
+	ssrc := binary.BigEndian.Uint32(data[8:])
+	now := time.Now()
+	if !r.started || ssrc != r.inSSRC || gen != r.gen {
+		nextSeq, nextTS := r.info.Seq, r.info.RTPTime
+		if r.started {
+			// continue from the last package by the elapsed wall clock.
+			nextSeq = r.lastSeq + 1
+			nextTS = r.lastTS + uint32(now.Sub(r.last).Seconds()*float64(r.clock)) + 1
+		}
+		r.seqOff = nextSeq - seq
+		r.tsOff = nextTS - ts
+		r.inSSRC = ssrc
+		r.gen = gen
+		if !r.started {
+			r.lastSeq = nextSeq - 1
+		}
+		r.started = true
+	}
+	outSeq := seq + r.seqOff
+	outTS := ts + r.tsOff
+	binary.BigEndian.PutUint16(data[2:], outSeq)
+	binary.BigEndian.PutUint32(data[4:], outTS)
+	binary.BigEndian.PutUint32(data[8:], r.ssrc)
+	// the reordered packages do not move the last one back.
+	if int16(outSeq-r.lastSeq) > 0 {
+		r.lastSeq = outSeq
+		r.lastTS = outTS
+		r.last = now
+	}
+	return true
+}
+
+// rtcp rewrite the sender ssrc and the rtp timestamp of the sender reports
+// of the compound rtcp package in place, the package is dropped
+// until the first rtp package is rewritten.
+func (r *rtpRewriter) rtcp(data []byte) bool {
+	if !r.started {
+		return false
+	}
+	for len(data) >= 8 {
+		n := (int(binary.BigEndian.Uint16(data[2:])) + 1) * 4
+		if n > len(data) {
+			return false
+		}
+		switch data[1] {
+		// the sender report.
+		case 200:
+			if n >= 20 {
+				ts := binary.BigEndian.Uint32(data[16:])
+				binary.BigEndian.PutUint32(data[16:], ts+r.tsOff)
+			}
+			binary.BigEndian.PutUint32(data[4:], r.ssrc)
+		// the receiver report, source description and goodbye.
+		case 201, 202, 203:
+			binary.BigEndian.PutUint32(data[4:], r.ssrc)
+		}
+		data = data[n:]
+	}
+	return true
+}
+
+// readerRewriter rewrites the packages of all the medias of a reader.
+type readerRewriter struct {
+	mu     sync.Mutex
+	medias map[int]*rtpRewriter
+	// clock returns the clock rate of the media of the current source,
+	// the medias added by the source changes are rewritten from then on.
+	clock func(order int) (uint32, bool)
+}
+
+func newReaderRewriter(clocks map[int]uint32, clock func(order int) (uint32, bool)) *readerRewriter {
+	rv := &readerRewriter{
+		medias: map[int]*rtpRewriter{},
+		clock:  clock,
+	}
+	for order, rate := range clocks {
+		rv.medias[order] = newRTPRewriter(rate)
+	}
+	return rv
+}
+
+func (w *readerRewriter) info() map[int]RTPInfo {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	rv := make(map[int]RTPInfo, len(w.medias))
+	for order, r := range w.medias {
+		rv[order] = r.info
+	}
+	return rv
+}
+
+// media returns the rewriter of the media, it is created
+// by the clock rate of the current source if not yet.
+func (w *readerRewriter) media(order int) *rtpRewriter {
+	w.mu.Lock()
+	r, ok := w.medias[order]
+	w.mu.Unlock()
+	if ok {
+		return r
+	}
+	// the clock is looked up unlocked, RTPInfo calls info under the lock of the channel.
+	rate, ok := w.clock(order)
+	if !ok {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if r, ok = w.medias[order]; !ok {
+		r = newRTPRewriter(rate)
+		w.medias[order] = r
+	}
+	return r
+}
+
+// rewrite returns the rewritten copy of the shared package,
+// or nil if the package should be dropped.
+func (w *readerRewriter) rewrite(p *Package) *Package {
+	order, rtcp := p.media()
+	r := w.media(order)
+	if r == nil {
+		return nil
+	}
+	rv := p.clone()
+	ok := false
+	if rtcp {
+		ok = r.rtcp(rv.Data[:rv.Len])
+	} else {
+		ok = r.rtp(rv.Data[:rv.Len], p.gen)
+	}
+	if !ok {
+		putPackage(rv)
+		return nil
+	}
+	return rv
+}
+
+// forward the rewritten package to the reader.
+func (w *readerRewriter) forward(tx Transaction, p *Package) error {
+	rp := w.rewrite(p)
+	if rp == nil {
+		return nil
+	}
+	// the package may be kept for retransmission.
+	rp.refs = 1
+	defer rp.release()
+	return tx.Forward(rp)
+}
@@ -0,0 +1,73 @@
+package rtsp
+
+import (
+	"encoding/binary"
+	"sync"
+	"testing"
+)
+
+func TestRewriterSourceChange(t *testing.T) {
+	var mu sync.Mutex
+	clocks := map[int]uint32{0: 90000}
+	w := newReaderRewriter(clocks, func(order int) (uint32, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		rate, ok := clocks[order]
+		return rate, ok
+	})
+	info := w.info()
+	type header struct {
+		seq  uint16
+		ts   uint32
+		ssrc uint32
+	}
+	rewrite := func(order int, seq uint16, ssrc uint32, gen uint32) (header, bool) {
+		t.Helper()
+		p := rtpPackage(order, seq)
+		defer putPackage(p)
+		binary.BigEndian.PutUint32(p.Data[8:], ssrc)
+		p.gen = gen
+		rp := w.rewrite(p)
+		if rp == nil {
+			return header{}, false
+		}
+		defer putPackage(rp)
+		return header{
+			seq:  binary.BigEndian.Uint16(rp.Data[2:]),
+			ts:   binary.BigEndian.Uint32(rp.Data[4:]),
+			ssrc: binary.BigEndian.Uint32(rp.Data[8:]),
+		}, true
+	}
+
+	first, _ := rewrite(0, 100, 1, 1)
+	if first.seq != info[0].Seq || first.ts != info[0].RTPTime {
+		t.Fatalf("the first package %+v, RTP-Info %+v", first, info[0])
+	}
+	if _, ok := rewrite(1, 0, 2, 1); ok {
+		t.Fatal("the package of the media not described is rewritten")
+	}
+	for seq := uint16(101); seq < 105; seq++ {
+		rewrite(0, seq, 1, 1)
+	}
+	last, _ := rewrite(0, 105, 1, 1)
+
+	// the next source starts from another sequence number and ssrc,
+	// and adds the audio.
+	mu.Lock()
+	clocks[1] = 48000
+	mu.Unlock()
+	next, _ := rewrite(0, 7, 3, 2)
+	if next.seq != last.seq+1 || next.ssrc != last.ssrc || next.ts-last.ts > 90000 {
+		t.Fatalf("the package %+v after %+v", next, last)
+	}
+	audio, ok := rewrite(1, 9000, 4, 2)
+	if !ok || audio.ssrc == last.ssrc {
+		t.Fatalf("the audio added by the source change: %+v, %v", audio, ok)
+	}
+	if then, _ := rewrite(1, 9001, 4, 2); then.seq != audio.seq+1 || then.ssrc != audio.ssrc {
+		t.Fatalf("the audio package %+v after %+v", then, audio)
+	}
+	if _, ok = w.info()[1]; !ok {
+		t.Fatal("no RTP-Info of the audio")
+	}
+}
@@ -0,0 +1,175 @@
+package rtsp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"github.com/ChinasMr/kaka/pkg/transport/rtsp/header"
+	"github.com/ChinasMr/kaka/pkg/transport/rtsp/srtp"
+	"gortc.io/sdp"
+	"strings"
+	"sync"
+)
+
+// secureMedia is the srtp contexts of a session media, the inbound packages
+// are decrypted by in, and the outbound ones are encrypted by out.
+type secureMedia struct {
+	in  *srtp.Context
+	out *srtp.Context
+	mu  sync.Mutex
+	buf []byte
+}
+
+// unprotect decrypt the inbound package in place,
+// it returns false if the package is not authenticated.
+func (m *Media) unprotect(p *Package, rtcp bool) bool {
+	if m == nil || m.secure == nil || m.secure.in == nil {
+		return true
+	}
+	data := p.Data[:p.Len]
+	var err error
+	if rtcp {
+		data, err = m.secure.in.DecryptRTCP(data[:0], data)
+	} else {
+		data, err = m.secure.in.DecryptRTP(data[:0], data)
+	}
+	if err != nil {
+		return false
+	}
+	p.Len = uint32(len(data))
+	return true
+}
+
+// protect send the package encrypted if the media is secure.
+func (m *Media) protect(data []byte, rtcp bool, send func(data []byte) error) error {
+	if m.secure == nil || m.secure.out == nil {
+		return send(data)
+	}
+	s := m.secure
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	if rtcp {
+		s.buf, err = s.out.EncryptRTCP(s.buf[:0], data)
+	} else {
+		s.buf, err = s.out.EncryptRTP(s.buf[:0], data)
+	}
+	if err != nil {
+		return err
+	}
+	return send(s.buf)
+}
+
+// feedback handle the rtcp feedback of the reader in place.
+func (m *Media) feedback(data []byte, send func(data []byte) error) {
+	if m.nack == nil {
+		return
+	}
+	if m.secure != nil && m.secure.in != nil {
+		var err error
+		data, err = m.secure.in.DecryptRTCP(data[:0], data)
+		if err != nil {
+			return
+		}
+	}
+	m.nack.feedback(data, func(b []byte) error {
+		return m.protect(b, false, send)
+	})
+}
+
+// newSecureMedia set up the srtp contexts of the media by the keys of the client,
+// from the KeyMgmt header, or the key-mgmt and crypto attributes of the announced
+// description. The reader without its own keys gets the ones generated for its
+// session in the KeyMgmt header of the response, so no keystream is shared by the
+// readers. The keys in the clear, the sdes and the returned ones, need the control
+// connection over tls.
+func newSecureMedia(req Request, res Response, desc *sdp.Message, m sdp.Media, record bool, secure bool) (*secureMedia, error) {
+	keys, err := clientKeys(req, desc, m, record, secure)
+	if err != nil {
+		return nil, err
+	}
+	rv := &secureMedia{}
+	if record {
+		if keys == nil {
+			return nil, fmt.Errorf("no srtp keys of the publisher")
+		}
+		rv.in, err = srtp.NewContext(keys)
+		return rv, err
+	}
+	if keys == nil {
+		if !secure {
+			return nil, fmt.Errorf("the srtp keys can not be returned over an insecure connection")
+		}
+		keys, err = srtp.GenerateKeys(srtp.AES128CMHMACSHA180)
+		if err != nil {
+			return nil, err
+		}
+		msg, err := srtp.EncodeMIKEY(keys, 0)
+		if err != nil {
+			return nil, err
+		}
+		res.SetHeader(header.KeyMgmt, header.NewKeyMgmt(header.ProtMIKEY, req.URL().String(),
+			base64.StdEncoding.EncodeToString(msg)))
+	}
+	rv.out, err = srtp.NewContext(keys)
+	if err != nil {
+		return nil, err
+	}
+	// the reader sends the rtcp by the same keys.
+	rv.in, err = srtp.NewContext(keys)
+	return rv, err
+}
+
+func clientKeys(req Request, desc *sdp.Message, m sdp.Media, record bool, secure bool) (*srtp.Keys, error) {
+	if v, ok := req.Header(header.KeyMgmt); ok {
+		if data, has := header.ParseKeyMgmt(v[0], header.ProtMIKEY); has {
+			return decodeMIKEY(data)
+		}
+	}
+	if !record {
+		return nil, nil
+	}
+	// the media level key management precedes the session level one.
+	for _, v := range append(m.Attributes.Values("key-mgmt"), desc.Attributes.Values("key-mgmt")...) {
+		fields := strings.Fields(v)
+		if len(fields) == 2 && strings.ToLower(fields[0]) == header.ProtMIKEY {
+			return decodeMIKEY(fields[1])
+		}
+	}
+	for _, v := range m.Attributes.Values("crypto") {
+		if !secure {
+			return nil, fmt.Errorf("the sdes keys are refused over an insecure connection")
+		}
+		c, err := srtp.ParseCrypto(v)
+		if err == nil {
+			return &c.Keys, nil
+		}
+	}
+	return nil, nil
+}
+
+func decodeMIKEY(data string) (*srtp.Keys, error) {
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, err
+	}
+	return srtp.DecodeMIKEY(raw)
+}
+
+// stripKeys remove the crypto and key-mgmt attributes of the publisher,
+// it returns false if the description has none.
+func stripKeys(raw []byte) ([]byte, bool) {
+	if !bytes.Contains(raw, []byte("a=crypto:")) && !bytes.Contains(raw, []byte("a=key-mgmt:")) {
+		return raw, false
+	}
+	out := bytes.Buffer{}
+	for _, line := range bytes.Split(raw, []byte("\n")) {
+		line = bytes.TrimRight(line, "\r")
+		if len(line) == 0 || bytes.HasPrefix(line, []byte("a=crypto:")) || bytes.HasPrefix(line, []byte("a=key-mgmt:")) {
+			continue
+		}
+		out.Write(line)
+		out.WriteString("\r\n")
+	}
+	return out.Bytes(), true
+}
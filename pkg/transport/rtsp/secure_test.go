@@ -0,0 +1,174 @@
+package rtsp
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"github.com/ChinasMr/kaka/pkg/transport/rtsp/header"
+	"github.com/ChinasMr/kaka/pkg/transport/rtsp/srtp"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testTLSConfig returns the config of a self signed certificate of the loopback.
+func testTLSConfig(t *testing.T) *tls.Config {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "kaka"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+}
+
+// testConn dial the server, over tls if secure.
+func testConn(t *testing.T, addr string, secure bool) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	var c net.Conn
+	var err error
+	if secure {
+		c, err = tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	} else {
+		c, err = net.Dial("tcp", addr)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = c.Close()
+	})
+	return c, bufio.NewReader(c)
+}
+
+// announceTest announce the description to the channel live.
+func announceTest(t *testing.T, addr string, secure bool, desc string) {
+	t.Helper()
+	c, br := testConn(t, addr, secure)
+	res := rawRequest(t, c, br, "ANNOUNCE rtsp://%s/live RTSP/1.0\r\nCSeq: 1\r\nContent-Type: application/sdp\r\nContent-Length: %d\r\n\r\n%s",
+		addr, len(desc), desc)
+	if res.Code() != 200 {
+		t.Fatalf("ANNOUNCE %d", res.Code())
+	}
+}
+
+// setupSecure set up the first media of the channel live by RTP/SAVP.
+func setupSecure(t *testing.T, c net.Conn, br *bufio.Reader, addr string, mode string, keyMgmt string) *response {
+	t.Helper()
+	extra := ""
+	if keyMgmt != "" {
+		extra = "KeyMgmt: " + keyMgmt + "\r\n"
+	}
+	return rawRequest(t, c, br, "SETUP rtsp://%s/live/streamid=0 RTSP/1.0\r\nCSeq: 2\r\n%sTransport: RTP/SAVP/TCP;unicast;interleaved=0-1%s\r\n\r\n",
+		addr, extra, mode)
+}
+
+// returnedKeys decode the keys of the KeyMgmt header of the response.
+func returnedKeys(t *testing.T, res *response) *srtp.Keys {
+	t.Helper()
+	v, ok := res.Header(header.KeyMgmt)
+	if !ok {
+		t.Fatal("no KeyMgmt in the response")
+	}
+	data, ok := header.ParseKeyMgmt(v[0], header.ProtMIKEY)
+	if !ok {
+		t.Fatalf("KeyMgmt %q", v[0])
+	}
+	keys, err := decodeMIKEY(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestSecureReaderKeys(t *testing.T) {
+	t.Run("insecure", func(t *testing.T) {
+		_, addr := newTestServer(t, SRTP(true))
+		announceTest(t, addr, false, testSDP)
+		c, br := testConn(t, addr, false)
+		res := rawRequest(t, c, br, "DESCRIBE rtsp://%s/live RTSP/1.0\r\nCSeq: 1\r\n\r\n", addr)
+		if strings.Contains(string(res.Body()), "a=crypto") || strings.Contains(string(res.Body()), "a=key-mgmt") {
+			t.Fatalf("the keys are described:\n%s", res.Body())
+		}
+		// no keys can be returned in the clear.
+		if res = setupSecure(t, c, br, addr, "", ""); res.Code() != 461 {
+			t.Fatalf("SETUP without keys %d", res.Code())
+		}
+		// the reader brings the keys of its own.
+		keys, _ := srtp.GenerateKeys(srtp.AES128CMHMACSHA180)
+		msg, _ := srtp.EncodeMIKEY(keys, 0)
+		keyMgmt := header.NewKeyMgmt(header.ProtMIKEY, "rtsp://"+addr+"/live/streamid=0", base64.StdEncoding.EncodeToString(msg))
+		res = setupSecure(t, c, br, addr, "", keyMgmt)
+		if res.Code() != 200 {
+			t.Fatalf("SETUP with keys %d", res.Code())
+		}
+		if _, ok := res.Header(header.KeyMgmt); ok {
+			t.Fatal("the keys are returned in the clear")
+		}
+	})
+	t.Run("tls", func(t *testing.T) {
+		_, addr := newTestServer(t, SRTP(true), TLS(testTLSConfig(t)))
+		announceTest(t, addr, true, testSDP)
+		var keys []*srtp.Keys
+		for i := 0; i < 2; i++ {
+			c, br := testConn(t, addr, true)
+			res := setupSecure(t, c, br, addr, "", "")
+			if res.Code() != 200 {
+				t.Fatalf("SETUP %d", res.Code())
+			}
+			keys = append(keys, returnedKeys(t, res))
+		}
+		if bytes.Equal(keys[0].Key, keys[1].Key) {
+			t.Fatal("the readers share the keys")
+		}
+	})
+}
+
+func TestSecurePublisherSDES(t *testing.T) {
+	keys, _ := srtp.GenerateKeys(srtp.AES128CMHMACSHA180)
+	crypto := &srtp.Crypto{Tag: 1, Keys: *keys}
+	desc := strings.Replace(testSDP, "a=control:streamid=0\r\n", "a=control:streamid=0\r\na=crypto:"+crypto.String()+"\r\n", 1)
+	for _, tc := range []struct {
+		name   string
+		secure bool
+		code   uint64
+	}{
+		{name: "insecure", code: 461},
+		{name: "tls", secure: true, code: 200},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := []ServerOption{}
+			if tc.secure {
+				opts = append(opts, TLS(testTLSConfig(t)))
+			}
+			_, addr := newTestServer(t, opts...)
+			c, br := testConn(t, addr, tc.secure)
+			res := rawRequest(t, c, br, "ANNOUNCE rtsp://%s/live RTSP/1.0\r\nCSeq: 1\r\nContent-Type: application/sdp\r\nContent-Length: %d\r\n\r\n%s",
+				addr, len(desc), desc)
+			if res.Code() != 200 {
+				t.Fatalf("ANNOUNCE %d", res.Code())
+			}
+			if res = setupSecure(t, c, br, addr, ";mode=record", ""); res.Code() != tc.code {
+				t.Fatalf("SETUP %d, want %d", res.Code(), tc.code)
+			}
+		})
+	}
+}
@@ -1,7 +1,10 @@
 package rtsp
 
 import (
+	"bufio"
 	"context"
+	"crypto/tls"
+	"fmt"
 	"github.com/ChinasMr/kaka/pkg/log"
 	"github.com/ChinasMr/kaka/pkg/transport/rtsp/header"
 	"github.com/ChinasMr/kaka/pkg/transport/rtsp/methods"
@@ -28,8 +31,51 @@ type Server struct {
 	handlerFunctions []string
 	mutex            sync.Mutex
 	chs              []string
+	pulls            []pullChannel
+	pullers          []*puller
+	pushes           map[string][]string
+	pushers          []*pusher
 	tc               TransactionController
 	rf               *rtcpFamily
+	tm               sync.Mutex
+	tunnels          map[string]*tunnel
+	multicast        *multicastConfig
+	mp               *multicastPool
+	ports            *portRange
+	pp               *portPool
+	qc               queueConfig
+	rewrite          bool
+	failovers        []failoverChannel
+	switches         []*failover
+	nack             int
+	rtx              bool
+	latency          time.Duration
+	srtp             bool
+	tlsConfig        *tls.Config
+	vod              *vodLibrary
+	dvr              dvrConfig
+	retention        map[string]retentionPolicy
+	floor            uint64
+	cleaner          *recordCleaner
+	webhooks         []webhookConfig
+	hooks            *webhooks
+}
+
+type portRange struct {
+	min int
+	max int
+}
+
+type multicastConfig struct {
+	cidr string
+	port int
+	ttl  int
+}
+
+type pullChannel struct {
+	name     string
+	source   string
+	onDemand bool
 }
 
 func NewServer(opts ...ServerOption) *Server {
@@ -41,17 +87,127 @@ func NewServer(opts ...ServerOption) *Server {
 		mutex:    sync.Mutex{},
 		handlers: map[methods.Method]HandlerFunc{},
 		log:      log.NewHelper(log.DefaultLogger),
+		tunnels:  map[string]*tunnel{},
+		qc:       defaultQueueConfig,
 	}
 	for _, o := range opts {
 		o(srv)
 	}
-	srv.tc = newTransactionController(srv.chs...)
-	srv.RegisterHandler(&UnimplementedServerHandler{
-		tc: srv.tc,
-		hs: srv.handlerFunctions,
-	})
+	if srv.multicast != nil {
+		srv.mp, srv.err = newMulticastPool(srv.multicast.cidr, srv.multicast.port, srv.multicast.ttl)
+	}
+	if err := srv.qc.validate(); err != nil && srv.err == nil {
+		srv.err = err
+	}
+	if srv.ports != nil && srv.err == nil {
+		srv.pp, srv.err = newPortPool(srv.udpIP(), srv.ports.min, srv.ports.max)
+	}
+	if len(srv.retention) > 0 || srv.floor > 0 {
+		if srv.vod == nil && srv.err == nil {
+			srv.err = fmt.Errorf("the retention of the recordings needs the vod root")
+		} else if srv.vod != nil {
+			srv.cleaner = newRecordCleaner(srv.vod.index, srv.retention, srv.floor)
+		}
+	}
+	if len(srv.webhooks) > 0 {
+		srv.hooks = newWebhooks(srv.webhooks)
+		if srv.vod != nil {
+			srv.hooks.index = srv.vod.index
+			srv.vod.index.complete = func(seg RecordSegment) {
+				srv.hooks.emit(Event{
+					Type:    EventSegment,
+					Channel: seg.Channel,
+					Segment: &seg,
+				})
+			}
+		}
+	}
+	srv.tc = newTransactionController(srv.channelConfig(), srv.chs...)
+	for _, pc := range srv.pulls {
+		ch := newChannel(pc.name, srv.channelConfig())
+		ch.pull = newPuller(ch, pc.source, pc.onDemand, srv.log)
+		srv.tc.AddCh(pc.name, ch)
+		srv.pullers = append(srv.pullers, ch.pull)
+	}
+	for _, fc := range srv.failovers {
+		srv.addFailover(fc)
+	}
+	for name, targets := range srv.pushes {
+		ch, ok := srv.tc.GetCh(name)
+		if !ok {
+			ch = srv.tc.GetOrCreateCh(name)
+		}
+		c := ch.(*channel)
+		for _, target := range targets {
+			p := newPusher(c, target, srv.qc, srv.log)
+			c.pushes = append(c.pushes, p)
+			srv.pushers = append(srv.pushers, p)
+		}
+	}
+	handler := &UnimplementedServerHandler{
+		tc:   srv.tc,
+		hs:   srv.handlerFunctions,
+		mp:   srv.mp,
+		pp:   srv.pp,
+		nack: srv.nack,
+		srtp: srv.srtp,
+		vod:  srv.vod,
+	}
+	srv.RegisterHandler(handler)
+	if srv.vod != nil {
+		srv.RegisterHandleFunc(methods.PAUSE, handler.PAUSE)
+	}
 	return srv
 }
+
+// addFailover add the backups of the channel, the backup pulled from the url
+// feeds a channel of its own, the others are published to the named channels.
+func (s *Server) addFailover(fc failoverChannel) {
+	primary := s.tc.GetOrCreateCh(fc.name).(*channel)
+	backups := make([]*channel, 0, len(fc.backups))
+	for i, backup := range fc.backups {
+		if !isPullURL(backup) {
+			backups = append(backups, s.tc.GetOrCreateCh(backup).(*channel))
+			continue
+		}
+		// the primary buffers the packages relayed by the backup.
+		cc := s.channelConfig()
+		cc.dvr = dvrConfig{}
+		name := fmt.Sprintf("%s#backup%d", fc.name, i+1)
+		ch := newChannel(name, cc)
+		// the backup is always pulling to be ready.
+		ch.pull = newPuller(ch, backup, false, s.log)
+		s.tc.AddCh(name, ch)
+		s.pullers = append(s.pullers, ch.pull)
+		backups = append(backups, ch)
+	}
+	interval := fc.interval
+	if interval <= 0 {
+		interval = defaultFailoverInterval
+	}
+	s.switches = append(s.switches, newFailover(primary, interval, backups, s.log))
+}
+
+func (s *Server) channelConfig() channelConfig {
+	return channelConfig{
+		queue:   s.qc,
+		rewrite: s.rewrite,
+		nack:    s.nack > 0,
+		rtx:     s.rtx && s.nack > 0,
+		latency: s.latency,
+		dvr:     s.dvr,
+		hooks:   s.hooks,
+	}
+}
+
+// the ip the server ports bind to, same as the shared rtp socket.
+func (s *Server) udpIP() net.IP {
+	host, _, err := net.SplitHostPort(s.rtp)
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
 func (s *Server) Start(ctx context.Context) error {
 	err := s.listen()
 	if err != nil {
@@ -59,8 +215,26 @@ func (s *Server) Start(ctx context.Context) error {
 	}
 	s.baseCtx = ctx
 	log.Infof("[RTSP] server listening on: %s", s.lis.Addr().String())
-	log.Infof("[RTP ] server listening on: %s", s.rtpConn.LocalAddr())
-	log.Infof("[RTCP] server listening on: %s", s.rtcpConn.LocalAddr())
+	if s.pp != nil {
+		log.Infof("[RTP ] server ports allocated from: %d-%d", s.pp.min, s.pp.max)
+	} else {
+		log.Infof("[RTP ] server listening on: %s", s.rtpConn.LocalAddr())
+		log.Infof("[RTCP] server listening on: %s", s.rtcpConn.LocalAddr())
+	}
+	for _, p := range s.pullers {
+		if !p.onDemand {
+			p.start()
+		}
+	}
+	for _, f := range s.switches {
+		f.start()
+	}
+	if s.cleaner != nil {
+		s.cleaner.start()
+	}
+	if s.hooks != nil {
+		s.hooks.start()
+	}
 	return s.serve()
 }
 func (s *Server) Stop(_ context.Context) error {
@@ -68,23 +242,52 @@ func (s *Server) Stop(_ context.Context) error {
 		_ = s.lis.Close()
 	}
 	if s.rtpConn != nil {
-		_ = s.rtcpConn.Close()
+		_ = s.rtpConn.Close()
 	}
 	if s.rtcpConn != nil {
 		_ = s.rtcpConn.Close()
 	}
+	for _, p := range s.pullers {
+		p.stop()
+	}
+	for _, p := range s.pushers {
+		p.stop()
+	}
+	for _, f := range s.switches {
+		f.stop()
+	}
+	if s.cleaner != nil {
+		s.cleaner.stop()
+	}
+	if s.hooks != nil {
+		s.hooks.stop()
+	}
+	if s.mp != nil {
+		_ = s.mp.close()
+	}
 	log.Info("[RTSP] server stopping")
 	return nil
 }
 func (s *Server) listen() error {
+	if s.err != nil {
+		return s.err
+	}
 	// listen rtsp tcp
 	lis, err := net.Listen(s.network, s.address)
 	if err != nil {
 		s.err = err
 		return err
 	}
+	if s.tlsConfig != nil {
+		lis = tls.NewListener(lis, s.tlsConfig)
+	}
 	s.lis = lis
 
+	// every session media has its own server ports.
+	if s.pp != nil {
+		return nil
+	}
+
 	// listen rtp udp.
 	rtpAddr, err := net.ResolveUDPAddr("udp", s.rtp)
 	if err != nil {
@@ -113,53 +316,69 @@ func (s *Server) listen() error {
 	s.rf = &rtcpFamily{
 		rtpConn:  s.rtpConn,
 		rtcpConn: s.rtcpConn,
-		rtpPort:  rtpAddr.Port,
-		rtcpPort: rtcpAddr.Port,
+		rtpPort:  s.rtpConn.LocalAddr().(*net.UDPAddr).Port,
+		rtcpPort: s.rtcpConn.LocalAddr().(*net.UDPAddr).Port,
 	}
 	return s.err
 }
 func (s *Server) serve() error {
+	if s.rtpConn != nil {
+		s.serveShared()
+	}
+	for {
+		rawConn, err := s.lis.Accept()
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			s.log.Debugf("new tcp connection created from: %v", rawConn.RemoteAddr().String())
+			s.handleConn(rawConn)
+			s.log.Debugf("tcp connection closed to: %v", rawConn.RemoteAddr().String())
+		}()
+	}
+
+}
+
+// serveShared read the shared rtp/rtcp sockets, the packages are
+// delivered to the channels by their source addresses in order.
+func (s *Server) serveShared() {
 	go func() {
+		buf := make([]byte, maxPackageSize)
 		for true {
-			p := newPackage()
-			n, addr, err := s.rtpConn.ReadFromUDP(p.Data)
+			p, addr, err := readUDPPackage(s.rtpConn, buf)
 			if err != nil {
 				return
 			}
-			p.Len = uint32(n)
 			p.Ch = 0
 			p.Interleaved = false
-			go s.tc.Forward(p, addr)
+			s.tc.Forward(p, addr)
 		}
 	}()
 
 	go func() {
+		buf := make([]byte, maxPackageSize)
 		for true {
-			p := newPackage()
-			n, addr, err := s.rtcpConn.ReadFromUDP(p.Data)
+			p, addr, err := readUDPPackage(s.rtcpConn, buf)
 			if err != nil {
 				return
 			}
-			p.Len = uint32(n)
 			p.Ch = 1
 			p.Interleaved = false
-			go s.tc.Forward(p, addr)
+			s.tc.Forward(p, addr)
 		}
 	}()
+}
 
-	for {
-		rawConn, err := s.lis.Accept()
-		if err != nil {
-			return err
-		}
-
-		go func() {
-			s.log.Debugf("new tcp connection created from: %v", rawConn.RemoteAddr().String())
-			s.handleRawConn(rawConn)
-			s.log.Debugf("tcp connection closed to: %v", rawConn.RemoteAddr().String())
-		}()
+// handle the rtsp connection or the rtsp over http tunnel.
+func (s *Server) handleConn(conn net.Conn) {
+	br := bufio.NewReader(conn)
+	pc := &peekConn{Conn: conn, br: br}
+	if isTunnelRequest(br) {
+		s.handleTunnel(pc, br)
+		return
 	}
-
+	s.handleRawConn(pc)
 }
 
 func (s *Server) handleRawConn(conn net.Conn) {
@@ -168,38 +387,72 @@ func (s *Server) handleRawConn(conn net.Conn) {
 		s.log.Errorf("can not create transport: %v", err)
 		return
 	}
+	s.handleTransport(trans)
+}
+
+// handle the requests and interleaved frames on the transport.
+func (s *Server) handleTransport(trans Transport) {
 	tx := s.tc.CreateTx(trans, s.rf)
 	s.log.Debugf("create new session for %s: %s", trans.Addr(), tx.id)
 	defer func() {
 		if tx != nil {
 			s.log.Debugf("destroy session %s for %s", trans.Addr(), tx.id)
+			// stop the playback on demand before the transaction is released.
+			if s.vod != nil {
+				_ = tx.Close()
+				s.vod.remove(tx.id)
+			}
 			s.tc.DeleteTx(tx)
 		}
 	}()
 	for {
 		req, err := trans.Parse()
+		if err == errResponseMessage {
+			continue
+		}
 		if err != nil {
 			return
 		}
 		s.log.Debugf("%s request from %s", req.method, trans.Addr())
 		// create a corresponding response.
 		res := NewResponse(req.proto, req.cSeq)
+		if proto, ok := negotiateVersion(req.proto); !ok {
+			res.proto = proto
+			_ = tx.Response(ErrVersionNotSupported(res))
+			continue
+		}
+		tx.received(req)
+		if v, ok := req.Header(header.PipelinedRequests); ok {
+			res.SetHeader(header.PipelinedRequests, v...)
+		}
 		// check presentation description or media path.
 		if len(req.Path()) <= 1 {
 			return
 		}
 		// handle the request.
 		err = s.handleRequest(req, res, tx)
-		if err != nil {
-			if err == io.EOF {
-				continue
-			}
+		if err != nil && err != io.EOF {
 			s.log.Errorf("can not handle request: %v", err)
-			continue
+		}
+		// the interleaved recording goes on after the request in between, eg: GET_PARAMETER.
+		if req.method != methods.RECORD && tx.Status() == status.RECORDING && tx.Interleaved() {
+			if err = s.receive(tx); err != errInterleavedRequest {
+				return
+			}
 		}
 	}
 }
 
+// receive go on reading the interleaved packages of the source to its channel.
+func (s *Server) receive(tx *transaction) error {
+	for _, ch := range s.tc.ListCh() {
+		if c, ok := ch.(*channel); ok && c.Source() == Transaction(tx) {
+			return c.receive(tx)
+		}
+	}
+	return io.EOF
+}
+
 func (s *Server) handleRequest(req *request, res *response, tx *transaction) error {
 	// try to get the handle function.
 	handlerFunc, ok := s.handlers[req.method]
@@ -214,29 +467,46 @@ func (s *Server) handleRequest(req *request, res *response, tx *transaction) err
 			return tx.Response(ErrUnsupportedTransport(res))
 		}
 		// check and set session id.
-		sid := req.SessionID()
+		sid := tx.sessionOf(req)
 		if len(sid) != 0 && sid != tx.id {
 			return tx.Response(ErrInternal(res))
 		}
+		// the following pipelined requests refer to the session by the id.
+		if v, ok := req.Header(header.PipelinedRequests); ok && len(sid) == 0 {
+			tx.pipeline(v[0])
+		}
 		res.SetHeader(header.Session, tx.id)
 		// call the handle.
 		return handlerFunc(req, res, tx)
 	case methods.RECORD:
 		// state check
-		if tx.state != status.READY && tx.state != status.RECORDING {
+		if state := tx.Status(); state != status.READY && state != status.RECORDING {
 			return tx.Response(ErrMethodNotValidINThisState(res))
 		}
-		sid := req.SessionID()
+		sid := tx.sessionOf(req)
 		if sid != tx.id {
 			return tx.Response(ErrInternal(res))
 		}
 		res.SetHeader(header.Session, tx.id)
 		return handlerFunc(req, res, tx)
 	case methods.PLAY:
-		if tx.state != status.READY && tx.state != status.PLAYING {
+		if state := tx.Status(); state != status.READY && state != status.PLAYING {
 			return tx.Response(ErrMethodNotValidINThisState(res))
 		}
-		sid := req.SessionID()
+		if invalid, ok := req.validPlayback(res); !ok {
+			return tx.Response(invalid)
+		}
+		sid := tx.sessionOf(req)
+		if sid != tx.id {
+			return tx.Response(ErrInternal(res))
+		}
+		res.SetHeader(header.Session, tx.id)
+		return handlerFunc(req, res, tx)
+	case methods.PAUSE:
+		if state := tx.Status(); state != status.READY && state != status.PLAYING {
+			return tx.Response(ErrMethodNotValidINThisState(res))
+		}
+		sid := tx.sessionOf(req)
 		if sid != tx.id {
 			return tx.Response(ErrInternal(res))
 		}
@@ -244,7 +514,7 @@ func (s *Server) handleRequest(req *request, res *response, tx *transaction) err
 		return handlerFunc(req, res, tx)
 	case methods.TEARDOWN, methods.DOWN:
 		// avoid teardown finished other transaction unexpectedly.
-		sid := req.SessionID()
+		sid := tx.sessionOf(req)
 		if sid != tx.id {
 			return tx.Response(ErrInternal(res))
 		}
@@ -255,6 +525,24 @@ func (s *Server) handleRequest(req *request, res *response, tx *transaction) err
 	}
 }
 
+// PushStatus returns the status of the push relays.
+func (s *Server) PushStatus() []PushStatus {
+	rv := make([]PushStatus, 0, len(s.pushers))
+	for _, p := range s.pushers {
+		rv = append(rv, p.Status())
+	}
+	return rv
+}
+
+// ReaderStatus returns the status of the reader queues of all the channels.
+func (s *Server) ReaderStatus() []ReaderStatus {
+	rv := make([]ReaderStatus, 0)
+	for _, ch := range s.tc.ListCh() {
+		rv = append(rv, ch.Readers()...)
+	}
+	return rv
+}
+
 func (s *Server) RegisterHandleFunc(method methods.Method, fn HandlerFunc) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
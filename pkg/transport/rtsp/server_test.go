@@ -0,0 +1,127 @@
+package rtsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+// testSDP is a source of a h264 video and an aac audio.
+const testSDP = "v=0\r\no=- 0 0 IN IP4 127.0.0.1\r\ns=test\r\nt=0 0\r\n" +
+	"m=video 0 RTP/AVP 96\r\na=rtpmap:96 H264/90000\r\na=control:streamid=0\r\n" +
+	"m=audio 0 RTP/AVP 97\r\na=rtpmap:97 MPEG4-GENERIC/48000/2\r\na=control:streamid=1\r\n"
+
+// newTestServer start a server on the loopback with the channel live.
+func newTestServer(t *testing.T, opts ...ServerOption) (*Server, string) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	_ = lis.Close()
+	opts = append([]ServerOption{Address(addr), RTP("127.0.0.1:0"), RTCP("127.0.0.1:0"), WithChannel("live")}, opts...)
+	s := NewServer(opts...)
+	go func() {
+		_ = s.Start(context.Background())
+	}()
+	t.Cleanup(func() {
+		_ = s.Stop(context.Background())
+	})
+	for i := 0; i < 100; i++ {
+		if c, err := net.Dial("tcp", addr); err == nil {
+			_ = c.Close()
+			return s, addr
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("the server is not listening")
+	return nil, ""
+}
+
+// rawRequest write the request and read its response.
+func rawRequest(t *testing.T, c net.Conn, br *bufio.Reader, format string, args ...any) *response {
+	t.Helper()
+	if _, err := fmt.Fprintf(c, format, args...); err != nil {
+		t.Fatal(err)
+	}
+	_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	res, err := parseResponse(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+// rtpPackage returns a rtp package of the media with the sequence number.
+func rtpPackage(order int, seq uint16) *Package {
+	p := newPackage(16)
+	p.Data[0] = 0x80
+	p.Data[1] = byte(96 + order)
+	binary.BigEndian.PutUint16(p.Data[2:], seq)
+	binary.BigEndian.PutUint32(p.Data[4:], uint32(seq)*3000)
+	binary.BigEndian.PutUint32(p.Data[8:], uint32(1000+order))
+	p.Len = 16
+	p.Ch = 2 * order
+	p.Interleaved = true
+	return p
+}
+
+func TestInterleavedRequestDuringRecord(t *testing.T) {
+	s, addr := newTestServer(t)
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	br := bufio.NewReader(c)
+	url := "rtsp://" + addr + "/live"
+	res := rawRequest(t, c, br, "ANNOUNCE %s RTSP/1.0\r\nCSeq: 1\r\nContent-Type: application/sdp\r\nContent-Length: %d\r\n\r\n%s",
+		url, len(testSDP), testSDP)
+	if res.Code() != 200 {
+		t.Fatalf("ANNOUNCE %d", res.Code())
+	}
+	res = rawRequest(t, c, br, "SETUP %s/streamid=0 RTSP/1.0\r\nCSeq: 2\r\nTransport: RTP/AVP/TCP;unicast;interleaved=0-1;mode=record\r\n\r\n", url)
+	session, _ := res.Header("Session")
+	if res.Code() != 200 || len(session) == 0 {
+		t.Fatalf("SETUP %d %v", res.Code(), session)
+	}
+	res = rawRequest(t, c, br, "SETUP %s/streamid=1 RTSP/1.0\r\nCSeq: 3\r\nSession: %s\r\nTransport: RTP/AVP/TCP;unicast;interleaved=2-3;mode=record\r\n\r\n",
+		url, session[0])
+	if res.Code() != 200 {
+		t.Fatalf("SETUP %d", res.Code())
+	}
+	res = rawRequest(t, c, br, "RECORD %s RTSP/1.0\r\nCSeq: 4\r\nSession: %s\r\n\r\n", url, session[0])
+	if res.Code() != 200 {
+		t.Fatalf("RECORD %d", res.Code())
+	}
+	frame := func(seq uint16) {
+		p := rtpPackage(0, seq)
+		defer putPackage(p)
+		if _, err := c.Write(appendInterleavedFrame(nil, p.Ch, p.Data[:p.Len])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	frame(0)
+	// the keepalive in between the frames is answered, and the recording goes on.
+	res = rawRequest(t, c, br, "OPTIONS %s RTSP/1.0\r\nCSeq: 5\r\nSession: %s\r\n\r\n", url, session[0])
+	if res.Code() != 200 {
+		t.Fatalf("OPTIONS %d", res.Code())
+	}
+	frame(1)
+	ch, _ := s.tc.GetCh("live")
+	if ch.Source() == nil {
+		t.Fatal("the source stops recording after the request in between")
+	}
+	res = rawRequest(t, c, br, "TEARDOWN %s RTSP/1.0\r\nCSeq: 6\r\nSession: %s\r\n\r\n", url, session[0])
+	if res.Code() != 200 {
+		t.Fatalf("TEARDOWN %d", res.Code())
+	}
+	if ch.Source() != nil {
+		t.Fatal("the source is not torn down")
+	}
+}
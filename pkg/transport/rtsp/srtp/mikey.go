@@ -0,0 +1,198 @@
+package srtp
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// the payloads of the mikey message, rfc 3830.
+const (
+	mikeyLast    = 0
+	mikeyKEMAC   = 1
+	mikeyT       = 5
+	mikeySP      = 10
+	mikeyRAND    = 11
+	mikeyKeyData = 20
+)
+
+const (
+	// the initiator's pre-shared key message.
+	mikeyPSKInit = 0
+	mikeySRTPID  = 0
+	// the key data types.
+	mikeyTEK     = 2
+	mikeyTEKSalt = 3
+	// the security policy parameters of srtp.
+	mikeyAuthTagLen = 11
+)
+
+// DecodeMIKEY returns the srtp keys of the mikey message,
+// only the keys transported without encryption are supported.
+func DecodeMIKEY(data []byte) (*Keys, error) {
+	if len(data) < 10 || data[0] != 1 {
+		return nil, fmt.Errorf("invalid mikey message")
+	}
+	next := data[2]
+	// the common header with the cs id map of srtp.
+	n := 10
+	if data[9] == mikeySRTPID {
+		n += int(data[8]) * 9
+	}
+	if len(data) < n {
+		return nil, fmt.Errorf("invalid mikey header")
+	}
+	keys := &Keys{Suite: AES128CMHMACSHA180}
+	var ok bool
+	data = data[n:]
+	for next != mikeyLast {
+		if len(data) < 1 {
+			return nil, fmt.Errorf("invalid mikey payload: %d", next)
+		}
+		current := next
+		next = data[0]
+		switch current {
+		case mikeyT:
+			n = 2 + 8
+			if len(data) > 1 && data[1] == 2 {
+				n = 2 + 4
+			}
+		case mikeyRAND:
+			if len(data) < 2 {
+				return nil, fmt.Errorf("invalid mikey rand")
+			}
+			n = 2 + int(data[1])
+		case mikeySP:
+			if len(data) < 5 {
+				return nil, fmt.Errorf("invalid mikey security policy")
+			}
+			n = 5 + int(binary.BigEndian.Uint16(data[3:]))
+			if len(data) < n {
+				return nil, fmt.Errorf("invalid mikey security policy")
+			}
+			for params := data[5:n]; len(params) >= 2 && len(params) >= 2+int(params[1]); params = params[2+int(params[1]):] {
+				if params[0] == mikeyAuthTagLen && params[1] == 1 && params[2] == 4 {
+					keys.Suite = AES128CMHMACSHA132
+				}
+			}
+		case mikeyKEMAC:
+			if len(data) < 4 {
+				return nil, fmt.Errorf("invalid mikey kemac")
+			}
+			if data[1] != 0 {
+				return nil, fmt.Errorf("unsupported mikey encryption: %d", data[1])
+			}
+			size := int(binary.BigEndian.Uint16(data[2:]))
+			n = 4 + size + 1
+			if len(data) < n {
+				return nil, fmt.Errorf("invalid mikey kemac")
+			}
+			if data[n-1] != 0 {
+				return nil, fmt.Errorf("unsupported mikey mac: %d", data[n-1])
+			}
+			err := decodeKeyData(data[4:4+size], keys)
+			if err != nil {
+				return nil, err
+			}
+			ok = true
+		default:
+			return nil, fmt.Errorf("unsupported mikey payload: %d", current)
+		}
+		if len(data) < n {
+			return nil, fmt.Errorf("invalid mikey payload: %d", current)
+		}
+		data = data[n:]
+	}
+	if !ok {
+		return nil, fmt.Errorf("mikey message without keys")
+	}
+	return keys, nil
+}
+
+// decode the key data sub-payloads of the kemac, the tek is either
+// followed by the salt, or the concatenation of the key and the salt.
+func decodeKeyData(data []byte, keys *Keys) error {
+	for len(data) >= 4 {
+		kind := data[1] >> 4
+		size := int(binary.BigEndian.Uint16(data[2:]))
+		if len(data) < 4+size {
+			return fmt.Errorf("invalid mikey key data")
+		}
+		key := data[4 : 4+size]
+		n := 4 + size
+		var salt []byte
+		if kind == mikeyTEKSalt {
+			if len(data) < n+2 {
+				return fmt.Errorf("invalid mikey key data")
+			}
+			size = int(binary.BigEndian.Uint16(data[n:]))
+			if len(data) < n+2+size {
+				return fmt.Errorf("invalid mikey key data")
+			}
+			salt = data[n+2 : n+2+size]
+			n += 2 + size
+		}
+		if kind == mikeyTEK || kind == mikeyTEKSalt {
+			if salt == nil && len(key) == KeyLen+SaltLen {
+				key, salt = key[:KeyLen], key[KeyLen:]
+			}
+			if len(key) != KeyLen || len(salt) != SaltLen {
+				return fmt.Errorf("invalid mikey key length: %d/%d", len(key), len(salt))
+			}
+			keys.Key = append([]byte(nil), key...)
+			keys.Salt = append([]byte(nil), salt...)
+			return nil
+		}
+		if data[0] == mikeyLast {
+			break
+		}
+		data = data[n:]
+	}
+	return fmt.Errorf("mikey message without tek")
+}
+
+// EncodeMIKEY returns the pre-shared key message transporting
+// the keys without encryption for the ssrc.
+func EncodeMIKEY(keys *Keys, ssrc uint32) ([]byte, error) {
+	n, err := tagLen(keys.Suite)
+	if err != nil {
+		return nil, err
+	}
+	var csb [4]byte
+	var rnd [16]byte
+	if _, err = rand.Read(csb[:]); err != nil {
+		return nil, err
+	}
+	if _, err = rand.Read(rnd[:]); err != nil {
+		return nil, err
+	}
+	// the common header with one crypto session of policy 0.
+	rv := []byte{1, mikeyPSKInit, mikeyT, 0}
+	rv = append(rv, csb[:]...)
+	rv = append(rv, 1, mikeySRTPID, 0)
+	rv = binary.BigEndian.AppendUint32(rv, ssrc)
+	rv = binary.BigEndian.AppendUint32(rv, 0)
+	// the ntp utc timestamp.
+	rv = append(rv, mikeyRAND, 0)
+	now := time.Now()
+	secs := uint64(now.Unix()+2208988800) << 32
+	frac := uint64(now.Nanosecond()) << 32 / 1e9
+	rv = binary.BigEndian.AppendUint64(rv, secs|frac)
+	rv = append(rv, mikeySP, byte(len(rnd)))
+	rv = append(rv, rnd[:]...)
+	// aes-cm, 16 bytes key, hmac-sha1, 20 bytes auth key, 14 bytes salt, the tag length.
+	params := []byte{0, 1, 1, 1, 1, KeyLen, 2, 1, 1, 3, 1, authLen, 4, 1, SaltLen, mikeyAuthTagLen, 1, byte(n)}
+	rv = append(rv, mikeyKEMAC, 0, 0)
+	rv = binary.BigEndian.AppendUint16(rv, uint16(len(params)))
+	rv = append(rv, params...)
+	// the kemac without encryption and mac.
+	rv = append(rv, mikeyLast, 0)
+	rv = binary.BigEndian.AppendUint16(rv, uint16(4+KeyLen+SaltLen))
+	rv = append(rv, mikeyLast, mikeyTEK<<4)
+	rv = binary.BigEndian.AppendUint16(rv, KeyLen+SaltLen)
+	rv = append(rv, keys.Key...)
+	rv = append(rv, keys.Salt...)
+	rv = append(rv, 0)
+	return rv, nil
+}
@@ -0,0 +1,60 @@
+package srtp
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Crypto is the sdp crypto attribute of the security descriptions, rfc 4568.
+type Crypto struct {
+	Tag int
+	Keys
+}
+
+// ParseCrypto parse the value of the crypto attribute,
+// eg: 1 AES_CM_128_HMAC_SHA1_80 inline:base64(key||salt)|2^31
+func ParseCrypto(v string) (*Crypto, error) {
+	fields := strings.Fields(v)
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("invalid crypto attribute: %s", v)
+	}
+	tag, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid crypto tag: %s", fields[0])
+	}
+	suite := Suite(fields[1])
+	if _, err = tagLen(suite); err != nil {
+		return nil, err
+	}
+	// the first key params, the lifetime and mki are ignored.
+	params := strings.SplitN(fields[2], ";", 2)[0]
+	if !strings.HasPrefix(params, "inline:") {
+		return nil, fmt.Errorf("invalid crypto key params: %s", params)
+	}
+	encoded := strings.SplitN(strings.TrimPrefix(params, "inline:"), "|", 2)[0]
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != KeyLen+SaltLen {
+		return nil, fmt.Errorf("invalid crypto key length: %d", len(raw))
+	}
+	return &Crypto{
+		Tag: tag,
+		Keys: Keys{
+			Suite: suite,
+			Key:   raw[:KeyLen],
+			Salt:  raw[KeyLen:],
+		},
+	}, nil
+}
+
+// String returns the value of the crypto attribute.
+func (c *Crypto) String() string {
+	raw := make([]byte, 0, KeyLen+SaltLen)
+	raw = append(raw, c.Key...)
+	raw = append(raw, c.Salt...)
+	return fmt.Sprintf("%d %s inline:%s", c.Tag, c.Suite, base64.StdEncoding.EncodeToString(raw))
+}
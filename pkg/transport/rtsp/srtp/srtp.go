@@ -0,0 +1,359 @@
+// Package srtp implements the secure rtp and rtcp of rfc 3711
+// with the AES_CM_128_HMAC_SHA1_80 and AES_CM_128_HMAC_SHA1_32 suites.
+package srtp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"sync"
+)
+
+type Suite string
+
+const (
+	AES128CMHMACSHA180 Suite = "AES_CM_128_HMAC_SHA1_80"
+	AES128CMHMACSHA132 Suite = "AES_CM_128_HMAC_SHA1_32"
+)
+
+const (
+	KeyLen  = 16
+	SaltLen = 14
+	authLen = 20
+	// the srtcp authentication tag is 80 bits for both suites.
+	rtcpTagLen = 10
+	// the packages received are checked against the replay window
+	// of the latest indices, rfc 3711 section 3.3.2.
+	replayWindowSize = 64
+)
+
+// the labels of the session keys derived from the master key.
+const (
+	labelRTPEncryption  = 0
+	labelRTPAuth        = 1
+	labelRTPSalt        = 2
+	labelRTCPEncryption = 3
+	labelRTCPAuth       = 4
+	labelRTCPSalt       = 5
+)
+
+// Keys is the master key and salt of a suite.
+type Keys struct {
+	Suite Suite
+	Key   []byte
+	Salt  []byte
+}
+
+// GenerateKeys returns the random master key and salt of the suite.
+func GenerateKeys(suite Suite) (*Keys, error) {
+	buf := make([]byte, KeyLen+SaltLen)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return &Keys{
+		Suite: suite,
+		Key:   buf[:KeyLen],
+		Salt:  buf[KeyLen:],
+	}, nil
+}
+
+func tagLen(suite Suite) (int, error) {
+	switch suite {
+	case AES128CMHMACSHA180:
+		return 10, nil
+	case AES128CMHMACSHA132:
+		return 4, nil
+	}
+	return 0, fmt.Errorf("unsupported srtp suite: %s", suite)
+}
+
+type ssrcState struct {
+	roc    uint32
+	seq    uint16
+	replay replayWindow
+}
+
+// replayWindow is the bitmask of the indices received up to the latest one,
+// the bit n is set if the index top-n was received.
+type replayWindow struct {
+	started bool
+	top     uint64
+	mask    uint64
+}
+
+// check reports whether the index is neither received nor older than the window.
+func (w *replayWindow) check(index uint64) bool {
+	if !w.started || index > w.top {
+		return true
+	}
+	d := w.top - index
+	return d < replayWindowSize && w.mask&(1<<d) == 0
+}
+
+// accept mark the index of the authenticated package received.
+func (w *replayWindow) accept(index uint64) {
+	switch {
+	case !w.started:
+		w.started, w.top, w.mask = true, index, 1
+	case index > w.top:
+		if d := index - w.top; d < replayWindowSize {
+			w.mask = w.mask<<d | 1
+		} else {
+			w.mask = 1
+		}
+		w.top = index
+	default:
+		w.mask |= 1 << (w.top - index)
+	}
+}
+
+// Context encrypts or decrypts the packages of a direction,
+// the rollover counters are kept by the ssrc.
+type Context struct {
+	mu        sync.Mutex
+	tagLen    int
+	rtpBlock  cipher.Block
+	rtpSalt   []byte
+	rtpMAC    hash.Hash
+	rtcpBlock cipher.Block
+	rtcpSalt  []byte
+	rtcpMAC   hash.Hash
+	ssrcs     map[uint32]*ssrcState
+	rtcpIndex uint32
+	// the replay windows of the srtcp indices by the sender ssrc.
+	rtcpReplay map[uint32]*replayWindow
+	iv         [aes.BlockSize]byte
+	tag        []byte
+}
+
+func NewContext(keys *Keys) (*Context, error) {
+	n, err := tagLen(keys.Suite)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys.Key) != KeyLen || len(keys.Salt) != SaltLen {
+		return nil, fmt.Errorf("invalid srtp master key length: %d/%d", len(keys.Key), len(keys.Salt))
+	}
+	master, err := aes.NewCipher(keys.Key)
+	if err != nil {
+		return nil, err
+	}
+	c := &Context{
+		tagLen:     n,
+		rtpSalt:    derive(master, keys.Salt, labelRTPSalt, SaltLen),
+		rtpMAC:     hmac.New(sha1.New, derive(master, keys.Salt, labelRTPAuth, authLen)),
+		rtcpSalt:   derive(master, keys.Salt, labelRTCPSalt, SaltLen),
+		rtcpMAC:    hmac.New(sha1.New, derive(master, keys.Salt, labelRTCPAuth, authLen)),
+		ssrcs:      map[uint32]*ssrcState{},
+		rtcpReplay: map[uint32]*replayWindow{},
+	}
+	c.rtpBlock, err = aes.NewCipher(derive(master, keys.Salt, labelRTPEncryption, KeyLen))
+	if err != nil {
+		return nil, err
+	}
+	c.rtcpBlock, err = aes.NewCipher(derive(master, keys.Salt, labelRTCPEncryption, KeyLen))
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// derive the session key of the label by the aes-cm prf, the key derivation rate is 0.
+func derive(master cipher.Block, salt []byte, label byte, n int) []byte {
+	iv := make([]byte, aes.BlockSize)
+	copy(iv, salt)
+	iv[7] ^= label
+	rv := make([]byte, n)
+	cipher.NewCTR(master, iv).XORKeyStream(rv, rv)
+	return rv
+}
+
+// xor the data with the keystream of the ssrc and the package index.
+func (c *Context) xor(block cipher.Block, salt []byte, ssrc uint32, index uint64, data []byte) {
+	iv := c.iv[:]
+	copy(iv, salt)
+	iv[14], iv[15] = 0, 0
+	for i := 0; i < 4; i++ {
+		iv[4+i] ^= byte(ssrc >> (24 - 8*i))
+	}
+	for i := 0; i < 6; i++ {
+		iv[8+i] ^= byte(index >> (40 - 8*i))
+	}
+	cipher.NewCTR(block, iv).XORKeyStream(data, data)
+}
+
+func (c *Context) sum(mac hash.Hash, data []byte, roc []byte) []byte {
+	mac.Reset()
+	mac.Write(data)
+	if roc != nil {
+		mac.Write(roc)
+	}
+	c.tag = mac.Sum(c.tag[:0])
+	return c.tag
+}
+
+// rtpHeaderLen returns the length of the rtp header with the csrcs and the extension.
+func rtpHeaderLen(pkt []byte) (int, error) {
+	if len(pkt) < 12 {
+		return 0, fmt.Errorf("rtp package too short: %d", len(pkt))
+	}
+	n := 12 + int(pkt[0]&0x0f)*4
+	if pkt[0]&0x10 != 0 {
+		if len(pkt) < n+4 {
+			return 0, fmt.Errorf("rtp package too short: %d", len(pkt))
+		}
+		n += 4 + int(binary.BigEndian.Uint16(pkt[n+2:]))*4
+	}
+	if len(pkt) < n {
+		return 0, fmt.Errorf("rtp package too short: %d", len(pkt))
+	}
+	return n, nil
+}
+
+// EncryptRTP append the srtp package of the rtp package to dst.
+func (c *Context) EncryptRTP(dst []byte, pkt []byte) ([]byte, error) {
+	n, err := rtpHeaderLen(pkt)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ssrc := binary.BigEndian.Uint32(pkt[8:])
+	seq := binary.BigEndian.Uint16(pkt[2:])
+	s, ok := c.ssrcs[ssrc]
+	if !ok {
+		s = &ssrcState{seq: seq}
+		c.ssrcs[ssrc] = s
+	}
+	roc := s.roc
+	diff := int16(seq - s.seq)
+	if diff > 0 {
+		if seq < s.seq {
+			s.roc++
+			roc = s.roc
+		}
+		s.seq = seq
+	} else if diff < 0 && seq > s.seq && roc > 0 {
+		// the package before the rollover.
+		roc--
+	}
+	start := len(dst)
+	dst = append(dst, pkt...)
+	out := dst[start:]
+	c.xor(c.rtpBlock, c.rtpSalt, ssrc, uint64(roc)<<16|uint64(seq), out[n:])
+	var rb [4]byte
+	binary.BigEndian.PutUint32(rb[:], roc)
+	tag := c.sum(c.rtpMAC, out, rb[:])
+	return append(dst, tag[:c.tagLen]...), nil
+}
+
+// DecryptRTP append the rtp package of the authenticated srtp package to dst.
+func (c *Context) DecryptRTP(dst []byte, pkt []byte) ([]byte, error) {
+	if len(pkt) < c.tagLen {
+		return nil, fmt.Errorf("srtp package too short: %d", len(pkt))
+	}
+	body := pkt[:len(pkt)-c.tagLen]
+	n, err := rtpHeaderLen(body)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ssrc := binary.BigEndian.Uint32(pkt[8:])
+	seq := binary.BigEndian.Uint16(pkt[2:])
+	s, ok := c.ssrcs[ssrc]
+	if !ok {
+		s = &ssrcState{seq: seq}
+	}
+	// estimate the rollover counter, rfc 3711 appendix a.
+	roc := s.roc
+	if s.seq < 0x8000 {
+		if int(seq)-int(s.seq) > 0x8000 && roc > 0 {
+			roc--
+		}
+	} else if int(s.seq)-0x8000 > int(seq) {
+		roc++
+	}
+	index := uint64(roc)<<16 | uint64(seq)
+	if !s.replay.check(index) {
+		return nil, fmt.Errorf("srtp package replayed: %d", index)
+	}
+	var rb [4]byte
+	binary.BigEndian.PutUint32(rb[:], roc)
+	tag := c.sum(c.rtpMAC, body, rb[:])
+	if subtle.ConstantTimeCompare(tag[:c.tagLen], pkt[len(body):]) != 1 {
+		return nil, fmt.Errorf("srtp authentication failed")
+	}
+	if !ok {
+		c.ssrcs[ssrc] = s
+	}
+	s.replay.accept(index)
+	if roc > s.roc {
+		s.roc, s.seq = roc, seq
+	} else if roc == s.roc && seq > s.seq {
+		s.seq = seq
+	}
+	start := len(dst)
+	dst = append(dst, body...)
+	c.xor(c.rtpBlock, c.rtpSalt, ssrc, index, dst[start+n:])
+	return dst, nil
+}
+
+// EncryptRTCP append the srtcp package of the compound rtcp package to dst.
+func (c *Context) EncryptRTCP(dst []byte, pkt []byte) ([]byte, error) {
+	if len(pkt) < 8 {
+		return nil, fmt.Errorf("rtcp package too short: %d", len(pkt))
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	index := c.rtcpIndex
+	c.rtcpIndex = (c.rtcpIndex + 1) & 0x7fffffff
+	start := len(dst)
+	dst = append(dst, pkt...)
+	c.xor(c.rtcpBlock, c.rtcpSalt, binary.BigEndian.Uint32(pkt[4:]), uint64(index), dst[start+8:])
+	// the encrypted flag and the srtcp index.
+	dst = binary.BigEndian.AppendUint32(dst, 0x80000000|index)
+	tag := c.sum(c.rtcpMAC, dst[start:], nil)
+	return append(dst, tag[:rtcpTagLen]...), nil
+}
+
+// DecryptRTCP append the compound rtcp package of the authenticated srtcp package to dst.
+func (c *Context) DecryptRTCP(dst []byte, pkt []byte) ([]byte, error) {
+	if len(pkt) < 8+4+rtcpTagLen {
+		return nil, fmt.Errorf("srtcp package too short: %d", len(pkt))
+	}
+	body := pkt[:len(pkt)-rtcpTagLen]
+	ssrc := binary.BigEndian.Uint32(pkt[4:])
+	index := binary.BigEndian.Uint32(body[len(body)-4:])
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w, ok := c.rtcpReplay[ssrc]
+	if !ok {
+		w = &replayWindow{}
+	}
+	if !w.check(uint64(index & 0x7fffffff)) {
+		return nil, fmt.Errorf("srtcp package replayed: %d", index&0x7fffffff)
+	}
+	tag := c.sum(c.rtcpMAC, body, nil)
+	if subtle.ConstantTimeCompare(tag[:rtcpTagLen], pkt[len(body):]) != 1 {
+		return nil, fmt.Errorf("srtcp authentication failed")
+	}
+	if !ok {
+		c.rtcpReplay[ssrc] = w
+	}
+	w.accept(uint64(index & 0x7fffffff))
+	body = body[:len(body)-4]
+	start := len(dst)
+	dst = append(dst, body...)
+	if index&0x80000000 != 0 {
+		c.xor(c.rtcpBlock, c.rtcpSalt, ssrc, uint64(index&0x7fffffff), dst[start+8:])
+	}
+	return dst, nil
+}
@@ -0,0 +1,179 @@
+package srtp
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+)
+
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+	rv, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rv
+}
+
+// the key derivation test vectors of rfc 3711 appendix b.3.
+func TestDeriveKeys(t *testing.T) {
+	master, err := aes.NewCipher(unhex(t, "E1F97A0D3E018BE0D64FA32C06DE4139"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	salt := unhex(t, "0EC675AD498AFEEBB6960B3AABE6")
+	for _, tc := range []struct {
+		label byte
+		n     int
+		want  string
+	}{
+		{label: labelRTPEncryption, n: KeyLen, want: "C61E7A93744F39EE10734AFE3FF7A087"},
+		{label: labelRTPSalt, n: SaltLen, want: "30CBBC08863D8C85D49DB34A9AE1"},
+		{label: labelRTPAuth, n: authLen, want: "CEBE321F6FF7716B6FD4AB49AF256A156D38BAA4"},
+	} {
+		if got := derive(master, salt, tc.label, tc.n); !bytes.Equal(got, unhex(t, tc.want)) {
+			t.Errorf("the key of the label %d = %X, want %s", tc.label, got, tc.want)
+		}
+	}
+}
+
+// the aes-cm keystream test vectors of rfc 3711 appendix b.2.
+func TestKeystream(t *testing.T) {
+	block, err := aes.NewCipher(unhex(t, "2B7E151628AED2A6ABF7158809CF4F3C"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Context{}
+	// the blocks of the counters 0000 to ff01.
+	keystream := make([]byte, 0xff02*aes.BlockSize)
+	c.xor(block, unhex(t, "F0F1F2F3F4F5F6F7F8F9FAFBFCFD"), 0, 0, keystream)
+	for _, tc := range []struct {
+		counter int
+		want    string
+	}{
+		{counter: 0x0000, want: "E03EAD0935C95E80E166B16DD92B4EB4"},
+		{counter: 0x0001, want: "D23513162B02D0F72A43A2FE4A5F97AB"},
+		{counter: 0x0002, want: "41E95B3BB0A2E8DD477901E4FCA894C0"},
+		{counter: 0xfeff, want: "EC8CDF7398607CB0F2D21675EA9EA1E4"},
+		{counter: 0xff00, want: "362B7C3C6773516318A077D7FC5073AE"},
+		{counter: 0xff01, want: "6A2CC3787889374FBEB4C81B17BA6C44"},
+	} {
+		got := keystream[tc.counter*aes.BlockSize : (tc.counter+1)*aes.BlockSize]
+		if !bytes.Equal(got, unhex(t, tc.want)) {
+			t.Errorf("the keystream block %04x = %X, want %s", tc.counter, got, tc.want)
+		}
+	}
+}
+
+func testContexts(t *testing.T, suite Suite) (*Context, *Context) {
+	t.Helper()
+	keys, err := GenerateKeys(suite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender, err := NewContext(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiver, err := NewContext(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sender, receiver
+}
+
+func testRTP(seq uint16) []byte {
+	rv := make([]byte, 12, 32)
+	rv[0], rv[1] = 0x80, 96
+	binary.BigEndian.PutUint16(rv[2:], seq)
+	binary.BigEndian.PutUint32(rv[4:], uint32(seq)*3000)
+	binary.BigEndian.PutUint32(rv[8:], 0xcafe)
+	return append(rv, []byte("payload of the package")[:10+seq%10]...)
+}
+
+func TestReplayRTP(t *testing.T) {
+	for _, suite := range []Suite{AES128CMHMACSHA180, AES128CMHMACSHA132} {
+		sender, receiver := testContexts(t, suite)
+		protected := map[uint16][]byte{}
+		// the sequence numbers roll over.
+		for seq := uint16(0xffc0); seq != 0x0050; seq++ {
+			p, err := sender.EncryptRTP(nil, testRTP(seq))
+			if err != nil {
+				t.Fatal(err)
+			}
+			protected[seq] = p
+		}
+		for _, tc := range []struct {
+			seq uint16
+			ok  bool
+		}{
+			{seq: 0xffc0, ok: true},
+			{seq: 0x0010, ok: true},
+			// the reordered package in the window is accepted once.
+			{seq: 0xfff0, ok: true},
+			{seq: 0xfff0},
+			{seq: 0x0010},
+			{seq: 0x0040, ok: true},
+			// the package older than the window.
+			{seq: 0xfff1},
+			{seq: 0x0002, ok: true},
+		} {
+			got, err := receiver.DecryptRTP(nil, protected[tc.seq])
+			if (err == nil) != tc.ok {
+				t.Fatalf("%s: decrypt %04x: %v", suite, tc.seq, err)
+			}
+			if tc.ok && !bytes.Equal(got, testRTP(tc.seq)) {
+				t.Fatalf("%s: decrypt %04x = %x", suite, tc.seq, got)
+			}
+		}
+		// the forged package is not marked received.
+		forged := append([]byte(nil), protected[0x0041]...)
+		forged[len(forged)-1] ^= 1
+		if _, err := receiver.DecryptRTP(nil, forged); err == nil {
+			t.Fatalf("%s: the forged package is decrypted", suite)
+		}
+		if _, err := receiver.DecryptRTP(nil, protected[0x0041]); err != nil {
+			t.Fatalf("%s: decrypt after the forged one: %v", suite, err)
+		}
+	}
+}
+
+func TestReplayRTCP(t *testing.T) {
+	sender, receiver := testContexts(t, AES128CMHMACSHA180)
+	sr := make([]byte, 28)
+	sr[0], sr[1] = 0x80, 200
+	binary.BigEndian.PutUint16(sr[2:], 6)
+	binary.BigEndian.PutUint32(sr[4:], 0xcafe)
+	var protected [][]byte
+	for i := 0; i < 70; i++ {
+		binary.BigEndian.PutUint32(sr[20:], uint32(i))
+		p, err := sender.EncryptRTCP(nil, sr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		protected = append(protected, p)
+	}
+	for _, tc := range []struct {
+		index int
+		ok    bool
+	}{
+		{index: 1, ok: true},
+		{index: 1},
+		{index: 0, ok: true},
+		{index: 69, ok: true},
+		// the window holds the latest 64 indices.
+		{index: 6, ok: true},
+		{index: 6},
+		{index: 5},
+	} {
+		got, err := receiver.DecryptRTCP(nil, protected[tc.index])
+		if (err == nil) != tc.ok {
+			t.Fatalf("decrypt %d: %v", tc.index, err)
+		}
+		if tc.ok && binary.BigEndian.Uint32(got[20:]) != uint32(tc.index) {
+			t.Fatalf("decrypt %d = %x", tc.index, got)
+		}
+	}
+}
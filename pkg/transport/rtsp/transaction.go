@@ -1,13 +1,17 @@
 package rtsp
 
 import (
-	"encoding/binary"
 	"fmt"
+	"github.com/ChinasMr/kaka/pkg/transport/rtsp/header"
+	"github.com/ChinasMr/kaka/pkg/transport/rtsp/methods"
 	"github.com/ChinasMr/kaka/pkg/transport/rtsp/status"
 	"gortc.io/sdp"
 	"io"
 	"net"
+	"net/url"
+	"strconv"
 	"sync"
+	"time"
 )
 
 var _ Transaction = (*transaction)(nil)
@@ -15,17 +19,32 @@ var _ Transaction = (*transaction)(nil)
 type Media struct {
 	control     string
 	interleaved bool
+	multicast   bool
 	record      bool
 	rtp         int
 	rtcp        int
 	order       int
+	// the rtcp is muxed on the rtp port.
+	mux bool
+	// the server port pair of the udp media, nil on the shared sockets.
+	pair *udpPair
+	// the ssrc signaled by the recording client.
+	ssrc    uint32
+	hasSSRC bool
+	// the rtp payload types of the udp media in the description.
+	payloads map[uint8]bool
+	peer     udpPeer
+	// the retransmission buffer of the udp media of a reader.
+	nack *retransmitter
+	// the srtp contexts of the secure media.
+	secure *secureMedia
 }
 
 type Transaction interface {
 	ID() string
 	IP() net.IP
 	Status() status.Status
-	Forward(p *Package, wg *sync.WaitGroup) error
+	Forward(p *Package) error
 	Response(res Response) error
 	Request(req Request) error
 	Medias() map[string]*Media
@@ -35,12 +54,26 @@ type Transaction interface {
 	PrePlay(sdp *sdp.Message) bool
 	PreInit()
 	Interleaved() bool
-	ReadInterleavedFrame(frame []byte) (int, uint32, error)
+	Multicast() bool
+	// Secure reports whether the control connection is over tls.
+	Secure() bool
+	ReadInterleavedPackage() (*Package, error)
 	WriteInterleavedFrame(channel int, frame []byte) error
 	Read(buf []byte) (int, error)
 	RTCP() int
 	RTP() int
 	Close() error
+	// Feedback handle the rtcp feedback of the reader on the media.
+	Feedback(m *Media, data []byte)
+	// Unprotect decrypt the interleaved package of the secure media in place,
+	// it returns false if the package is not authenticated.
+	Unprotect(p *Package) bool
+	// Proto returns the rtsp version of the last request of the session.
+	Proto() string
+	// Notify send PLAY_NOTIFY of the reason to the playing rtsp 2.0 client,
+	// the range played is added if not in the headers. It does nothing
+	// for the rtsp 1.0 client.
+	Notify(reason string, headers map[string]string) error
 }
 
 type rtcpFamily struct {
@@ -75,6 +108,17 @@ type transaction struct {
 	interleaved bool
 	rf          *rtcpFamily
 	mu          sync.Mutex
+	wbuf        []byte
+	rhdr        [4]byte
+	// the rtsp version of the last request.
+	proto string
+	// the id of the pipelined requests the session is set up by.
+	pipelined string
+	// the url and the time of the last PLAY request.
+	playURL *url.URL
+	played  time.Time
+	// the sequence number of the requests sent by the server.
+	cSeq uint64
 }
 
 func (t *transaction) IP() net.IP {
@@ -84,10 +128,23 @@ func (t *transaction) IP() net.IP {
 func (t *transaction) PreInit() {
 	t.rwm.Lock()
 	defer t.rwm.Unlock()
-	t.medias = map[string]*Media{}
+	t.releaseMedias()
 	t.state = status.INIT
 }
 
+// release the server ports of the medias, must be called with the lock held.
+func (t *transaction) releaseMedias() {
+	for _, m := range t.medias {
+		if m.pair != nil {
+			m.pair.close()
+		}
+		if m.nack != nil {
+			m.nack.close()
+		}
+	}
+	t.medias = map[string]*Media{}
+}
+
 func (t *transaction) RTCP() int {
 	return t.rf.rtcpPort
 }
@@ -101,9 +158,22 @@ func (t *transaction) Read(buf []byte) (int, error) {
 }
 
 func (t *transaction) Interleaved() bool {
+	t.rwm.RLock()
+	defer t.rwm.RUnlock()
 	return t.interleaved
 }
 
+// Multicast the medias are delivered to the multicast groups
+// by the channel instead of the transaction.
+func (t *transaction) Multicast() bool {
+	t.rwm.RLock()
+	defer t.rwm.RUnlock()
+	for _, m := range t.medias {
+		return m.multicast
+	}
+	return false
+}
+
 func (t *transaction) PrePlay(sdp *sdp.Message) bool {
 	t.rwm.Lock()
 	defer t.rwm.Unlock()
@@ -157,8 +227,8 @@ func (t *transaction) PreRecord(sdp *sdp.Message) bool {
 }
 
 func (t *transaction) PreReady(sdp *sdp.Message) bool {
-	t.rwm.RLock()
-	defer t.rwm.RUnlock()
+	t.rwm.Lock()
+	defer t.rwm.Unlock()
 	for _, m := range sdp.Medias {
 		s := m.Attribute("control")
 		_, ok := t.medias[s]
@@ -170,17 +240,25 @@ func (t *transaction) PreReady(sdp *sdp.Message) bool {
 	return true
 }
 
+// Medias returns a copy of the medias, it is safe to range while adding.
 func (t *transaction) Medias() map[string]*Media {
 	t.rwm.RLock()
 	defer t.rwm.RUnlock()
-	return t.medias
+	rv := make(map[string]*Media, len(t.medias))
+	for k, m := range t.medias {
+		rv[k] = m
+	}
+	return rv
 }
 
 func (t *transaction) AddMedia(media *Media) {
 	t.rwm.Lock()
-	t.rwm.Unlock()
+	defer t.rwm.Unlock()
 	has, ok := t.medias[media.control]
 	if ok {
+		if has.pair != nil && has.pair != media.pair {
+			has.pair.close()
+		}
 		media.order = has.order
 		t.medias[media.control] = media
 		return
@@ -193,6 +271,70 @@ func (t *transaction) Request(req Request) error {
 	return t.transport.Write(req.Encode())
 }
 
+// received record the version of the request and the url of PLAY.
+func (t *transaction) received(req *request) {
+	t.rwm.Lock()
+	defer t.rwm.Unlock()
+	t.proto = req.proto
+	if req.method == methods.PLAY {
+		t.playURL = req.url
+		t.played = time.Now()
+	}
+}
+
+// pipeline bind the pipelined requests of the id to the session.
+func (t *transaction) pipeline(id string) {
+	t.rwm.Lock()
+	defer t.rwm.Unlock()
+	t.pipelined = id
+}
+
+// sessionOf returns the session the request refers to, the pipelined
+// requests refer to the session set up by them without the session header.
+func (t *transaction) sessionOf(req *request) string {
+	sid := req.SessionID()
+	if sid != "" {
+		return sid
+	}
+	v, ok := req.Header(header.PipelinedRequests)
+	if !ok || len(v) == 0 {
+		return ""
+	}
+	t.rwm.RLock()
+	defer t.rwm.RUnlock()
+	if t.pipelined != "" && t.pipelined == v[0] {
+		return t.id
+	}
+	return ""
+}
+
+func (t *transaction) Proto() string {
+	t.rwm.RLock()
+	defer t.rwm.RUnlock()
+	return t.proto
+}
+
+func (t *transaction) Notify(reason string, headers map[string]string) error {
+	t.rwm.Lock()
+	if t.proto != Version2 || t.playURL == nil || t.transport == nil {
+		t.rwm.Unlock()
+		return nil
+	}
+	t.cSeq++
+	req := newRequest(methods.PLAYNOTIFY, t.playURL)
+	req.proto = Version2
+	req.cSeq = strconv.FormatUint(t.cSeq, 10)
+	req.setHeader(header.Session, t.id)
+	req.setHeader(header.Range, fmt.Sprintf("npt=0-%.3f", time.Since(t.played).Seconds()))
+	trans := t.transport
+	t.rwm.Unlock()
+	req.setHeader(header.NotifyReason, reason)
+	for k, v := range headers {
+		req.setHeader(k, v)
+	}
+	return trans.Write(req.Encode())
+}
+
 func (t *transaction) Response(res Response) error {
 	return t.transport.Write(res.Encoding())
 }
@@ -201,8 +343,8 @@ func (t *transaction) Close() error {
 	return t.transport.Close()
 }
 
-func (t *transaction) Forward(p *Package, wg *sync.WaitGroup) error {
-	defer wg.Done()
+func (t *transaction) Forward(p *Package) error {
+	interleaved := t.Interleaved()
 	// there two kinds of package
 	// 1. from the tcp connection, interleaved.
 	// Package:
@@ -215,37 +357,21 @@ func (t *transaction) Forward(p *Package, wg *sync.WaitGroup) error {
 	//		Interleaved -> False
 	//		Order		-> order
 
-	if p.Interleaved && t.interleaved {
-		return t.WriteInterleavedFrame(p.Ch, p.Data[:p.Len])
-	} else if p.Interleaved && !t.interleaved {
+	if p.Interleaved && interleaved {
+		return t.writeInterleaved(p.Ch, p.Data[:p.Len])
+	} else if p.Interleaved && !interleaved {
 		// interleaved frame trans to rtp/rtcp frame.
-		for _, m := range t.medias {
-			if m.order == p.Ch/2 {
-				if p.Ch%2 == 0 {
-					return t.rf.RTP(p.Data[:p.Len], t.transport.IP(), m.rtp)
-				}
-				if p.Ch%2 == 1 {
-					return t.rf.RTCP(p.Data[:p.Len], t.transport.IP(), m.rtcp)
-				}
-				break
-			}
+		if m, ok := t.media(p.Ch / 2); ok {
+			return t.sendUDP(m, p, p.Ch%2 == 1)
 		}
 		return nil
-	} else if !p.Interleaved && t.interleaved {
+	} else if !p.Interleaved && interleaved {
 		// 0 * 2 = 0 + 0/1 = ch 0/1
 		// 1 * 2 = 2 + 0/1 = ch 2/3
-		return t.WriteInterleavedFrame(2*p.Order+p.Ch, p.Data[:p.Len])
-	} else if !p.Interleaved && !t.interleaved {
-		for _, m := range t.medias {
-			if m.order == p.Order {
-				if p.Ch == 0 {
-					return t.rf.RTP(p.Data[:p.Len], t.transport.IP(), m.rtp)
-				}
-				if p.Ch == 1 {
-					return t.rf.RTCP(p.Data[:p.Len], t.transport.IP(), m.rtcp)
-				}
-				break
-			}
+		return t.writeInterleaved(2*p.Order+p.Ch, p.Data[:p.Len])
+	} else if !p.Interleaved && !interleaved {
+		if m, ok := t.media(p.Order); ok {
+			return t.sendUDP(m, p, p.Ch == 1)
 		}
 		return nil
 	} else {
@@ -253,54 +379,122 @@ func (t *transaction) Forward(p *Package, wg *sync.WaitGroup) error {
 	}
 }
 
+// media returns the media of the order.
+func (t *transaction) media(order int) (*Media, bool) {
+	t.rwm.RLock()
+	defer t.rwm.RUnlock()
+	for _, m := range t.medias {
+		if m.order == order {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+// sendUDP send the package of the media, and keep the rtp one for retransmission.
+func (t *transaction) sendUDP(m *Media, p *Package, rtcp bool) error {
+	if !rtcp && m.nack != nil {
+		m.nack.store(p)
+	}
+	return t.writeUDP(m, p.Data[:p.Len], rtcp)
+}
+
+func (t *transaction) Feedback(m *Media, data []byte) {
+	m.feedback(data, func(b []byte) error {
+		return t.sendRaw(m, b, false)
+	})
+}
+
+func (t *transaction) Unprotect(p *Package) bool {
+	m, ok := t.media(p.Ch / 2)
+	if !ok {
+		return true
+	}
+	return m.unprotect(p, p.Ch%2 == 1)
+}
+
+// writeInterleaved write the frame of the channel, encrypted if the media is secure.
+func (t *transaction) writeInterleaved(ch int, frame []byte) error {
+	m, ok := t.media(ch / 2)
+	if !ok {
+		return t.WriteInterleavedFrame(ch, frame)
+	}
+	return m.protect(frame, ch%2 == 1, func(data []byte) error {
+		return t.WriteInterleavedFrame(ch, data)
+	})
+}
+
+// writeUDP send the rtp/rtcp package of the media from its server port pair,
+// or from the shared sockets if the media has no pair.
+func (t *transaction) writeUDP(m *Media, data []byte, rtcp bool) error {
+	return m.protect(data, rtcp, func(b []byte) error {
+		return t.sendRaw(m, b, rtcp)
+	})
+}
+
+// sendRaw send the package as it is.
+func (t *transaction) sendRaw(m *Media, data []byte, rtcp bool) error {
+	t.rwm.RLock()
+	trans, rf := t.transport, t.rf
+	t.rwm.RUnlock()
+	if trans == nil {
+		return io.ErrClosedPipe
+	}
+	addr := m.dest(trans.IP(), rtcp)
+	if m.pair != nil {
+		return m.pair.write(data, addr, rtcp && !m.mux)
+	}
+	if rtcp && !m.mux {
+		return rf.RTCP(data, addr.IP, addr.Port)
+	}
+	return rf.RTP(data, addr.IP, addr.Port)
+}
+
 func (t *transaction) ID() string {
+	t.rwm.RLock()
+	defer t.rwm.RUnlock()
 	return t.id
 }
 
 func (t *transaction) Status() status.Status {
 	t.rwm.RLock()
-	t.rwm.RUnlock()
+	defer t.rwm.RUnlock()
 	return t.state
 }
 
 func (t *transaction) WriteInterleavedFrame(channel int, frame []byte) error {
 	t.mu.Lock()
 	defer t.mu.Unlock()
-	buf := make([]byte, 2048)
-	buf[0] = 0x24
-	buf[1] = byte(channel)
-	binary.BigEndian.PutUint16(buf[2:], uint16(len(frame)))
-	n := copy(buf[4:], frame)
-	return t.transport.Write(buf[:4+n])
+	// the buffer is reused by the frames of the transaction.
+	t.wbuf = appendInterleavedFrame(t.wbuf[:0], channel, frame)
+	return t.transport.Write(t.wbuf)
+}
+
+func (t *transaction) Secure() bool {
+	return t.transport.Secure()
 }
 
-func (t *transaction) ReadInterleavedFrame(frame []byte) (int, uint32, error) {
+func (t *transaction) ReadInterleavedPackage() (*Package, error) {
 	// interleavedHeader example
 	// Magic:0x24   bytes 1
 	// Channel:0x01 bytes 2
 	// Length:84    bytes 3-4
-	interleavedHeader := make([]byte, 4)
-	conn := t.transport.Conn()
-	_, err := io.ReadFull(conn, interleavedHeader)
+	// the requests in between the frames are left to the parser, eg: GET_PARAMETER.
+	magic, err := t.transport.Peek(1)
 	if err != nil {
-		return -1, 0, err
+		return nil, err
 	}
-
-	if interleavedHeader[0] == 0x54 {
-		return -1, 0, io.EOF
+	if magic[0] != '$' {
+		return nil, errInterleavedRequest
 	}
-
-	if interleavedHeader[1] == 0x24 {
-		return -1, 0, fmt.Errorf("magic byte error")
-	}
-
-	frameLen := binary.BigEndian.Uint16(interleavedHeader[2:])
-	if frameLen > 2048 {
-		return -1, 0, fmt.Errorf("freame len greater than 2048")
-	}
-	_, err = io.ReadFull(conn, frame[:frameLen])
+	interleavedHeader := t.rhdr[:]
+	conn := t.transport.Conn()
+	_, err = io.ReadFull(conn, interleavedHeader)
 	if err != nil {
-		return -1, 0, err
+		return nil, err
+	}
+	if interleavedHeader[0] != '$' {
+		return nil, fmt.Errorf("magic byte error")
 	}
-	return int(interleavedHeader[1]), uint32(frameLen), nil
+	return readInterleavedBody(conn, interleavedHeader)
 }
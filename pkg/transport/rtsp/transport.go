@@ -1,10 +1,28 @@
 package rtsp
 
 import (
+	"bufio"
+	"crypto/tls"
 	"net"
+	"strings"
 )
 
 const Version1 = "RTSP/1.0"
+const Version2 = "RTSP/2.0"
+
+// negotiateVersion returns the version the server answers the request of proto,
+// and whether the request is supported. The higher versions are answered by
+// the highest one of the server, rfc 7826.
+func negotiateVersion(proto string) (string, bool) {
+	switch proto {
+	case Version1, Version2:
+		return proto, true
+	}
+	if strings.HasPrefix(proto, "RTSP/1.") || strings.HasPrefix(proto, "RTSP/0.") {
+		return Version1, false
+	}
+	return Version2, false
+}
 
 var _ Transport = (*transport)(nil)
 
@@ -14,6 +32,10 @@ type Transport interface {
 	Parse() (*request, error)
 	Write(data []byte) error
 	Read(buf []byte) (int, error)
+	// Peek returns the next bytes without reading them.
+	Peek(n int) ([]byte, error)
+	// Secure reports whether the connection is over tls.
+	Secure() bool
 	Conn() net.Conn
 	Close() error
 }
@@ -21,6 +43,9 @@ type Transport interface {
 type transport struct {
 	conn net.Conn
 	addr *net.TCPAddr
+	// the requests and the interleaved frames are read through it.
+	br     *bufio.Reader
+	secure bool
 }
 
 func (g *transport) IP() net.IP {
@@ -37,12 +62,39 @@ func newTransport(conn net.Conn) (*transport, error) {
 	if err != nil {
 		return nil, err
 	}
+	pc, ok := conn.(*peekConn)
+	if !ok {
+		pc = &peekConn{Conn: conn, br: bufio.NewReader(conn)}
+	}
 	return &transport{
-		conn: conn,
-		addr: addr,
+		conn:   pc,
+		addr:   addr,
+		br:     pc.br,
+		secure: isTLS(conn),
 	}, nil
 }
 
+// isTLS reports whether the connection, or the one it wraps, is over tls.
+func isTLS(conn net.Conn) bool {
+	switch c := conn.(type) {
+	case *tls.Conn:
+		return true
+	case *peekConn:
+		return isTLS(c.Conn)
+	case *tunnelConn:
+		// both the GET and the POST connections carry the session.
+		return isTLS(c.Conn) && isTLS(c.post)
+	case *wsConn:
+		return isTLS(c.ws.UnderlyingConn())
+	default:
+		return false
+	}
+}
+
+func (g *transport) Secure() bool {
+	return g.secure
+}
+
 func (g *transport) Write(data []byte) error {
 	_, err := g.conn.Write(data)
 	return err
@@ -52,8 +104,12 @@ func (g *transport) Read(buf []byte) (int, error) {
 	return g.conn.Read(buf)
 }
 
+func (g *transport) Peek(n int) ([]byte, error) {
+	return g.br.Peek(n)
+}
+
 func (g *transport) Parse() (*request, error) {
-	return parse0(g.conn)
+	return parse0(g.br)
 }
 
 func (g *transport) Addr() string {
@@ -0,0 +1,102 @@
+package rtsp
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/ChinasMr/kaka/pkg/transport/rtsp/header"
+	"github.com/ChinasMr/kaka/pkg/transport/rtsp/methods"
+)
+
+func TestNegotiateVersion(t *testing.T) {
+	for _, tc := range []struct {
+		proto, want string
+		ok          bool
+	}{
+		{proto: "RTSP/1.0", want: Version1, ok: true},
+		{proto: "RTSP/2.0", want: Version2, ok: true},
+		{proto: "RTSP/1.1", want: Version1},
+		{proto: "RTSP/0.9", want: Version1},
+		// the higher versions are answered by the highest one.
+		{proto: "RTSP/2.1", want: Version2},
+		{proto: "RTSP/3.0", want: Version2},
+	} {
+		if got, ok := negotiateVersion(tc.proto); got != tc.want || ok != tc.ok {
+			t.Errorf("negotiateVersion(%q) = %q, %v", tc.proto, got, ok)
+		}
+	}
+}
+
+func TestRTSP2Play(t *testing.T) {
+	_, addr := newTestServer(t)
+	pub := publishClient(t, addr, "live", true)
+	defer pub.Close()
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	br := bufio.NewReader(c)
+	url := "rtsp://" + addr + "/live"
+
+	// the unsupported versions are answered by the version negotiated.
+	for _, tc := range []struct {
+		proto, want string
+		code        uint64
+	}{
+		{proto: "RTSP/3.0", want: Version2, code: 505},
+		{proto: "RTSP/1.1", want: Version1, code: 505},
+		{proto: Version2, want: Version2, code: 200},
+	} {
+		res := rawRequest(t, c, br, "OPTIONS %s %s\r\nCSeq: 1\r\n\r\n", url, tc.proto)
+		if res.proto != tc.want || res.Code() != tc.code {
+			t.Fatalf("OPTIONS of %s: %s %d", tc.proto, res.proto, res.Code())
+		}
+	}
+
+	res := rawRequest(t, c, br, "DESCRIBE %s RTSP/2.0\r\nCSeq: 2\r\n\r\n", url)
+	if res.proto != Version2 || res.Code() != 200 {
+		t.Fatalf("DESCRIBE %s %d", res.proto, res.Code())
+	}
+	// the pipelined requests refer to the session set up by the first one.
+	res = rawRequest(t, c, br, "SETUP %s/streamid=0 RTSP/2.0\r\nCSeq: 3\r\nPipelined-Requests: 7\r\n"+
+		"Transport: RTP/AVP/TCP;unicast;interleaved=0-1\r\n\r\n", url)
+	session, _ := res.Header("Session")
+	pipelined, _ := res.Header(header.PipelinedRequests)
+	ranges, _ := res.Header(header.AcceptRanges)
+	if res.Code() != 200 || len(session) == 0 || len(pipelined) == 0 || pipelined[0] != "7" || len(ranges) == 0 {
+		t.Fatalf("SETUP %d, Session %v, Pipelined-Requests %v, Accept-Ranges %v", res.Code(), session, pipelined, ranges)
+	}
+	id := strings.Split(session[0], ";")[0]
+	res = rawRequest(t, c, br, "SETUP %s/streamid=1 RTSP/2.0\r\nCSeq: 4\r\nPipelined-Requests: 7\r\n"+
+		"Transport: RTP/AVP/TCP;unicast;interleaved=2-3\r\n\r\n", url)
+	if session, _ = res.Header("Session"); res.Code() != 200 || len(session) == 0 || strings.Split(session[0], ";")[0] != id {
+		t.Fatalf("SETUP of the pipelined %d, Session %v", res.Code(), session)
+	}
+	res = rawRequest(t, c, br, "PLAY %s RTSP/2.0\r\nCSeq: 5\r\nPipelined-Requests: 7\r\n\r\n", url)
+	rng, _ := res.Header(header.Range)
+	if res.Code() != 200 || len(rng) == 0 || !strings.HasPrefix(rng[0], "npt=now-") {
+		t.Fatalf("PLAY %d, Range %v", res.Code(), rng)
+	}
+	// the session of another id is not referred.
+	res = rawRequest(t, c, br, "PAUSE %s RTSP/2.0\r\nCSeq: 6\r\nPipelined-Requests: 8\r\n\r\n", url)
+	if res.Code() == 200 {
+		t.Fatal("PAUSE of another pipelined id")
+	}
+
+	// the reader is notified once the stream ends.
+	_ = pub.Close()
+	req, err := parse0(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reason, _ := req.Header(header.NotifyReason)
+	if req.method != methods.PLAYNOTIFY || req.proto != Version2 || len(reason) == 0 || reason[0] != header.NotifyEndOfStream {
+		t.Fatalf("%s %s, Notify-Reason %v", req.method, req.proto, reason)
+	}
+	if sid := req.SessionID(); sid != id {
+		t.Fatalf("PLAY_NOTIFY of the session %q, want %q", sid, id)
+	}
+}
@@ -0,0 +1,218 @@
+package rtsp
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RTSP over HTTP, the QuickTime way.
+// The client opens two http connections with the same x-sessioncookie,
+// the GET one carries the server to client data and the POST one
+// carries the base64 encoded client to server data.
+
+const (
+	headerSessionCookie = "X-Sessioncookie"
+	contentTypeTunnel   = "application/x-rtsp-tunnelled"
+)
+
+// the max duration the GET connection waits for its POST connection.
+var tunnelTimeout = 10 * time.Second
+
+type tunnel struct {
+	get  net.Conn
+	post chan *tunnelConn
+}
+
+// peekConn is a connection that has been peeked.
+type peekConn struct {
+	net.Conn
+	br *bufio.Reader
+}
+
+func (p *peekConn) Read(b []byte) (int, error) {
+	return p.br.Read(b)
+}
+
+// tunnelConn joins the GET and POST connections.
+type tunnelConn struct {
+	net.Conn
+	post net.Conn
+	rd   io.Reader
+}
+
+func (t *tunnelConn) Read(b []byte) (int, error) {
+	return t.rd.Read(b)
+}
+
+func (t *tunnelConn) Close() error {
+	_ = t.post.Close()
+	return t.Conn.Close()
+}
+
+func (t *tunnelConn) SetDeadline(d time.Time) error {
+	_ = t.post.SetDeadline(d)
+	return t.Conn.SetDeadline(d)
+}
+
+func (t *tunnelConn) SetReadDeadline(d time.Time) error {
+	return t.post.SetReadDeadline(d)
+}
+
+// is the connection starts with a http tunnel request.
+func isTunnelRequest(br *bufio.Reader) bool {
+	b, err := br.Peek(5)
+	if err != nil {
+		return false
+	}
+	return string(b[:4]) == "GET " || string(b) == "POST "
+}
+
+func (s *Server) handleTunnel(conn net.Conn, br *bufio.Reader) {
+	req, err := http.ReadRequest(br)
+	if err != nil {
+		s.log.Errorf("can not read tunnel request: %v", err)
+		_ = conn.Close()
+		return
+	}
+	cookie := req.Header.Get(headerSessionCookie)
+	if cookie == "" {
+		_, _ = conn.Write([]byte("HTTP/1.0 400 Bad Request\r\nConnection: close\r\n\r\n"))
+		_ = conn.Close()
+		return
+	}
+	switch req.Method {
+	case http.MethodGet:
+		s.handleTunnelGet(conn, cookie)
+	case http.MethodPost:
+		s.handleTunnelPost(conn, br, cookie)
+	default:
+		_ = conn.Close()
+	}
+}
+
+func (s *Server) handleTunnelGet(conn net.Conn, cookie string) {
+	t := &tunnel{
+		get:  conn,
+		post: make(chan *tunnelConn, 1),
+	}
+	s.tm.Lock()
+	if _, ok := s.tunnels[cookie]; ok {
+		s.tm.Unlock()
+		_, _ = conn.Write([]byte("HTTP/1.0 400 Bad Request\r\nConnection: close\r\n\r\n"))
+		_ = conn.Close()
+		return
+	}
+	s.tunnels[cookie] = t
+	s.tm.Unlock()
+	defer func() {
+		s.tm.Lock()
+		if s.tunnels[cookie] == t {
+			delete(s.tunnels, cookie)
+		}
+		s.tm.Unlock()
+	}()
+
+	_, err := conn.Write([]byte(strings.Join([]string{
+		"HTTP/1.0 200 OK",
+		"Server: kaka",
+		"Connection: close",
+		"Cache-Control: no-store",
+		"Pragma: no-cache",
+		"Content-Type: " + contentTypeTunnel,
+	}, "\r\n") + "\r\n\r\n"))
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+
+	timer := time.NewTimer(tunnelTimeout)
+	defer timer.Stop()
+	select {
+	case tc := <-t.post:
+		s.log.Debugf("rtsp over http tunnel established: %s", cookie)
+		s.handleRawConn(tc)
+	case <-timer.C:
+		s.log.Errorf("wait for the post connection of tunnel %s timeout", cookie)
+		_ = conn.Close()
+		// the post connection arrived along the timeout is closed too,
+		// it is sent under the lock so it is found once the tunnel is removed.
+		s.tm.Lock()
+		if s.tunnels[cookie] == t {
+			delete(s.tunnels, cookie)
+		}
+		s.tm.Unlock()
+		select {
+		case tc := <-t.post:
+			_ = tc.Close()
+		default:
+		}
+	}
+}
+
+func (s *Server) handleTunnelPost(conn net.Conn, br *bufio.Reader, cookie string) {
+	s.tm.Lock()
+	defer s.tm.Unlock()
+	t, ok := s.tunnels[cookie]
+	if !ok {
+		_ = conn.Close()
+		return
+	}
+	delete(s.tunnels, cookie)
+	// the post request has no response, the buffered channel
+	// never blocks as the tunnel is taken by a single post.
+	t.post <- &tunnelConn{
+		Conn: t.get,
+		post: conn,
+		rd:   &base64Reader{rd: br},
+	}
+}
+
+// base64Reader decodes the base64 stream which may be padded
+// at the end of every rtsp message.
+type base64Reader struct {
+	rd      io.Reader
+	quantum []byte
+	decoded []byte
+	raw     []byte
+}
+
+func (b *base64Reader) Read(p []byte) (int, error) {
+	for len(b.decoded) == 0 {
+		if b.raw == nil {
+			b.raw = make([]byte, 4096)
+		}
+		n, err := b.rd.Read(b.raw)
+		for _, c := range b.raw[:n] {
+			if c == '\r' || c == '\n' || c == ' ' || c == '\t' {
+				continue
+			}
+			b.quantum = append(b.quantum, c)
+			if len(b.quantum) < 4 {
+				continue
+			}
+			var out [3]byte
+			m, err1 := base64.StdEncoding.Decode(out[:], b.quantum)
+			if err1 != nil {
+				return 0, fmt.Errorf("can not decode tunnel data: %v", err1)
+			}
+			b.decoded = append(b.decoded, out[:m]...)
+			b.quantum = b.quantum[:0]
+		}
+		if err != nil && len(b.decoded) == 0 {
+			return 0, err
+		}
+	}
+	n := copy(p, b.decoded)
+	if n == len(b.decoded) {
+		b.decoded = b.decoded[:0]
+	} else {
+		b.decoded = b.decoded[n:]
+	}
+	return n, nil
+}
@@ -0,0 +1,82 @@
+package rtsp
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// openTunnel send the tunnel request of the method and the cookie on a new connection.
+func openTunnel(t *testing.T, addr string, method string, cookie string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = c.Close()
+	})
+	if _, err = fmt.Fprintf(c, "%s /live HTTP/1.0\r\nx-sessioncookie: %s\r\nContent-Type: %s\r\n\r\n", method, cookie, contentTypeTunnel); err != nil {
+		t.Fatal(err)
+	}
+	_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return c, bufio.NewReader(c)
+}
+
+func TestTunnel(t *testing.T) {
+	_, addr := newTestServer(t)
+	get, gbr := openTunnel(t, addr, http.MethodGet, "joined")
+	res, err := http.ReadResponse(gbr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != contentTypeTunnel {
+		t.Fatalf("GET answered %d %q", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+	// the requests are base64 encoded on the post connection,
+	// the quanta may be split across the writes.
+	post, _ := openTunnel(t, addr, http.MethodPost, "joined")
+	for cseq := 1; cseq <= 2; cseq++ {
+		encoded := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("OPTIONS rtsp://%s/live RTSP/1.0\r\nCSeq: %d\r\n\r\n", addr, cseq)))
+		for _, part := range []string{encoded[:5], encoded[5:]} {
+			if _, err = io.WriteString(post, part); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		_ = get.SetReadDeadline(time.Now().Add(5 * time.Second))
+		r, err1 := parseResponse(gbr)
+		if err1 != nil {
+			t.Fatal(err1)
+		}
+		if v, _ := r.Header("CSeq"); r.code != 200 || len(v) == 0 || v[0] != fmt.Sprint(cseq) {
+			t.Fatalf("OPTIONS %d answered %d %v", cseq, r.code, v)
+		}
+	}
+}
+
+func TestTunnelExpired(t *testing.T) {
+	timeout := tunnelTimeout
+	tunnelTimeout = 100 * time.Millisecond
+	t.Cleanup(func() {
+		tunnelTimeout = timeout
+	})
+	_, addr := newTestServer(t)
+	_, gbr := openTunnel(t, addr, http.MethodGet, "late")
+	if _, err := http.ReadResponse(gbr, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gbr.ReadByte(); err != io.EOF {
+		t.Fatalf("the expired GET connection: %v", err)
+	}
+	// the post of the expired tunnel is closed.
+	_, pbr := openTunnel(t, addr, http.MethodPost, "late")
+	if _, err := pbr.ReadByte(); err != io.EOF {
+		t.Fatalf("the POST connection of the expired tunnel: %v", err)
+	}
+}
@@ -0,0 +1,169 @@
+package rtsp
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// portPool allocates the server port pairs of the sessions,
+// so the inbound packages are demultiplexed by the local port
+// instead of guessing by the source address.
+type portPool struct {
+	mu   sync.Mutex
+	ip   net.IP
+	min  int
+	max  int
+	next int
+}
+
+func newPortPool(ip net.IP, min int, max int) (*portPool, error) {
+	if min <= 0 || min%2 != 0 || max <= min || max > 65535 {
+		return nil, fmt.Errorf("invalid udp port range: %d-%d", min, max)
+	}
+	return &portPool{
+		ip:   ip,
+		min:  min,
+		max:  max,
+		next: min,
+	}, nil
+}
+
+// alloc bind a free pair, rtp on the even port and rtcp on the next one,
+// the muxed media binds the even port only.
+func (p *portPool) alloc(mux bool) (*udpPair, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := 0; i < (p.max-p.min+1)/2; i++ {
+		port := p.next
+		p.next += 2
+		if p.next+1 > p.max {
+			p.next = p.min
+		}
+		rtpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: p.ip, Port: port})
+		if err != nil {
+			continue
+		}
+		pair := &udpPair{
+			rtpConn:  rtpConn,
+			rtpPort:  port,
+			rtcpPort: port,
+		}
+		if !mux {
+			rtcpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: p.ip, Port: port + 1})
+			if err != nil {
+				_ = rtpConn.Close()
+				continue
+			}
+			pair.rtcpConn, pair.rtcpPort = rtcpConn, port+1
+			go pair.serve(rtcpConn, 1)
+		}
+		go pair.serve(rtpConn, 0)
+		return pair, nil
+	}
+	return nil, fmt.Errorf("udp ports exhausted: %d-%d", p.min, p.max)
+}
+
+// udpPair is the server port pair of a session media.
+type udpPair struct {
+	rtpConn *net.UDPConn
+	// nil if the rtcp is muxed on the rtp port.
+	rtcpConn *net.UDPConn
+	rtpPort  int
+	rtcpPort int
+	mu       sync.RWMutex
+	media    *Media
+	ip       net.IP
+	order    int
+	output   chan *Package
+	jb       *jitterBuffer
+}
+
+// bind the pair to the media of the session from the ip.
+func (u *udpPair) bind(media *Media, ip net.IP) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.media = media
+	u.ip = ip
+}
+
+// setOutput deliver the inbound packages of the media to the output,
+// the packages are dropped if the output is not set. The rtp packages
+// are reordered in the latency window if it is set.
+func (u *udpPair) setOutput(order int, output chan *Package, latency time.Duration) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.order = order
+	u.output = output
+	if u.jb != nil {
+		u.jb.close()
+		u.jb = nil
+	}
+	if latency > 0 {
+		u.jb = newJitterBuffer(latency, output)
+	}
+}
+
+func (u *udpPair) serve(conn *net.UDPConn, port int) {
+	buf := make([]byte, maxPackageSize)
+	for {
+		p, addr, err := readUDPPackage(conn, buf)
+		if err != nil {
+			return
+		}
+		u.mu.RLock()
+		media, ip, output, order, jb := u.media, u.ip, u.output, u.order, u.jb
+		u.mu.RUnlock()
+		ch := port
+		if media.muxed(p) {
+			ch = 1
+		}
+		// the playing clients send the rtcp receiver reports,
+		// they are accepted for learning their addresses and the nack.
+		if media == nil || !media.accept(addr, ip, ch == 1, p.Data[:p.Len], true) || output == nil {
+			if media != nil && ch == 1 {
+				media.feedback(p.Data[:p.Len], func(b []byte) error {
+					return u.write(b, media.dest(ip, false), false)
+				})
+			}
+			putPackage(p)
+			continue
+		}
+		if !media.unprotect(p, ch == 1) {
+			putPackage(p)
+			continue
+		}
+		p.Ch = ch
+		p.Order = order
+		p.Interleaved = false
+		if jb != nil {
+			jb.push(p)
+			continue
+		}
+		output <- p
+	}
+}
+
+// write the package from the server port, so the peer
+// sees the same port as the one in the setup response.
+func (u *udpPair) write(data []byte, addr *net.UDPAddr, rtcp bool) error {
+	conn := u.rtpConn
+	if rtcp && u.rtcpConn != nil {
+		conn = u.rtcpConn
+	}
+	_, err := conn.WriteToUDP(data, addr)
+	return err
+}
+
+func (u *udpPair) close() {
+	_ = u.rtpConn.Close()
+	if u.rtcpConn != nil {
+		_ = u.rtcpConn.Close()
+	}
+	u.mu.Lock()
+	if u.jb != nil {
+		u.jb.close()
+	}
+	u.mu.Unlock()
+}
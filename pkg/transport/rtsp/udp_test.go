@@ -0,0 +1,161 @@
+package rtsp
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestMuxedMediaSinglePort(t *testing.T) {
+	s, addr := newTestServer(t, UDPPorts(46000, 46199))
+	pub := NewClient(ClientInterleaved(false), ClientRTCPMux(true), ClientTimeout(5*time.Second))
+	if err := pub.Dial(context.Background(), "rtsp://"+addr+"/live"); err != nil {
+		t.Fatal(err)
+	}
+	defer pub.Close()
+	if err := pub.Announce([]byte(testSDP)); err != nil {
+		t.Fatal(err)
+	}
+	for _, control := range []string{"streamid=0", "streamid=1"} {
+		if err := pub.Setup(control, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pub.Record(); err != nil {
+		t.Fatal(err)
+	}
+	readers := map[bool]*Client{}
+	for _, mux := range []bool{true, false} {
+		cl := NewClient(ClientInterleaved(false), ClientRTCPMux(mux), ClientTimeout(5*time.Second))
+		if err := cl.Dial(context.Background(), "rtsp://"+addr+"/live"); err != nil {
+			t.Fatal(err)
+		}
+		defer cl.Close()
+		if _, _, err := cl.Describe(); err != nil {
+			t.Fatal(err)
+		}
+		for _, control := range []string{"streamid=0", "streamid=1"} {
+			if err := cl.Setup(control, false); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := cl.Play(); err != nil {
+			t.Fatal(err)
+		}
+		readers[mux] = cl
+	}
+	for _, cl := range []*Client{pub, readers[true]} {
+		if m := cl.medias[0]; m.rtcpConn != nil || m.rtcpAddr.Port != m.rtpAddr.Port {
+			t.Fatalf("the muxed media binds the rtcp port %v of the server %v", m.rtcpConn, m.rtcpAddr)
+		}
+	}
+	if m := readers[false].medias[0]; m.rtcpConn == nil || m.rtcpAddr.Port != m.rtpAddr.Port+1 {
+		t.Fatalf("the media binds the rtcp port %v of the server %v", m.rtcpConn, m.rtcpAddr)
+	}
+	// only the media without the mux binds the rtcp socket on the server.
+	tc := s.tc.(*transactionController)
+	tc.rwm.RLock()
+	pairs := map[bool]int{}
+	for _, tx := range tc.txs {
+		tx.rwm.RLock()
+		for _, m := range tx.medias {
+			if m.pair != nil {
+				if (m.pair.rtcpConn == nil) != m.mux || m.mux && m.pair.rtcpPort != m.pair.rtpPort {
+					t.Errorf("the media muxed %v binds the rtcp port %d", m.mux, m.pair.rtcpPort)
+				}
+				pairs[m.mux]++
+			}
+		}
+		tx.rwm.RUnlock()
+	}
+	tc.rwm.RUnlock()
+	if pairs[true] != 4 || pairs[false] != 2 {
+		t.Fatalf("server ports allocated %v", pairs)
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for seq := uint16(0); ; seq++ {
+			select {
+			case <-stop:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+			_ = writeTestPackage(pub, 0, seq)
+		}
+	}()
+	for mux, cl := range readers {
+		timer := time.AfterFunc(5*time.Second, func() {
+			_ = cl.Close()
+		})
+		for i := 0; i < 3; {
+			p, err := cl.ReadPackage()
+			if err != nil {
+				t.Fatalf("the reader muxed %v received %d packages: %v", mux, i, err)
+			}
+			if _, rtcp := p.media(); !rtcp {
+				i++
+			}
+			putPackage(p)
+		}
+		timer.Stop()
+	}
+}
+
+func TestPortPool(t *testing.T) {
+	ip := net.IPv4(127, 0, 0, 1)
+	for _, r := range [][2]int{{0, 10}, {47101, 47105}, {47100, 47100}, {65530, 65536}} {
+		if _, err := newPortPool(ip, r[0], r[1]); err == nil {
+			t.Errorf("the range %d-%d is valid", r[0], r[1])
+		}
+	}
+	// the range of three pairs, the rtcp port of the second one is in use.
+	p, err := newPortPool(ip, 47100, 47105)
+	if err != nil {
+		t.Fatal(err)
+	}
+	used, err := net.ListenUDP("udp", &net.UDPAddr{IP: ip, Port: 47103})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer used.Close()
+	var pairs []*udpPair
+	defer func() {
+		for _, pair := range pairs {
+			pair.close()
+		}
+	}()
+	for _, want := range []int{47100, 47104} {
+		pair, err1 := p.alloc(false)
+		if err1 != nil {
+			t.Fatal(err1)
+		}
+		pairs = append(pairs, pair)
+		if pair.rtpPort != want || pair.rtcpPort != want+1 || pair.rtcpConn == nil {
+			t.Fatalf("allocated %d-%d, want %d", pair.rtpPort, pair.rtcpPort, want)
+		}
+	}
+	// the rtp port of the pair skipped is released.
+	probe, err := net.ListenUDP("udp", &net.UDPAddr{IP: ip, Port: 47102})
+	if err != nil {
+		t.Fatalf("the port of the skipped pair is kept: %v", err)
+	}
+	_ = probe.Close()
+	if pair, err1 := p.alloc(false); err1 == nil {
+		pair.close()
+		t.Fatalf("allocated %d of the exhausted ports", pair.rtpPort)
+	}
+	// the closed pair is allocated again, the muxed media binds the rtp port only.
+	pairs[0].close()
+	pairs = pairs[1:]
+	pair, err := p.alloc(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pairs = append(pairs, pair)
+	if pair.rtpPort != 47100 || pair.rtcpPort != 47100 || pair.rtcpConn != nil {
+		t.Fatalf("allocated the muxed %d-%d", pair.rtpPort, pair.rtcpPort)
+	}
+}
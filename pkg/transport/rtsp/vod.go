@@ -0,0 +1,601 @@
+package rtsp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/ChinasMr/kaka/pkg/log"
+	"github.com/ChinasMr/kaka/pkg/transport/rtsp/header"
+	"gortc.io/sdp"
+	"math"
+	"math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// vodPrefix is the path prefix of the mp4 files played on demand,
+// eg: rtsp://host/vod/2023/camera.mp4
+const vodPrefix = "/vod/"
+
+// the interval of the sender reports while playing.
+const vodReportInterval = 5 * time.Second
+
+// the bounds of the scale and the speed of the playback.
+const (
+	minVODRate = 1.0 / 16
+	maxVODRate = 16
+)
+
+// vodLibrary is the mp4 files under the root played on demand,
+// every session demuxes the file by its own. The recordings under
+// the root are played by the time range too.
+type vodLibrary struct {
+	root     string
+	mu       sync.Mutex
+	sessions map[string]*vodSession
+	index    *recordIndex
+}
+
+func newVODLibrary(root string) *vodLibrary {
+	return &vodLibrary{
+		root:     root,
+		sessions: map[string]*vodSession{},
+		index:    newRecordIndex(root),
+	}
+}
+
+// vodPath returns the file of the path relative to the root and the stream,
+// eg: /vod/a/b.mp4/streamid=0 is a/b.mp4 and streamid=0
+func vodPath(p string) (string, string, bool) {
+	if !strings.HasPrefix(p, vodPrefix) {
+		return "", "", false
+	}
+	rest := p[len(vodPrefix):]
+	i := strings.Index(strings.ToLower(rest), ".mp4")
+	if i <= 0 {
+		return "", "", false
+	}
+	name, stream := rest[:i+4], rest[i+4:]
+	if stream != "" && stream[0] != '/' {
+		return "", "", false
+	}
+	return name, strings.Trim(stream, "/"), true
+}
+
+// open demux the file of the name, the name is cleaned so it can not
+// refer to the files out of the root.
+func (l *vodLibrary) open(name string) (*mp4File, error) {
+	if strings.HasPrefix(name, playbackPrefix) {
+		return l.playback(name)
+	}
+	return openMP4(filepath.Join(l.root, filepath.FromSlash(path.Clean("/"+name))))
+}
+
+func (l *vodLibrary) get(id string) (*vodSession, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s, ok := l.sessions[id]
+	return s, ok
+}
+
+func (l *vodLibrary) put(id string, s *vodSession) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sessions[id] = s
+}
+
+// remove stop the playback of the transaction and close its file.
+func (l *vodLibrary) remove(id string) {
+	l.mu.Lock()
+	s, ok := l.sessions[id]
+	delete(l.sessions, id)
+	l.mu.Unlock()
+	if ok {
+		s.close()
+	}
+}
+
+// vodSession is the playback of a file, the samples of the tracks
+// are sent by their decode time in real time.
+type vodSession struct {
+	name   string
+	file   *mp4File
+	raw    []byte
+	desc   *sdp.Message
+	tracks []*vodTrack
+	// the next samples of the tracks, and the position played to.
+	next []int
+	pos  time.Duration
+	stop chan struct{}
+	done chan struct{}
+}
+
+type vodTrack struct {
+	*mp4Track
+	control string
+	// the rtp clock rate and the random timestamp offset.
+	clock uint32
+	base  uint32
+	p     *packetizer
+	// the packages and the payload octets sent for the sender reports.
+	packets uint32
+	octets  uint32
+}
+
+func newVODSession(name string, f *mp4File) (*vodSession, error) {
+	s := &vodSession{
+		name: name,
+		file: f,
+		next: make([]int, len(f.tracks)),
+	}
+	for i, t := range f.tracks {
+		vt := &vodTrack{
+			mp4Track: t,
+			control:  fmt.Sprintf("streamid=%d", i),
+			clock:    90000,
+			base:     rand.Uint32(),
+			p:        newPacketizer(t, uint8(96+i)),
+		}
+		if t.codec == codecAAC {
+			vt.clock = uint32(t.sampleRate)
+			if vt.clock == 0 {
+				vt.clock = t.timescale
+			}
+		}
+		s.tracks = append(s.tracks, vt)
+	}
+	s.raw = s.sdp()
+	desc, err := decodeSDP(s.raw)
+	if err != nil {
+		return nil, err
+	}
+	s.desc = desc
+	return s, nil
+}
+
+// sdp returns the description of the tracks, the control of a track is its order.
+func (s *vodSession) sdp() []byte {
+	b := &bytes.Buffer{}
+	b.WriteString("v=0\r\n")
+	fmt.Fprintf(b, "o=- %d 1 IN IP4 0.0.0.0\r\n", time.Now().Unix())
+	fmt.Fprintf(b, "s=%s\r\n", s.name)
+	b.WriteString("c=IN IP4 0.0.0.0\r\nt=0 0\r\na=control:*\r\n")
+	fmt.Fprintf(b, "a=range:npt=0-%.3f\r\n", s.file.duration.Seconds())
+	for i, t := range s.tracks {
+		pt := 96 + i
+		var fmtp []string
+		switch t.codec {
+		case codecH264:
+			fmt.Fprintf(b, "m=video 0 RTP/AVP %d\r\na=rtpmap:%d H264/90000\r\n", pt, pt)
+			fmtp = append(fmtp, "packetization-mode=1")
+			if len(t.sps) > 0 && len(t.sps[0]) >= 4 {
+				fmtp = append(fmtp, fmt.Sprintf("profile-level-id=%02X%02X%02X", t.sps[0][1], t.sps[0][2], t.sps[0][3]))
+			}
+			if len(t.sps) > 0 && len(t.pps) > 0 {
+				fmtp = append(fmtp, "sprop-parameter-sets="+encodeParameterSets(append(t.sps[:1:1], t.pps...)))
+			}
+		case codecH265:
+			fmt.Fprintf(b, "m=video 0 RTP/AVP %d\r\na=rtpmap:%d H265/90000\r\n", pt, pt)
+			if len(t.vps) > 0 {
+				fmtp = append(fmtp, "sprop-vps="+encodeParameterSets(t.vps))
+			}
+			if len(t.sps) > 0 {
+				fmtp = append(fmtp, "sprop-sps="+encodeParameterSets(t.sps))
+			}
+			if len(t.pps) > 0 {
+				fmtp = append(fmtp, "sprop-pps="+encodeParameterSets(t.pps))
+			}
+		case codecAAC:
+			channels := t.channels
+			if channels == 0 {
+				channels = 1
+			}
+			fmt.Fprintf(b, "m=audio 0 RTP/AVP %d\r\na=rtpmap:%d MPEG4-GENERIC/%d/%d\r\n", pt, pt, t.clock, channels)
+			fmtp = append(fmtp, "streamtype=5", "profile-level-id=1", "mode=AAC-hbr",
+				"sizelength=13", "indexlength=3", "indexdeltalength=3", "config="+hex.EncodeToString(t.config))
+		}
+		if len(fmtp) > 0 {
+			fmt.Fprintf(b, "a=fmtp:%d %s\r\n", pt, strings.Join(fmtp, ";"))
+		}
+		fmt.Fprintf(b, "a=control:%s\r\n", t.control)
+	}
+	return b.Bytes()
+}
+
+func encodeParameterSets(sets [][]byte) string {
+	rv := make([]string, 0, len(sets))
+	for _, set := range sets {
+		rv = append(rv, base64.StdEncoding.EncodeToString(set))
+	}
+	return strings.Join(rv, ",")
+}
+
+// track returns the order of the track by its control.
+func (s *vodSession) track(control string) (int, bool) {
+	for i, t := range s.tracks {
+		if t.control == control {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// seek move the next samples to the position, the first video track starts
+// from its sync sample and the others follow it. It returns the position.
+func (s *vodSession) seek(pos time.Duration) time.Duration {
+	for _, t := range s.tracks {
+		if t.codec == codecAAC {
+			continue
+		}
+		if i := t.seek(pos); i < len(t.samples) {
+			pos = t.time(t.samples[i].dts)
+		}
+		break
+	}
+	for i, t := range s.tracks {
+		s.next[i] = t.seek(pos)
+	}
+	s.pos = pos
+	return pos
+}
+
+// rtpInfo returns the rtp info of the tracks set up, for the playback from the position.
+func (s *vodSession) rtpInfo(base string, tx Transaction) string {
+	medias := tx.Medias()
+	base = strings.TrimSuffix(base, "/")
+	rv := make([]string, 0, len(s.tracks))
+	for _, t := range s.tracks {
+		if _, ok := medias[t.control]; ok {
+			rv = append(rv, header.NewRTPInfo(base+"/"+t.control, t.p.seq, t.rtpTime(s.pos)))
+		}
+	}
+	return header.JoinRTPInfo(rv...)
+}
+
+// rtpTime returns the rtp timestamp of the media time.
+func (t *vodTrack) rtpTime(d time.Duration) uint32 {
+	return t.base + uint32(int64(d.Seconds()*float64(t.clock)))
+}
+
+// play start sending from the position at the rate, until the end if not negative.
+func (s *vodSession) play(tx Transaction, rate float64, end time.Duration) {
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.run(tx, tx.ID(), rate, end, s.stop, s.done)
+}
+
+// pause stop sending, the position is kept for resuming.
+func (s *vodSession) pause() {
+	if s.stop == nil {
+		return
+	}
+	close(s.stop)
+	<-s.done
+	s.stop, s.done = nil, nil
+}
+
+func (s *vodSession) close() {
+	s.pause()
+	_ = s.file.Close()
+}
+
+func (s *vodSession) run(tx Transaction, id string, rate float64, end time.Duration, stop chan struct{}, done chan struct{}) {
+	defer close(done)
+	// the orders of the session medias of the tracks, -1 if not set up.
+	medias := tx.Medias()
+	orders := make([]int, len(s.tracks))
+	for i, t := range s.tracks {
+		orders[i] = -1
+		if m, ok := medias[t.control]; ok {
+			orders[i] = m.order
+		}
+	}
+	start, began := s.pos, time.Now()
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	defer timer.Stop()
+	var buf []byte
+	var reported time.Time
+	for {
+		k, at := s.nextTrack()
+		if k < 0 || end >= 0 && at > end {
+			s.finish(tx, orders, start)
+			return
+		}
+		if wait := time.Until(began.Add(time.Duration(float64(at-start) / rate))); wait > 0 {
+			timer.Reset(wait)
+			select {
+			case <-stop:
+				return
+			case <-timer.C:
+			}
+		} else {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+		}
+		// the transaction is deleted.
+		if tx.ID() != id {
+			return
+		}
+		if time.Since(reported) >= vodReportInterval {
+			reported = time.Now()
+			s.report(tx, orders, start+time.Duration(float64(time.Since(began))*rate))
+		}
+		t := s.tracks[k]
+		sample := t.samples[s.next[k]]
+		s.next[k]++
+		s.pos = at
+		if orders[k] < 0 {
+			continue
+		}
+		var err error
+		buf, err = s.file.readSample(sample, buf)
+		if err != nil {
+			log.Errorf("can not read the sample of %s: %v", s.name, err)
+			return
+		}
+		// the video is timestamped by the presentation time.
+		pts := int64(sample.dts) + int64(sample.cts)
+		ts := t.base + uint32(pts*int64(t.clock)/int64(t.timescale))
+		for _, pkt := range t.p.packetize(buf, ts, sample.sync && t.codec != codecAAC) {
+			if err = s.send(tx, orders[k], pkt, false); err != nil {
+				return
+			}
+			t.packets++
+			t.octets += uint32(len(pkt) - 12)
+		}
+	}
+}
+
+// nextTrack returns the track whose next sample decodes first, and its decode time.
+func (s *vodSession) nextTrack() (int, time.Duration) {
+	k := -1
+	var at time.Duration
+	for i, t := range s.tracks {
+		if s.next[i] >= len(t.samples) {
+			continue
+		}
+		if d := t.time(t.samples[s.next[i]].dts); k < 0 || d < at {
+			k, at = i, d
+		}
+	}
+	return k, at
+}
+
+func (s *vodSession) send(tx Transaction, order int, data []byte, rtcp bool) error {
+	p := newPackage(len(data))
+	p.Len = uint32(copy(p.Data, data))
+	p.Order = order
+	if rtcp {
+		p.Ch = 1
+	}
+	p.retain()
+	err := tx.Forward(p)
+	p.release()
+	return err
+}
+
+// report send the sender reports of the tracks at the media time played,
+// so the client synchronizes the tracks.
+func (s *vodSession) report(tx Transaction, orders []int, at time.Duration) {
+	now := time.Now()
+	// the ntp time is counted from 1900.
+	secs := uint64(now.Unix()) + 2208988800
+	frac := uint64(now.Nanosecond()) << 32 / uint64(time.Second)
+	sr := make([]byte, 28)
+	for i, t := range s.tracks {
+		if orders[i] < 0 {
+			continue
+		}
+		sr[0], sr[1] = 0x80, 200
+		binary.BigEndian.PutUint16(sr[2:], 6)
+		binary.BigEndian.PutUint32(sr[4:], t.p.ssrc)
+		binary.BigEndian.PutUint32(sr[8:], uint32(secs))
+		binary.BigEndian.PutUint32(sr[12:], uint32(frac))
+		binary.BigEndian.PutUint32(sr[16:], t.rtpTime(at))
+		binary.BigEndian.PutUint32(sr[20:], t.packets)
+		binary.BigEndian.PutUint32(sr[24:], t.octets)
+		_ = s.send(tx, orders[i], sr, true)
+	}
+}
+
+// finish send the rtcp bye of the tracks at the end of the playback,
+// and notify the rtsp 2.0 client.
+func (s *vodSession) finish(tx Transaction, orders []int, start time.Duration) {
+	bye := []byte{0x81, 203, 0, 1, 0, 0, 0, 0}
+	for i, t := range s.tracks {
+		if orders[i] < 0 {
+			continue
+		}
+		binary.BigEndian.PutUint32(bye[4:], t.p.ssrc)
+		_ = s.send(tx, orders[i], bye, true)
+	}
+	_ = tx.Notify(header.NotifyEndOfStream, map[string]string{
+		header.Range: header.NewNPTRange(start, s.pos).String(),
+	})
+}
+
+// clampRate returns the scale or the speed played at,
+// the backward playback is not supported.
+func clampRate(v float64) float64 {
+	if v <= 0 {
+		return 1
+	}
+	return math.Min(math.Max(v, minVODRate), maxVODRate)
+}
+
+// vodPath returns the file and the stream of the request if it is on demand.
+func (u *UnimplementedServerHandler) vodPath(req Request) (string, string, bool) {
+	if u.vod == nil {
+		return "", "", false
+	}
+	if name, stream, ok := playbackPath(req.Path()); ok {
+		return name, stream, true
+	}
+	return vodPath(req.Path())
+}
+
+func (u *UnimplementedServerHandler) describeVOD(req Request, res Response, tx Transaction, name string) error {
+	f, err := u.vod.open(name)
+	if err != nil {
+		log.Errorf("can not open %s: %v", name, err)
+		if os.IsNotExist(err) {
+			return tx.Response(ErrNotFound(res))
+		}
+		return tx.Response(ErrInternal(res))
+	}
+	s, err := newVODSession(name, f)
+	_ = f.Close()
+	if err != nil {
+		log.Errorf("can not describe %s: %v", name, err)
+		return tx.Response(ErrInternal(res))
+	}
+	res.SetHeader(header.ContentType, header.ContentTypeSDP)
+	res.SetBody(s.raw)
+	return tx.Response(res)
+}
+
+func (u *UnimplementedServerHandler) setupVOD(req Request, res Response, tx Transaction, name string, stream string) error {
+	tr, _ := req.Transport()
+	// the files are played by the unicast without srtp.
+	if tr.Record() || tr.Multicast() || tr.Secure() {
+		return tx.Response(ErrUnsupportedTransport(res))
+	}
+	s, ok := u.vod.get(tx.ID())
+	if ok && s.name != name {
+		// the session plays a single file.
+		return tx.Response(ErrMethodNotValidINThisState(res))
+	}
+	if !ok {
+		f, err := u.vod.open(name)
+		if err != nil {
+			log.Errorf("can not open %s: %v", name, err)
+			if os.IsNotExist(err) {
+				return tx.Response(ErrNotFound(res))
+			}
+			return tx.Response(ErrInternal(res))
+		}
+		s, err = newVODSession(name, f)
+		if err != nil {
+			_ = f.Close()
+			log.Errorf("can not describe %s: %v", name, err)
+			return tx.Response(ErrInternal(res))
+		}
+		u.vod.put(tx.ID(), s)
+	}
+	i, ok := s.track(stream)
+	if !ok {
+		return tx.Response(ErrNotFound(res))
+	}
+	if !u.setupUnicast(req, res, tx, tr, s.desc.Medias[i], nil) {
+		return tx.Response(ErrUnsupportedTransport(res))
+	}
+	if req.Proto() == Version2 {
+		if len(s.file.wall) > 0 {
+			res.SetHeader(header.AcceptRanges, "npt, smpte, clock")
+		} else {
+			res.SetHeader(header.AcceptRanges, "npt, smpte")
+		}
+		res.SetHeader(header.MediaProperties, header.NewMediaProperties(
+			header.PropRandomAccess,
+			header.PropImmutable,
+			header.PropUnlimited,
+		))
+	}
+	err := tx.Response(res)
+	if err != nil {
+		return err
+	}
+	tx.PreReady(s.desc)
+	return nil
+}
+
+func (u *UnimplementedServerHandler) playVOD(req Request, res Response, tx Transaction) error {
+	s, ok := u.vod.get(tx.ID())
+	if !ok {
+		return tx.Response(ErrSessionNotFound(res))
+	}
+	// the files have no wall clock time, the recordings played by the time range have.
+	rng, hasRange := req.Range()
+	clocked := hasRange && rng.Unit == header.RangeClock
+	if clocked {
+		if len(s.file.wall) == 0 {
+			return tx.Response(ErrInvalidRange(res))
+		}
+		rng.Start = s.file.position(rng.StartTime)
+		rng.End = s.file.position(rng.EndTime)
+	}
+	if hasRange && rng.HasStart && rng.Start > s.file.duration {
+		return tx.Response(ErrInvalidRange(res))
+	}
+	if !tx.PrePlay(s.desc) {
+		return tx.Response(ErrInternal(res))
+	}
+	s.pause()
+	if hasRange && rng.HasStart {
+		s.seek(rng.Start)
+	}
+	end := time.Duration(-1)
+	if hasRange && rng.HasEnd {
+		end = rng.End
+	}
+	scale, speed := 1.0, 1.0
+	if v, has := req.Scale(); has {
+		scale = clampRate(v)
+		res.SetHeader(header.Scale, header.FormatFloat(scale))
+	}
+	// the normal speed is preferred in the bounds.
+	if lo, hi, has := req.Speed(); has {
+		speed = clampRate(math.Min(math.Max(1, lo), hi))
+		res.SetHeader(header.Speed, header.FormatFloat(speed))
+	}
+	played := header.NewNPTRange(s.pos, s.file.duration)
+	if end >= 0 {
+		played.End = end
+	}
+	if clocked {
+		played = header.TimeRange{
+			Unit:      header.RangeClock,
+			StartTime: s.file.clock(played.Start),
+			EndTime:   s.file.clock(played.End),
+			HasStart:  true,
+			HasEnd:    true,
+		}
+	}
+	res.SetHeader(header.Range, played.String())
+	if info := s.rtpInfo(req.URL().String(), tx); info != "" {
+		res.SetHeader(header.RTPInfo, info)
+	}
+	err := tx.Response(res)
+	if err != nil {
+		return err
+	}
+	s.play(tx, scale*speed, end)
+	return nil
+}
+
+func (u *UnimplementedServerHandler) pauseVOD(req Request, res Response, tx Transaction) error {
+	s, ok := u.vod.get(tx.ID())
+	if !ok {
+		return tx.Response(ErrSessionNotFound(res))
+	}
+	s.pause()
+	tx.PreReady(s.desc)
+	res.SetHeader(header.Range, header.NewNPTRange(s.pos, -1).String())
+	return tx.Response(res)
+}
+
+func (u *UnimplementedServerHandler) teardownVOD(req Request, res Response, tx Transaction) error {
+	u.vod.remove(tx.ID())
+	tx.PreInit()
+	return tx.Response(res)
+}
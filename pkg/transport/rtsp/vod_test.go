@@ -0,0 +1,86 @@
+package rtsp
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVODPath(t *testing.T) {
+	for _, tc := range []struct {
+		path, name, stream string
+		ok                 bool
+	}{
+		{path: "/vod/a/b.mp4", name: "a/b.mp4", ok: true},
+		{path: "/vod/a/b.MP4/streamid=1", name: "a/b.MP4", stream: "streamid=1", ok: true},
+		{path: "/vod/b.mp4/", name: "b.mp4", ok: true},
+		{path: "/vod/b.mp4x", ok: false},
+		{path: "/vod/.mp4", ok: false},
+		{path: "/live/b.mp4", ok: false},
+	} {
+		name, stream, ok := vodPath(tc.path)
+		if name != tc.name || stream != tc.stream || ok != tc.ok {
+			t.Errorf("vodPath(%q) = %q, %q, %v", tc.path, name, stream, ok)
+		}
+	}
+}
+
+func TestVODPlay(t *testing.T) {
+	root := t.TempDir()
+	writeTestSegments(t, root, 1)
+	names, _ := filepath.Glob(filepath.Join(root, "cam", "*.mp4"))
+	if len(names) != 1 {
+		t.Fatalf("segments %v", names)
+	}
+	// the files out of the root are not played.
+	if err := os.WriteFile(filepath.Join(filepath.Dir(root), "out.mp4"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, addr := newTestServer(t, VOD(root))
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	br := bufio.NewReader(c)
+	res := rawRequest(t, c, br, "DESCRIBE rtsp://%s/vod/../out.mp4 RTSP/1.0\r\nCSeq: 1\r\n\r\n", addr)
+	if res.Code() != 404 {
+		t.Fatalf("DESCRIBE the file out of the root %d", res.Code())
+	}
+	url := "rtsp://" + addr + "/vod/cam/" + filepath.Base(names[0])
+	res = rawRequest(t, c, br, "DESCRIBE %s RTSP/1.0\r\nCSeq: 2\r\n\r\n", url)
+	if res.Code() != 200 || !bytes.Contains(res.Body(), []byte("H264/90000")) || !bytes.Contains(res.Body(), []byte("a=range:npt=0-2")) {
+		t.Fatalf("DESCRIBE %d:\n%s", res.Code(), res.Body())
+	}
+	res = rawRequest(t, c, br, "SETUP %s/streamid=0 RTSP/1.0\r\nCSeq: 3\r\nTransport: RTP/AVP/TCP;unicast;interleaved=0-1\r\n\r\n", url)
+	session, _ := res.Header("Session")
+	if res.Code() != 200 || len(session) == 0 {
+		t.Fatalf("SETUP %d", res.Code())
+	}
+	// the video is played from the keyframe of the second 1.
+	res = rawRequest(t, c, br, "PLAY %s RTSP/1.0\r\nCSeq: 4\r\nSession: %s\r\nRange: npt=1.5-\r\nScale: 16\r\n\r\n", url, strings.Split(session[0], ";")[0])
+	rng, _ := res.Header("Range")
+	info, _ := res.Header("RTP-Info")
+	if res.Code() != 200 || len(rng) == 0 || rng[0] != "npt=1.000-2.000" || len(info) == 0 {
+		t.Fatalf("PLAY %d, Range %v, RTP-Info %v", res.Code(), rng, info)
+	}
+	for frame := 25; frame < testSegmentFrames; {
+		p, err1 := readInterleavedPackage(br, make([]byte, 4))
+		if err1 != nil {
+			t.Fatalf("read the frame %d: %v", frame, err1)
+		}
+		// the parameter sets are sent before the keyframe.
+		if nal := p.Data[12] & 0x1f; p.Ch == 0 && nal != 7 && nal != 8 {
+			// the single nal unit of the frame follows the rtp header.
+			if want := testFrame(0, frame)[4:]; !bytes.Equal(p.Data[12:p.Len], want) {
+				t.Fatalf("frame %d: %x", frame, p.Data[12:16])
+			}
+			frame++
+		}
+		putPackage(p)
+	}
+}
@@ -0,0 +1,250 @@
+package rtsp
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/ChinasMr/kaka/pkg/log"
+	"github.com/google/uuid"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// the types of the events posted to the webhooks.
+const (
+	// EventPublish is a source starts recording to the channel.
+	EventPublish = "publish"
+	// EventUnpublish is the source of the channel tears down or disconnects.
+	EventUnpublish = "unpublish"
+	// EventPlay is a reader starts playing the channel.
+	EventPlay = "play"
+	// EventStop is a reader tears down or disconnects.
+	EventStop = "stop"
+	// EventSegment is a recorded segment under the vod root is complete.
+	EventSegment = "segment"
+)
+
+const (
+	defaultWebhookTimeout = 5 * time.Second
+	defaultWebhookRetries = 3
+	// the events queued for every webhook, the newer ones are dropped when full.
+	webhookQueueSize  = 256
+	webhookMinBackoff = time.Second
+	webhookMaxBackoff = 30 * time.Second
+)
+
+// the headers of the posted events, the signature is the hex hmac-sha256
+// of the body by the secret of the webhook, eg: sha256=5d5b09f6dcb2d53a...
+const (
+	headerWebhookEvent     = "X-Kaka-Event"
+	headerWebhookDelivery  = "X-Kaka-Delivery"
+	headerWebhookSignature = "X-Kaka-Signature"
+)
+
+// Event is posted to the webhooks as json, a retried one keeps its id.
+type Event struct {
+	ID      string    `json:"id"`
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	Channel string    `json:"channel"`
+	// the session and the ip of the source or the reader.
+	Session string `json:"session,omitempty"`
+	IP      string `json:"ip,omitempty"`
+	// the url the source of the channel is pulled from.
+	Source string `json:"source,omitempty"`
+	// the complete segment of the segment event.
+	Segment *RecordSegment `json:"segment,omitempty"`
+}
+
+type webhookConfig struct {
+	url     string
+	secret  string
+	timeout time.Duration
+	retries int
+}
+
+// webhook post the events to the url one by one in their order,
+// the failed one is retried with backoff before the next one.
+type webhook struct {
+	webhookConfig
+	client *http.Client
+	queue  chan Event
+}
+
+// webhooks deliver the events of the server to every webhook.
+type webhooks struct {
+	hooks []*webhook
+	// the recordings watched for the complete segments, nil if no vod.
+	index  *recordIndex
+	mu     sync.Mutex
+	cancel context.CancelFunc
+}
+
+func newWebhooks(configs []webhookConfig) *webhooks {
+	rv := &webhooks{}
+	for _, c := range configs {
+		if c.timeout <= 0 {
+			c.timeout = defaultWebhookTimeout
+		}
+		if c.retries <= 0 {
+			c.retries = defaultWebhookRetries
+		}
+		rv.hooks = append(rv.hooks, &webhook{
+			webhookConfig: c,
+			client:        &http.Client{Timeout: c.timeout},
+			queue:         make(chan Event, webhookQueueSize),
+		})
+	}
+	return rv
+}
+
+func (w *webhooks) start() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.cancel != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+	for _, h := range w.hooks {
+		go h.run(ctx)
+	}
+	if w.index != nil {
+		go w.watch(ctx)
+	}
+}
+
+func (w *webhooks) stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.cancel == nil {
+		return
+	}
+	w.cancel()
+	w.cancel = nil
+}
+
+// emit queue the event to every webhook without blocking.
+func (w *webhooks) emit(e Event) {
+	if w == nil {
+		return
+	}
+	e.ID = uuid.New().String()
+	e.Time = time.Now()
+	for _, h := range w.hooks {
+		select {
+		case h.queue <- e:
+		default:
+			log.Errorf("drop the %s event of channel %s, the webhook %s is behind", e.Type, e.Channel, h.url)
+		}
+	}
+}
+
+// watch scan the recordings in the interval, so the complete segments are
+// notified without the recordings being listed.
+func (w *webhooks) watch(ctx context.Context) {
+	ticker := time.NewTicker(recordScanInterval)
+	defer ticker.Stop()
+	for {
+		w.index.refresh(0)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *webhook) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-h.queue:
+			h.deliver(ctx, e)
+		}
+	}
+}
+
+// deliver post the event until the webhook accepts it or the retries run out,
+// the client errors are not retried.
+func (h *webhook) deliver(ctx context.Context, e Event) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		log.Errorf("can not marshal the %s event: %v", e.Type, err)
+		return
+	}
+	backoff := webhookMinBackoff
+	for attempt := 0; ; attempt++ {
+		retry, err := h.post(ctx, e, body)
+		if err == nil {
+			return
+		}
+		if !retry || attempt >= h.retries || ctx.Err() != nil {
+			log.Errorf("can not post the %s event of channel %s to %s: %v", e.Type, e.Channel, h.url, err)
+			return
+		}
+		log.Debugf("retry the %s event of channel %s to %s: %v", e.Type, e.Channel, h.url, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > webhookMaxBackoff {
+			backoff = webhookMaxBackoff
+		}
+	}
+}
+
+// post the event once, it returns true if the failure is worth retrying.
+func (h *webhook) post(ctx context.Context, e Event, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(headerWebhookEvent, e.Type)
+	req.Header.Set(headerWebhookDelivery, e.ID)
+	if h.secret != "" {
+		req.Header.Set(headerWebhookSignature, "sha256="+signWebhook(h.secret, body))
+	}
+	res, err := h.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	_ = res.Body.Close()
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("unexpected status %s", res.Status)
+	return res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests, err
+}
+
+// signWebhook returns the hex hmac-sha256 of the body by the secret.
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// notify emit the event of the session on the channel.
+func (c *channel) notify(kind string, tx Transaction) {
+	if c.cc.hooks == nil {
+		return
+	}
+	e := Event{
+		Type:    kind,
+		Channel: c.name,
+		Session: tx.ID(),
+	}
+	if ip := tx.IP(); ip != nil {
+		e.IP = ip.String()
+	}
+	c.cc.hooks.emit(e)
+}
@@ -0,0 +1,125 @@
+package rtsp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookStub answers the posted events by the statuses in turn, the last one repeated.
+type webhookStub struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+	events   chan Event
+}
+
+func newWebhookStub(t *testing.T, statuses ...int) (*webhookStub, *httptest.Server) {
+	stub := &webhookStub{statuses: statuses, events: make(chan Event, 16)}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		stub.mu.Lock()
+		code := stub.statuses[0]
+		if len(stub.statuses) > 1 {
+			stub.statuses = stub.statuses[1:]
+		}
+		stub.requests = append(stub.requests, r)
+		stub.bodies = append(stub.bodies, body)
+		stub.mu.Unlock()
+		w.WriteHeader(code)
+		var e Event
+		if code < 300 && json.Unmarshal(body, &e) == nil {
+			stub.events <- e
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return stub, srv
+}
+
+func TestWebhookDeliver(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		statuses []int
+		attempts int
+	}{
+		{name: "accepted", statuses: []int{http.StatusNoContent}, attempts: 1},
+		{name: "retry server errors", statuses: []int{http.StatusServiceUnavailable, http.StatusOK}, attempts: 2},
+		{name: "retry too many requests", statuses: []int{http.StatusTooManyRequests, http.StatusOK}, attempts: 2},
+		{name: "no retry client errors", statuses: []int{http.StatusBadRequest}, attempts: 1},
+		{name: "retries run out", statuses: []int{http.StatusInternalServerError}, attempts: 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stub, srv := newWebhookStub(t, tc.statuses...)
+			w := newWebhooks([]webhookConfig{{url: srv.URL, secret: "s3cret", retries: 1}})
+			e := Event{ID: "42", Type: EventPublish, Channel: "live"}
+			w.hooks[0].deliver(context.Background(), e)
+			stub.mu.Lock()
+			defer stub.mu.Unlock()
+			if len(stub.requests) != tc.attempts {
+				t.Fatalf("%d attempts, want %d", len(stub.requests), tc.attempts)
+			}
+			for i, r := range stub.requests {
+				if r.Header.Get(headerWebhookEvent) != EventPublish || r.Header.Get(headerWebhookDelivery) != "42" {
+					t.Errorf("attempt %d of the event %q delivery %q", i, r.Header.Get(headerWebhookEvent), r.Header.Get(headerWebhookDelivery))
+				}
+				if sig := r.Header.Get(headerWebhookSignature); sig != "sha256="+signWebhook("s3cret", stub.bodies[i]) {
+					t.Errorf("attempt %d signed %q", i, sig)
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+	w := newWebhooks([]webhookConfig{{url: srv.URL, timeout: 100 * time.Millisecond}})
+	begin := time.Now()
+	retry, err := w.hooks[0].post(context.Background(), Event{ID: "42", Type: EventPlay}, []byte("{}"))
+	if err == nil || !retry {
+		t.Fatalf("the timeout is not retried: %v, %v", retry, err)
+	}
+	if elapsed := time.Since(begin); elapsed > time.Second {
+		t.Fatalf("timed out in %v", elapsed)
+	}
+}
+
+func TestWebhookPulledSource(t *testing.T) {
+	_, upstream := newTestServer(t)
+	pub := publishClient(t, upstream, "live", true)
+	defer pub.Close()
+	stub, hook := newWebhookStub(t, http.StatusOK)
+	s, _ := newTestServer(t, WithPullChannel("pulled", "rtsp://"+upstream+"/live", false),
+		Webhook(hook.URL, "", time.Second, 1))
+	next := func() Event {
+		t.Helper()
+		select {
+		case e := <-stub.events:
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event posted")
+		}
+		return Event{}
+	}
+	if e := next(); e.Type != EventPublish || e.Channel != "pulled" || e.Source != "rtsp://"+upstream+"/live" || e.ID == "" {
+		t.Fatalf("posted %+v", e)
+	}
+	// the upstream drops once the pulling stops.
+	s.pullers[0].stop()
+	if e := next(); e.Type != EventUnpublish || e.Channel != "pulled" {
+		t.Fatalf("posted %+v", e)
+	}
+}
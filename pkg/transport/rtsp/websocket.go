@@ -0,0 +1,119 @@
+package rtsp
+
+import (
+	"github.com/gorilla/websocket"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// the subprotocol of rtsp over websocket defined by the ONVIF streaming specification.
+const subprotocolONVIF = "rtsp.onvif"
+
+var upgrader = websocket.Upgrader{
+	Subprotocols:    []string{subprotocolONVIF},
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+	// the players are usually served by other origins.
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+// WebSocketHandler returns the handler of the rtsp over websocket endpoint,
+// the rtsp messages and interleaved frames are carried by the binary messages.
+func (s *Server) WebSocketHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			s.log.Errorf("can not upgrade websocket: %v", err)
+			return
+		}
+		trans, err := newWebSocketTransport(ws)
+		if err != nil {
+			s.log.Errorf("can not create transport: %v", err)
+			_ = ws.Close()
+			return
+		}
+		s.log.Debugf("new websocket connection created from: %v", trans.Addr())
+		s.handleTransport(trans)
+		s.log.Debugf("websocket connection closed to: %v", trans.Addr())
+	})
+}
+
+func newWebSocketTransport(ws *websocket.Conn) (Transport, error) {
+	trans, err := newTransport(&wsConn{ws: ws})
+	if err != nil {
+		return nil, err
+	}
+	return trans, nil
+}
+
+// wsConn makes the websocket a stream connection.
+type wsConn struct {
+	ws *websocket.Conn
+	r  io.Reader
+	wm sync.Mutex
+}
+
+func (c *wsConn) Read(b []byte) (int, error) {
+	for {
+		if c.r == nil {
+			_, r, err := c.ws.NextReader()
+			if err != nil {
+				return 0, err
+			}
+			c.r = r
+		}
+		n, err := c.r.Read(b)
+		if err == io.EOF {
+			c.r = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+// Write send the data as a single binary message.
+func (c *wsConn) Write(b []byte) (int, error) {
+	c.wm.Lock()
+	defer c.wm.Unlock()
+	err := c.ws.WriteMessage(websocket.BinaryMessage, b)
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *wsConn) Close() error {
+	return c.ws.Close()
+}
+
+func (c *wsConn) LocalAddr() net.Addr {
+	return c.ws.LocalAddr()
+}
+
+func (c *wsConn) RemoteAddr() net.Addr {
+	return c.ws.RemoteAddr()
+}
+
+func (c *wsConn) SetDeadline(t time.Time) error {
+	err := c.ws.SetReadDeadline(t)
+	if err != nil {
+		return err
+	}
+	return c.ws.SetWriteDeadline(t)
+}
+
+func (c *wsConn) SetReadDeadline(t time.Time) error {
+	return c.ws.SetReadDeadline(t)
+}
+
+func (c *wsConn) SetWriteDeadline(t time.Time) error {
+	return c.ws.SetWriteDeadline(t)
+}
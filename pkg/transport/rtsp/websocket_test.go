@@ -0,0 +1,80 @@
+package rtsp
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestWebSocketPlay(t *testing.T) {
+	s, addr := newTestServer(t)
+	hs := httptest.NewServer(s.WebSocketHandler())
+	defer hs.Close()
+	dialer := websocket.Dialer{Subprotocols: []string{subprotocolONVIF}}
+	ws, resp, err := dialer.Dial("ws"+strings.TrimPrefix(hs.URL, "http"), http.Header{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	if ws.Subprotocol() != subprotocolONVIF {
+		t.Fatalf("the subprotocol %q of %d", ws.Subprotocol(), resp.StatusCode)
+	}
+	c := &wsConn{ws: ws}
+	br := bufio.NewReader(c)
+	url := "rtsp://" + addr + "/live"
+
+	// the request split into the messages is joined.
+	for _, part := range []string{"OPTIONS " + url + " RTSP/1.0\r\n", "CSeq: 1\r\n", "\r\n"} {
+		if err = ws.WriteMessage(websocket.BinaryMessage, []byte(part)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	res, err := parseResponse(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cseq, _ := res.Header("CSeq"); res.Code() != 200 || len(cseq) == 0 || cseq[0] != "1" {
+		t.Fatalf("OPTIONS %d", res.Code())
+	}
+
+	pub := publishClient(t, addr, "live", true)
+	defer pub.Close()
+	res = rawRequest(t, c, br, "DESCRIBE %s RTSP/1.0\r\nCSeq: 2\r\n\r\n", url)
+	if res.Code() != 200 || !strings.Contains(string(res.Body()), "a=control:streamid=1") {
+		t.Fatalf("DESCRIBE %d:\n%s", res.Code(), res.Body())
+	}
+	res = rawRequest(t, c, br, "SETUP %s/streamid=0 RTSP/1.0\r\nCSeq: 3\r\nTransport: RTP/AVP/TCP;unicast;interleaved=0-1\r\n\r\n", url)
+	session, _ := res.Header("Session")
+	if res.Code() != 200 || len(session) == 0 {
+		t.Fatalf("SETUP %d", res.Code())
+	}
+	id := strings.Split(session[0], ";")[0]
+	res = rawRequest(t, c, br, "SETUP %s/streamid=1 RTSP/1.0\r\nCSeq: 4\r\nSession: %s\r\nTransport: RTP/AVP/TCP;unicast;interleaved=2-3\r\n\r\n", url, id)
+	if res.Code() != 200 {
+		t.Fatalf("SETUP %d", res.Code())
+	}
+	res = rawRequest(t, c, br, "PLAY %s RTSP/1.0\r\nCSeq: 5\r\nSession: %s\r\n\r\n", url, id)
+	if res.Code() != 200 {
+		t.Fatalf("PLAY %d", res.Code())
+	}
+	// the packages of the publisher are interleaved in the messages.
+	for seq := uint16(0); seq < 3; seq++ {
+		if err = writeTestPackage(pub, 1, seq); err != nil {
+			t.Fatal(err)
+		}
+		p, err1 := readInterleavedPackage(br, make([]byte, 4))
+		if err1 != nil {
+			t.Fatal(err1)
+		}
+		if p.Ch != 2 || p.Len != 16 || p.Data[1]&0x7f != 97 {
+			t.Fatalf("the package %d of the channel %d: %x", seq, p.Ch, p.Data[:p.Len])
+		}
+		putPackage(p)
+	}
+}